@@ -1,15 +1,25 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
+	"time"
 
 	"github.com/CpBruceMeena/go-balance/internal/handlers"
+	"github.com/CpBruceMeena/go-balance/internal/store"
 	"github.com/gorilla/mux"
 )
 
+// How long requests in flight get to finish on shutdown
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	// Get the executable path
 	ex, err := os.Executable()
@@ -21,6 +31,69 @@ func main() {
 	// Construct the path to the frontend build directory
 	frontendPath := filepath.Join(exPath, "..", "frontend", "build")
 
+	storeType := flag.String("store", "json", "Storage backend for clusters and nodes: json, bolt or none")
+	dataFile := flag.String("data-file", "", "Path of the store's data file (defaults to data/clusters.json or data/go-balance.db next to the executable)")
+	configFile := flag.String("config", "", "YAML or JSON file declaring clusters and nodes; watched and re-applied when it changes")
+	auditFile := flag.String("audit-file", "", "JSON lines file for the audit log, configuration revisions and webhook deliveries when the store has no history support (defaults to data/audit.jsonl next to the executable)")
+	tlsDir := flag.String("tls-dir", "", "Directory health check TLS settings may name CA, certificate and key files in (defaults to data/tls next to the executable)")
+	historyRetention := flag.Duration("history-retention", 30*24*time.Hour, "How long stats history and webhook deliveries are kept; 0 keeps them forever. Audit records and configuration revisions are never removed")
+	flag.Parse()
+
+	if *tlsDir == "" {
+		*tlsDir = filepath.Join(exPath, "data", "tls")
+	}
+	if err := handlers.UseTLSDir(*tlsDir); err != nil {
+		log.Fatal(err)
+	}
+
+	// Restore persisted clusters before serving any requests
+	var clusterStore store.Store
+	switch *storeType {
+	case "json":
+		if *dataFile == "" {
+			*dataFile = filepath.Join(exPath, "data", "clusters.json")
+		}
+		clusterStore, err = store.NewJSONStore(*dataFile)
+	case "bolt":
+		if *dataFile == "" {
+			*dataFile = filepath.Join(exPath, "data", "go-balance.db")
+		}
+		clusterStore, err = store.NewBoltStore(*dataFile, *historyRetention)
+	case "none":
+	default:
+		log.Fatalf("Unknown store %q; use json, bolt or none", *storeType)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// The bolt store keeps the audit log, revisions and deliveries itself;
+	// otherwise they go to a JSON lines file unless nothing is persisted at all
+	if _, ok := clusterStore.(store.HistoryStore); !ok && (clusterStore != nil || *auditFile != "") {
+		if *auditFile == "" {
+			*auditFile = filepath.Join(exPath, "data", "audit.jsonl")
+		}
+		auditLog, err := store.NewJSONLinesHistory(*auditFile, *historyRetention)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer auditLog.Close()
+		handlers.UseHistory(auditLog)
+	}
+	if clusterStore != nil {
+		defer clusterStore.Close()
+		if err := handlers.UseStore(clusterStore); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Apply the declarative configuration on top of the restored state
+	if *configFile != "" {
+		if err := handlers.UseConfigFile(*configFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	// Create a new router
 	router := mux.NewRouter()
 
@@ -31,9 +104,29 @@ func main() {
 	fs := http.FileServer(http.Dir(frontendPath))
 	router.PathPrefix("/").Handler(fs)
 
+	// Stop accepting requests on SIGINT or SIGTERM and let those in flight
+	// finish, so the stores are closed cleanly when main returns
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	server := &http.Server{Addr: ":8080", Handler: router}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		log.Printf("Shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Shutdown: %v", err)
+		}
+	}()
+
 	// Start the server
 	log.Printf("Server starting on :8080, serving files from %s", frontendPath)
-	if err := http.ListenAndServe(":8080", router); err != nil {
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
 		log.Fatal(err)
 	}
+	<-stopped
+	handlers.Shutdown()
+	log.Printf("Server stopped")
 }
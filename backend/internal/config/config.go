@@ -0,0 +1,113 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/CpBruceMeena/go-balance/internal/models"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is the serialization of a configuration document
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatYAML Format = "yaml"
+)
+
+// File is the declarative description of clusters and their nodes. Clusters
+// are identified by name and nodes by URL.
+type File struct {
+	Clusters []ClusterConfig `json:"clusters" yaml:"clusters"`
+}
+
+// ClusterConfig holds the configurable settings of a cluster; runtime state
+// such as health and request stats is deliberately absent
+type ClusterConfig struct {
+	Name                  string                 `json:"name" yaml:"name"`
+	Slug                  string                 `json:"slug,omitempty" yaml:"slug,omitempty"` // Proxy path segment; derived from the name when empty
+	Algorithm             string                 `json:"algorithm,omitempty" yaml:"algorithm,omitempty"`
+	HealthCheckEndpoint   string                 `json:"healthCheckEndpoint,omitempty" yaml:"healthCheckEndpoint,omitempty"`
+	HealthCheckFrequency  int                    `json:"healthCheckFrequency,omitempty" yaml:"healthCheckFrequency,omitempty"`
+	HealthCheckTimeout    int                    `json:"healthCheckTimeout,omitempty" yaml:"healthCheckTimeout,omitempty"`
+	HealthyThreshold      int                    `json:"healthyThreshold,omitempty" yaml:"healthyThreshold,omitempty"`
+	UnhealthyThreshold    int                    `json:"unhealthyThreshold,omitempty" yaml:"unhealthyThreshold,omitempty"`
+	FlapThreshold         int                    `json:"flapThreshold,omitempty" yaml:"flapThreshold,omitempty"`
+	FlapWindow            int                    `json:"flapWindow,omitempty" yaml:"flapWindow,omitempty"`
+	FlapHoldDown          bool                   `json:"flapHoldDown,omitempty" yaml:"flapHoldDown,omitempty"`
+	HealthCheckMode       string                 `json:"healthCheckMode,omitempty" yaml:"healthCheckMode,omitempty"`
+	HeartbeatTTL          int                    `json:"heartbeatTTL,omitempty" yaml:"heartbeatTTL,omitempty"`
+	PanicThreshold        int                    `json:"panicThreshold,omitempty" yaml:"panicThreshold,omitempty"`
+	StickySessions        bool                   `json:"stickySessions,omitempty" yaml:"stickySessions,omitempty"`
+	HealthCheckTLS        *models.HealthCheckTLS `json:"healthCheckTLS,omitempty" yaml:"healthCheckTLS,omitempty"`
+	CertExpiryWarningDays int                    `json:"certExpiryWarningDays,omitempty" yaml:"certExpiryWarningDays,omitempty"`
+	Discovery             *models.Discovery      `json:"discovery,omitempty" yaml:"discovery,omitempty"`
+	// Static nodes; discovered nodes are added alongside them
+	Nodes []NodeConfig `json:"nodes" yaml:"nodes"`
+}
+
+// NodeConfig holds the configurable settings of a node
+type NodeConfig struct {
+	URL      string            `json:"url" yaml:"url"`
+	Weight   int               `json:"weight,omitempty" yaml:"weight,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Disabled bool              `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+}
+
+// DiscoveryTypes lists the sources nodes may be discovered from
+var DiscoveryTypes = []string{"dns", "srv", "file", "consul"}
+
+// Algorithms lists the load balancing algorithms a cluster may use
+var Algorithms = []string{"round-robin", "least-connections", "weighted-round-robin"}
+
+// FormatForPath picks the format from a file extension, defaulting to YAML
+func FormatForPath(path string) Format {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return FormatJSON
+	}
+	return FormatYAML
+}
+
+// Parse decodes and validates a configuration document. Unknown fields are
+// rejected so that typos don't silently fall back to defaults.
+func Parse(data []byte, format Format) (*File, error) {
+	var file File
+	switch format {
+	case FormatJSON:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&file); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+	case FormatYAML:
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("invalid YAML: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+
+	if err := file.Validate(); err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// Marshal encodes a configuration document
+func Marshal(file *File, format Format) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		return json.MarshalIndent(file, "", "  ")
+	case FormatYAML:
+		return yaml.Marshal(file)
+	}
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
@@ -0,0 +1,290 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/CpBruceMeena/go-balance/internal/models"
+)
+
+// Limits on cluster and node settings, shared by configuration files and
+// the admin API
+const (
+	MaxNameLength  = 100
+	MaxWeight      = 1000
+	MaxInterval    = 86400 // seconds; health check frequency and timeout, flap window and heartbeat TTL
+	MaxThreshold   = 100   // consecutive probes or health changes
+	MaxWarningDays = 365   // certificate expiry warning
+	MaxDNSName     = 253
+	MaxConsulWait  = 600 // seconds; Consul's limit on blocking queries
+)
+
+var healthCheckModes = []string{"active", "heartbeat", "both"}
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// Labels may start with an underscore so service names such as
+// _http._tcp.example.com are accepted
+var dnsNamePattern = regexp.MustCompile(`^([A-Za-z0-9_]([A-Za-z0-9_-]{0,61}[A-Za-z0-9])?\.)*[A-Za-z0-9_]([A-Za-z0-9_-]{0,61}[A-Za-z0-9])?\.?$`)
+
+// Consul service and datacenter names
+var consulNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// FieldError explains why a single field was rejected. Field is the path of
+// the field in JSON notation, such as clusters[0].nodes[1].url.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every invalid field of a document
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	problems := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		problems[i] = field.Field + ": " + field.Message
+	}
+	return strings.Join(problems, "; ")
+}
+
+// fieldErrors collects problems under a common path prefix
+type fieldErrors struct {
+	prefix string
+	errors []FieldError
+}
+
+func (e *fieldErrors) add(field, format string, args ...interface{}) {
+	e.errors = append(e.errors, FieldError{Field: e.prefix + field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (e *fieldErrors) inRange(field string, value, min, max int) {
+	if value < min || value > max {
+		e.add(field, "must be between %d and %d", min, max)
+	}
+}
+
+// Validate checks the whole document and reports every problem found as a
+// *ValidationError
+func (f *File) Validate() error {
+	var problems []FieldError
+	names := make(map[string]bool)
+	for i, cluster := range f.Clusters {
+		prefix := fmt.Sprintf("clusters[%d].", i)
+		for _, problem := range cluster.Validate() {
+			problem.Field = prefix + problem.Field
+			problems = append(problems, problem)
+		}
+		if names[cluster.Name] {
+			problems = append(problems, FieldError{Field: prefix + "name", Message: "duplicate cluster name"})
+		}
+		names[cluster.Name] = true
+	}
+	if len(problems) > 0 {
+		return &ValidationError{Fields: problems}
+	}
+	return nil
+}
+
+// Validate checks a cluster's name, settings and nodes. Field paths are
+// relative to the cluster.
+func (c *ClusterConfig) Validate() []FieldError {
+	errs := fieldErrors{}
+	if message := NameProblem(c.Name); message != "" {
+		errs.add("name", message)
+	}
+	if c.Slug != "" && !slugPattern.MatchString(c.Slug) {
+		errs.add("slug", "must be lowercase letters and digits separated by single dashes")
+	}
+	errs.errors = append(errs.errors, c.ValidateSettings(true)...)
+	if c.Discovery != nil {
+		errs.errors = append(errs.errors, ValidateDiscovery(c.Discovery)...)
+	}
+
+	urls := make(map[string]bool)
+	for i, node := range c.Nodes {
+		field := fmt.Sprintf("nodes[%d].", i)
+		if err := ValidateNodeURL(node.URL); err != nil {
+			errs.add(field+"url", "%v", err)
+		} else if urls[node.URL] {
+			errs.add(field+"url", "duplicate node URL %s", node.URL)
+		}
+		urls[node.URL] = true
+		errs.inRange(field+"weight", node.Weight, 0, MaxWeight)
+	}
+	return errs.errors
+}
+
+// ValidateSettings checks a cluster's balancing and health check settings.
+// Templates may leave the health check frequency to the clusters created
+// from them, so it is only required when requireFrequency is set.
+func (c *ClusterConfig) ValidateSettings(requireFrequency bool) []FieldError {
+	errs := fieldErrors{}
+	if c.Algorithm != "" && !contains(Algorithms, c.Algorithm) {
+		errs.add("algorithm", "must be one of %s", strings.Join(Algorithms, ", "))
+	}
+	if c.HealthCheckMode != "" && !contains(healthCheckModes, c.HealthCheckMode) {
+		errs.add("healthCheckMode", "must be one of %s", strings.Join(healthCheckModes, ", "))
+	}
+	if message := EndpointProblem(c.HealthCheckEndpoint); message != "" {
+		errs.add("healthCheckEndpoint", message)
+	}
+	minFrequency := 0
+	if requireFrequency && c.HealthCheckMode != "heartbeat" {
+		minFrequency = 1
+	}
+	errs.inRange("healthCheckFrequency", c.HealthCheckFrequency, minFrequency, MaxInterval)
+	errs.inRange("healthCheckTimeout", c.HealthCheckTimeout, 0, MaxInterval)
+	errs.inRange("healthyThreshold", c.HealthyThreshold, 0, MaxThreshold)
+	errs.inRange("unhealthyThreshold", c.UnhealthyThreshold, 0, MaxThreshold)
+	errs.inRange("flapThreshold", c.FlapThreshold, 0, MaxThreshold)
+	errs.inRange("flapWindow", c.FlapWindow, 0, MaxInterval)
+	errs.inRange("heartbeatTTL", c.HeartbeatTTL, 0, MaxInterval)
+	errs.inRange("panicThreshold", c.PanicThreshold, 0, 100)
+	errs.inRange("certExpiryWarningDays", c.CertExpiryWarningDays, 0, MaxWarningDays)
+	return errs.errors
+}
+
+// ValidateDiscovery checks discovery settings. Field paths start with
+// discovery.
+func ValidateDiscovery(d *models.Discovery) []FieldError {
+	errs := fieldErrors{prefix: "discovery."}
+	if !contains(DiscoveryTypes, d.Type) {
+		errs.add("type", "must be one of %s", strings.Join(DiscoveryTypes, ", "))
+		return errs.errors
+	}
+	if d.Type == "file" {
+		if strings.TrimSpace(d.Path) == "" {
+			errs.add("path", "is required")
+		}
+		return errs.errors
+	}
+
+	switch d.Type {
+	case "consul":
+		if len(d.Name) > MaxDNSName || !consulNamePattern.MatchString(d.Name) {
+			errs.add("name", "must be a Consul service name")
+		}
+		if d.Datacenter != "" && !consulNamePattern.MatchString(d.Datacenter) {
+			errs.add("datacenter", "must be a Consul datacenter name")
+		}
+	default:
+		if len(d.Name) > MaxDNSName || !dnsNamePattern.MatchString(d.Name) {
+			errs.add("name", "must be a DNS name")
+		}
+	}
+	switch d.Type {
+	case "dns":
+		errs.inRange("port", d.Port, 1, 65535)
+	case "srv":
+		if d.Port != 0 {
+			errs.add("port", "must not be set; SRV records carry the port")
+		}
+	case "consul":
+		if d.Port != 0 {
+			errs.add("port", "must not be set; service instances carry the port")
+		}
+	}
+	if d.Scheme != "" && d.Scheme != "http" && d.Scheme != "https" {
+		errs.add("scheme", "must be http or https")
+	}
+	switch {
+	case d.Server == "":
+	case d.Type == "consul":
+		if err := ValidateURL(d.Server); err != nil {
+			errs.add("server", "%v", err)
+		}
+	default:
+		host, port, err := net.SplitHostPort(d.Server)
+		if number, _ := strconv.Atoi(port); err != nil || host == "" || number < 1 || number > 65535 {
+			errs.add("server", "must be a host:port address")
+		}
+	}
+	errs.inRange("minTTL", d.MinTTL, 0, MaxInterval)
+	if d.Type == "consul" {
+		errs.inRange("maxTTL", d.MaxTTL, 0, MaxConsulWait)
+	} else {
+		errs.inRange("maxTTL", d.MaxTTL, 0, MaxInterval)
+	}
+	if d.MaxTTL > 0 && d.MaxTTL < d.MinTTL {
+		errs.add("maxTTL", "must not be less than minTTL")
+	}
+	return errs.errors
+}
+
+// NameProblem describes what is wrong with a cluster or template name, or
+// returns "" if it is valid
+func NameProblem(name string) string {
+	switch {
+	case strings.TrimSpace(name) == "":
+		return "is required"
+	case utf8.RuneCountInString(name) > MaxNameLength:
+		return fmt.Sprintf("must be at most %d characters", MaxNameLength)
+	case strings.IndexFunc(name, unicode.IsControl) >= 0:
+		return "must not contain control characters"
+	}
+	return ""
+}
+
+// EndpointProblem describes what is wrong with a health check endpoint, or
+// returns "" if it is empty or a valid path
+func EndpointProblem(endpoint string) string {
+	if endpoint == "" {
+		return ""
+	}
+	parsed, err := url.Parse(endpoint)
+	if err != nil || parsed.Scheme != "" || parsed.Host != "" || strings.ContainsAny(endpoint, " \t\r\n") {
+		return "must be a path such as /health"
+	}
+	return ""
+}
+
+// ValidateURL checks that a URL is an absolute http(s) URL with a host and,
+// if given, a port between 1 and 65535
+func ValidateURL(raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid URL %q: %v", raw, err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("URL %q must use http or https", raw)
+	}
+	if parsed.Hostname() == "" {
+		return fmt.Errorf("URL %q has no host", raw)
+	}
+	if port := parsed.Port(); port != "" {
+		if number, err := strconv.Atoi(port); err != nil || number < 1 || number > 65535 {
+			return fmt.Errorf("URL %q has an invalid port", raw)
+		}
+	}
+	return nil
+}
+
+// ValidateNodeURL checks a node URL. Health check endpoints are appended to
+// it, so it may not carry a query or fragment.
+func ValidateNodeURL(raw string) error {
+	if err := ValidateURL(raw); err != nil {
+		return err
+	}
+	if parsed, _ := url.Parse(raw); parsed.RawQuery != "" || parsed.Fragment != "" {
+		return fmt.Errorf("URL %q must not have a query or fragment", raw)
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"time"
+)
+
+// Watcher polls a configuration file and hands every new valid version to
+// an apply function. Invalid versions are reported and skipped, leaving the
+// previously applied configuration in place. Versions that fail to apply are
+// retried on every poll, since what they clashed with may have gone away.
+type Watcher struct {
+	path     string
+	interval time.Duration
+	apply    func(*File) error
+	onError  func(error)
+	last     []byte // content last applied
+	// Content that failed, whether it failed to parse and why, so each
+	// failure is reported once
+	rejected    []byte
+	invalid     bool
+	rejectedErr string
+	done        chan struct{}
+}
+
+// NewWatcher creates a watcher for path. onError, if set, is called with every
+// load or apply error in addition to it being logged.
+func NewWatcher(path string, interval time.Duration, apply func(*File) error, onError func(error)) *Watcher {
+	return &Watcher{
+		path:     path,
+		interval: interval,
+		apply:    apply,
+		onError:  onError,
+		done:     make(chan struct{}),
+	}
+}
+
+// Load reads, validates and applies the file once
+func (w *Watcher) Load() error {
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		return err
+	}
+	file, err := Parse(data, FormatForPath(w.path))
+	if err != nil {
+		return err
+	}
+	if err := w.apply(file); err != nil {
+		return err
+	}
+	w.last = data
+	return nil
+}
+
+// Start begins polling in the background
+func (w *Watcher) Start() {
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.poll()
+			case <-w.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends polling
+func (w *Watcher) Stop() {
+	close(w.done)
+}
+
+func (w *Watcher) poll() {
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		w.fail(err)
+		return
+	}
+	if bytes.Equal(data, w.last) {
+		return
+	}
+	seen := bytes.Equal(data, w.rejected)
+	if seen && w.invalid {
+		return
+	}
+
+	file, err := Parse(data, FormatForPath(w.path))
+	invalid := err != nil
+	if err == nil {
+		err = w.apply(file)
+	}
+	if err != nil {
+		if !seen || err.Error() != w.rejectedErr {
+			w.fail(err)
+		}
+		w.rejected, w.invalid, w.rejectedErr = data, invalid, err.Error()
+		return
+	}
+	w.last, w.rejected = data, nil
+	log.Printf("Applied configuration from %s", w.path)
+}
+
+func (w *Watcher) fail(err error) {
+	log.Printf("Rejected configuration from %s, keeping previous configuration: %v", w.path, err)
+	if w.onError != nil {
+		w.onError(err)
+	}
+}
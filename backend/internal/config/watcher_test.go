@@ -0,0 +1,79 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const watcherTestConfig = `clusters:
+  - name: web
+    healthCheckFrequency: 10
+    nodes: []
+`
+
+func TestWatcherRetriesFailedApply(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clusters.yaml")
+	if err := os.WriteFile(path, []byte(watcherTestConfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	applyErr := errors.New("clashes with a live cluster")
+	var applied, reported int
+	w := NewWatcher(path, time.Hour, func(*File) error {
+		if applyErr != nil {
+			return applyErr
+		}
+		applied++
+		return nil
+	}, func(error) {
+		reported++
+	})
+
+	w.poll()
+	w.poll()
+	if applied != 0 || reported != 1 {
+		t.Fatalf("after failing polls: applied %d, reported %d; want 0 and 1", applied, reported)
+	}
+
+	applyErr = nil
+	w.poll()
+	if applied != 1 {
+		t.Fatalf("unchanged content that failed to apply wasn't retried")
+	}
+	w.poll()
+	if applied != 1 {
+		t.Fatalf("applied content was applied again")
+	}
+}
+
+func TestWatcherSkipsInvalidContent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clusters.yaml")
+	if err := os.WriteFile(path, []byte("clusters: ["), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var applied, reported int
+	w := NewWatcher(path, time.Hour, func(*File) error {
+		applied++
+		return nil
+	}, func(error) {
+		reported++
+	})
+
+	w.poll()
+	w.poll()
+	if applied != 0 || reported != 1 {
+		t.Fatalf("invalid content: applied %d, reported %d; want 0 and 1", applied, reported)
+	}
+
+	if err := os.WriteFile(path, []byte(watcherTestConfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w.poll()
+	if applied != 1 {
+		t.Fatalf("fixed content wasn't applied")
+	}
+}
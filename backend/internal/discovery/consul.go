@@ -0,0 +1,214 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CpBruceMeena/go-balance/internal/config"
+)
+
+const (
+	DefaultConsulAddress = "http://127.0.0.1:8500"
+	DefaultConsulWait    = 5 * time.Minute
+
+	// ConsulIndexHeader carries the catalog index a response reflects
+	ConsulIndexHeader = "X-Consul-Index"
+	consulTokenHeader = "X-Consul-Token"
+
+	// Queries are spaced at least this far apart so an agent that answers
+	// blocking queries straight away isn't flooded
+	consulMinQueryInterval = time.Second
+	// Allowance on top of the wait for the response to arrive
+	consulResponseTimeout = 10 * time.Second
+	consulErrorLimit      = 512 // bytes of an error response kept
+)
+
+// consulServiceEntry is an entry of /v1/health/service/:service
+type consulServiceEntry struct {
+	Node struct {
+		Address string `json:"Address"`
+	} `json:"Node"`
+	Service struct {
+		Address string            `json:"Address"`
+		Port    int               `json:"Port"`
+		Tags    []string          `json:"Tags"`
+		Meta    map[string]string `json:"Meta"`
+	} `json:"Service"`
+}
+
+// ConsulSource follows the instances of a service in a Consul catalog whose
+// health checks are passing. After the first query it uses blocking queries,
+// so Resolve returns as soon as the instances change.
+type ConsulSource struct {
+	Address    string // agent URL; empty uses CONSUL_HTTP_ADDR or the local agent
+	Service    string
+	Tag        string // only instances with this tag, if set
+	Datacenter string // defaults to the agent's
+	Scheme     string
+	Token      string        // ACL token; empty uses CONSUL_HTTP_TOKEN
+	Wait       time.Duration // longest a blocking query waits for a change
+	RetryAfter time.Duration // delay after a failed query
+	Client     *http.Client  // defaults to http.DefaultClient
+
+	index     uint64 // of the targets last returned; 0 before the first and after failures
+	lastQuery time.Time
+}
+
+func (s *ConsulSource) Resolve(ctx context.Context) ([]Target, time.Duration, error) {
+	for {
+		if delay := time.Until(s.lastQuery.Add(consulMinQueryInterval)); delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, 0, ctx.Err()
+			case <-timer.C:
+			}
+		}
+		s.lastQuery = time.Now()
+
+		entries, index, err := s.query(ctx)
+		if err != nil {
+			// The query after a failure doesn't block, so the current
+			// instances are picked up as soon as the agent answers again
+			s.index = 0
+			return nil, s.RetryAfter, fmt.Errorf("querying Consul service %s: %w", s.Service, err)
+		}
+		unchanged := s.index > 0 && index == s.index
+		// An index going backwards means the catalog was restored or reset,
+		// so the next query starts over without blocking
+		if index < s.index {
+			index = 0
+		}
+		s.index = index
+		if unchanged {
+			// The wait ran out without a change
+			continue
+		}
+		return consulTargets(s.Scheme, entries), 0, nil
+	}
+}
+
+// query fetches the passing instances of the service, blocking until the
+// catalog index passes s.index when there is one
+func (s *ConsulSource) query(ctx context.Context) ([]consulServiceEntry, uint64, error) {
+	address := s.Address
+	if address == "" {
+		address = os.Getenv("CONSUL_HTTP_ADDR")
+	}
+	if address == "" {
+		address = DefaultConsulAddress
+	}
+	// CONSUL_HTTP_ADDR is commonly set without a scheme
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	wait := s.Wait
+	if wait <= 0 {
+		wait = DefaultConsulWait
+	}
+	if max := time.Duration(config.MaxConsulWait) * time.Second; wait > max {
+		wait = max
+	}
+
+	params := url.Values{"passing": {"true"}}
+	if s.Tag != "" {
+		params.Set("tag", s.Tag)
+	}
+	if s.Datacenter != "" {
+		params.Set("dc", s.Datacenter)
+	}
+	if s.index > 0 {
+		params.Set("index", strconv.FormatUint(s.index, 10))
+		params.Set("wait", strconv.Itoa(int(wait/time.Second))+"s")
+	}
+	endpoint := strings.TrimSuffix(address, "/") + "/v1/health/service/" + url.PathEscape(s.Service) + "?" + params.Encode()
+
+	// Consul adds up to a sixteenth of the wait as jitter
+	ctx, cancel := context.WithTimeout(ctx, wait+wait/16+consulResponseTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	token := s.Token
+	if token == "" {
+		token = os.Getenv("CONSUL_HTTP_TOKEN")
+	}
+	if token != "" {
+		req.Header.Set(consulTokenHeader, token)
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, consulErrorLimit))
+		return nil, 0, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	index, err := strconv.ParseUint(resp.Header.Get(ConsulIndexHeader), 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("response has no valid %s header", ConsulIndexHeader)
+	}
+	var entries []consulServiceEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, 0, fmt.Errorf("invalid response: %w", err)
+	}
+	return entries, index, nil
+}
+
+// consulTargets builds one target per service instance. An instance without
+// its own address uses its node's. Tags become labels, key=value tags setting
+// that label and other tags a label set to "true". A "weight" meta value sets
+// the target weight; missing or invalid values use the default.
+func consulTargets(scheme string, entries []consulServiceEntry) []Target {
+	seen := make(map[string]bool, len(entries))
+	targets := make([]Target, 0, len(entries))
+	for _, entry := range entries {
+		address := entry.Service.Address
+		if address == "" {
+			address = entry.Node.Address
+		}
+		if address == "" || entry.Service.Port < 1 || entry.Service.Port > 65535 {
+			continue
+		}
+		target := Target{URL: nodeURL(scheme, address, entry.Service.Port)}
+		if seen[target.URL] {
+			continue
+		}
+		seen[target.URL] = true
+		if weight, err := strconv.Atoi(entry.Service.Meta["weight"]); err == nil && weight > 0 {
+			target.Weight = weight
+		}
+		if len(entry.Service.Tags) > 0 {
+			target.Labels = make(map[string]string, len(entry.Service.Tags))
+			for _, tag := range entry.Service.Tags {
+				if key, value, found := strings.Cut(tag, "="); found {
+					target.Labels[key] = value
+				} else {
+					target.Labels[tag] = "true"
+				}
+			}
+		}
+		targets = append(targets, target)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].URL < targets[j].URL
+	})
+	return targets
+}
@@ -0,0 +1,237 @@
+package discovery
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// consulReply is one scripted answer of fakeConsul
+type consulReply struct {
+	status int
+	index  uint64
+	body   string
+}
+
+// fakeConsul answers health queries with its replies in order and records
+// the query parameters and token of each request
+type fakeConsul struct {
+	mu      sync.Mutex
+	replies []consulReply
+	queries []url.Values
+	tokens  []string
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.URL.Path != "/v1/health/service/web" || len(f.replies) == 0 {
+		http.Error(w, "unexpected query", http.StatusNotFound)
+		return
+	}
+	f.queries = append(f.queries, r.URL.Query())
+	f.tokens = append(f.tokens, r.Header.Get(consulTokenHeader))
+	reply := f.replies[0]
+	f.replies = f.replies[1:]
+	if reply.index > 0 {
+		w.Header().Set(ConsulIndexHeader, strconv.FormatUint(reply.index, 10))
+	}
+	if reply.status != 0 && reply.status != http.StatusOK {
+		http.Error(w, reply.body, reply.status)
+		return
+	}
+	w.Write([]byte(reply.body))
+}
+
+func (f *fakeConsul) script(replies ...consulReply) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.replies = append(f.replies, replies...)
+}
+
+// takeQueries returns the queries received since the last call
+func (f *fakeConsul) takeQueries() []url.Values {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	queries := f.queries
+	f.queries = nil
+	return queries
+}
+
+func startFakeConsul(t *testing.T) (*fakeConsul, *ConsulSource) {
+	t.Helper()
+	consul := &fakeConsul{}
+	server := httptest.NewServer(consul)
+	t.Cleanup(server.Close)
+	return consul, &ConsulSource{
+		Address:    server.URL,
+		Service:    "web",
+		Scheme:     "http",
+		Token:      "secret",
+		Wait:       30 * time.Second,
+		RetryAfter: 7 * time.Second,
+		Client:     server.Client(),
+	}
+}
+
+// resolve calls Resolve without waiting out the minimum query interval
+// since the previous call
+func resolve(t *testing.T, source *ConsulSource) ([]Target, time.Duration, error) {
+	t.Helper()
+	source.lastQuery = time.Time{}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return source.Resolve(ctx)
+}
+
+const consulOneInstance = `[{"Node":{"Address":"10.0.0.1"},"Service":{"Port":8080}}]`
+
+func TestConsulSourceBlockingQueries(t *testing.T) {
+	consul, source := startFakeConsul(t)
+	source.Tag = "primary"
+	source.Datacenter = "dc2"
+
+	consul.script(consulReply{index: 10, body: consulOneInstance})
+	targets, ttl, err := resolve(t, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl != 0 || len(targets) != 1 || targets[0].URL != "http://10.0.0.1:8080" {
+		t.Fatalf("got targets %+v and TTL %v", targets, ttl)
+	}
+	first := consul.takeQueries()[0]
+	for key, want := range map[string]string{"passing": "true", "tag": "primary", "dc": "dc2", "index": "", "wait": ""} {
+		if got := first.Get(key); got != want {
+			t.Errorf("first query: %s is %q, want %q", key, got, want)
+		}
+	}
+	if consul.tokens[0] != "secret" {
+		t.Errorf("token header is %q, want the source's token", consul.tokens[0])
+	}
+
+	// A blocking query that times out without a change is repeated until
+	// the index moves
+	consul.script(
+		consulReply{index: 10, body: consulOneInstance},
+		consulReply{index: 12, body: `[]`},
+	)
+	targets, _, err = resolve(t, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 0 {
+		t.Fatalf("got targets %+v, want the changed, empty instance list", targets)
+	}
+	queries := consul.takeQueries()
+	if len(queries) != 2 {
+		t.Fatalf("got %d queries, want 2", len(queries))
+	}
+	for _, query := range queries {
+		if query.Get("index") != "10" || query.Get("wait") != "30s" {
+			t.Errorf("blocking query has index %q and wait %q, want 10 and 30s", query.Get("index"), query.Get("wait"))
+		}
+	}
+
+	// An index going backwards is taken as a reset catalog: its instances
+	// are returned and the next query doesn't block
+	consul.script(
+		consulReply{index: 5, body: consulOneInstance},
+		consulReply{index: 6, body: consulOneInstance},
+	)
+	for i := 0; i < 2; i++ {
+		if _, _, err := resolve(t, source); err != nil {
+			t.Fatal(err)
+		}
+	}
+	queries = consul.takeQueries()
+	if queries[0].Get("index") != "12" {
+		t.Errorf("query before the reset has index %q, want 12", queries[0].Get("index"))
+	}
+	if queries[1].Has("index") || queries[1].Has("wait") {
+		t.Errorf("query after the index went backwards blocks: %v", queries[1])
+	}
+}
+
+func TestConsulSourceRetriesAfterErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply consulReply
+	}{
+		{"server error", consulReply{status: http.StatusInternalServerError, index: 11, body: "rpc error"}},
+		{"missing index", consulReply{body: consulOneInstance}},
+		{"invalid body", consulReply{index: 11, body: `{`}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			consul, source := startFakeConsul(t)
+			consul.script(consulReply{index: 10, body: consulOneInstance}, test.reply)
+			if _, _, err := resolve(t, source); err != nil {
+				t.Fatal(err)
+			}
+
+			targets, retry, err := resolve(t, source)
+			if err == nil {
+				t.Fatalf("got targets %+v, want an error", targets)
+			}
+			if retry != source.RetryAfter {
+				t.Errorf("got retry delay %v, want %v", retry, source.RetryAfter)
+			}
+
+			// The query after the failure doesn't block
+			consul.script(consulReply{index: 12, body: consulOneInstance})
+			if _, _, err := resolve(t, source); err != nil {
+				t.Fatal(err)
+			}
+			if query := consul.takeQueries()[2]; query.Has("index") {
+				t.Errorf("query after a failure blocks on index %s", query.Get("index"))
+			}
+		})
+	}
+}
+
+func TestConsulTargets(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []Target
+	}{
+		{
+			name: "service address, meta weight and tag labels",
+			body: `[{"Node":{"Address":"10.0.0.1"},"Service":{"Address":"10.1.0.1","Port":8080,"Tags":["canary","zone=eu-1"],"Meta":{"weight":"3"}}}]`,
+			want: []Target{{URL: "http://10.1.0.1:8080", Weight: 3, Labels: map[string]string{"canary": "true", "zone": "eu-1"}}},
+		},
+		{
+			name: "node address fallback and invalid weight",
+			body: `[{"Node":{"Address":"10.0.0.1"},"Service":{"Port":8080,"Meta":{"weight":"heavy"}}}]`,
+			want: []Target{{URL: "http://10.0.0.1:8080"}},
+		},
+		{
+			name: "sorted, duplicates and unusable instances dropped",
+			body: `[{"Node":{"Address":"10.0.0.2"},"Service":{"Port":8080}},
+				{"Node":{"Address":"10.0.0.1"},"Service":{"Port":8080}},
+				{"Node":{"Address":"10.0.0.2"},"Service":{"Port":8080}},
+				{"Node":{"Address":""},"Service":{"Port":8080}},
+				{"Node":{"Address":"10.0.0.3"},"Service":{"Port":0}}]`,
+			want: []Target{{URL: "http://10.0.0.1:8080"}, {URL: "http://10.0.0.2:8080"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			consul, source := startFakeConsul(t)
+			consul.script(consulReply{index: 1, body: test.body})
+			targets, _, err := resolve(t, source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(targets, test.want) {
+				t.Errorf("got %+v, want %+v", targets, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+// Package discovery finds the nodes of a cluster in external sources such
+// as DNS address and SRV records, node list files and Consul catalogs
+package discovery
+
+import (
+	"context"
+	"time"
+)
+
+// Target is a node found by a source
+type Target struct {
+	URL      string
+	Weight   int // 0 uses the default weight
+	Priority int // Failover level, lowest first
+	Labels   map[string]string
+}
+
+// Source looks up the current targets of a cluster. Resolve also returns how
+// long to wait before resolving again, including after a failure. A failed
+// lookup must not be reported as an empty target list, since that would
+// remove every discovered node.
+type Source interface {
+	Resolve(ctx context.Context) ([]Target, time.Duration, error)
+}
+
+// clampTTL bounds a record TTL to [min, max]
+func clampTTL(ttl, min, max time.Duration) time.Duration {
+	if ttl < min {
+		return min
+	}
+	if max > 0 && ttl > max {
+		return max
+	}
+	return ttl
+}
@@ -0,0 +1,407 @@
+package discovery
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DNS record types
+const (
+	TypeA    uint16 = 1
+	TypeAAAA uint16 = 28
+	TypeSRV  uint16 = 33
+)
+
+const (
+	DefaultDNSTimeout = 5 * time.Second
+	resolvConf        = "/etc/resolv.conf"
+)
+
+// ErrNoSuchName is returned for names the DNS server says don't exist
+var ErrNoSuchName = errors.New("no such DNS name")
+
+var (
+	errMalformed        = errors.New("malformed DNS response")
+	errQuestionMismatch = errors.New("DNS response doesn't answer the query")
+)
+
+// Record is a resource record from the answer to a query
+type Record struct {
+	Type uint16
+	TTL  time.Duration
+	IP   net.IP // A and AAAA records
+	// SRV records
+	Target   string
+	Port     uint16
+	Priority uint16
+	Weight   uint16
+}
+
+// DNSClient queries a DNS server directly. The system resolver hides record
+// TTLs, which discovery needs to know when to resolve again.
+type DNSClient struct {
+	Server  string // host:port; empty uses the first nameserver in /etc/resolv.conf
+	Timeout time.Duration
+}
+
+// Lookup returns the records of type qtype for name, retrying over TCP when
+// the UDP answer is truncated
+func (c *DNSClient) Lookup(ctx context.Context, name string, qtype uint16) ([]Record, error) {
+	server := c.Server
+	if server == "" {
+		server = systemNameserver()
+	}
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultDNSTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	id, err := queryID()
+	if err != nil {
+		return nil, err
+	}
+	query, err := buildQuery(id, name, qtype)
+	if err != nil {
+		return nil, err
+	}
+	response, err := exchange(ctx, "udp", server, query)
+	if err != nil {
+		return nil, err
+	}
+	records, truncated, err := parseResponse(response, id, name, qtype)
+	if err != nil || !truncated {
+		return records, err
+	}
+	if response, err = exchange(ctx, "tcp", server, query); err != nil {
+		return nil, err
+	}
+	records, _, err = parseResponse(response, id, name, qtype)
+	return records, err
+}
+
+// systemNameserver returns the first nameserver in /etc/resolv.conf, or the
+// local host if there is none
+func systemNameserver() string {
+	file, err := os.Open(resolvConf)
+	if err == nil {
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) >= 2 && fields[0] == "nameserver" {
+				return net.JoinHostPort(fields[1], "53")
+			}
+		}
+	}
+	return "127.0.0.1:53"
+}
+
+// exchange sends a query and reads the response. TCP messages carry a
+// two byte length prefix.
+func exchange(ctx context.Context, network, server string, query []byte) ([]byte, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if network == "udp" {
+		if _, err := conn.Write(query); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, 65535)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+
+	framed := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(query)), uint16(len(query)))
+	if _, err := conn.Write(append(framed, query...)); err != nil {
+		return nil, err
+	}
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	response := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// queryID picks an unpredictable query ID, which together with the question
+// check in parseResponse makes spoofed answers hard to get accepted
+func queryID() (uint16, error) {
+	var id [2]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(id[:]), nil
+}
+
+// buildQuery encodes a recursive query for a single name and type
+func buildQuery(id uint16, name string, qtype uint16) ([]byte, error) {
+	msg := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	binary.BigEndian.PutUint16(msg[2:], 0x0100) // recursion desired
+	binary.BigEndian.PutUint16(msg[4:], 1)      // one question
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" || len(label) > 63 {
+			return nil, fmt.Errorf("invalid DNS name %q", name)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	return binary.BigEndian.AppendUint16(msg, 1), nil // class IN
+}
+
+// parseResponse decodes the answer records of type qtype and reports
+// whether the response was truncated. Responses must repeat the question
+// that was asked. Other records, such as the CNAMEs leading to the answer,
+// are skipped.
+func parseResponse(msg []byte, id uint16, name string, qtype uint16) ([]Record, bool, error) {
+	if len(msg) < 12 {
+		return nil, false, errMalformed
+	}
+	if binary.BigEndian.Uint16(msg[0:]) != id {
+		return nil, false, errors.New("DNS response ID doesn't match the query")
+	}
+	flags := binary.BigEndian.Uint16(msg[2:])
+	if flags&0x8000 == 0 {
+		return nil, false, errMalformed
+	}
+	truncated := flags&0x0200 != 0
+	if binary.BigEndian.Uint16(msg[4:]) != 1 {
+		return nil, false, errQuestionMismatch
+	}
+	answers := int(binary.BigEndian.Uint16(msg[6:]))
+	question, next, err := readName(msg, 12)
+	if err != nil {
+		return nil, false, err
+	}
+	if next+4 > len(msg) {
+		return nil, false, errMalformed
+	}
+	if !strings.EqualFold(question, strings.TrimSuffix(name, ".")) ||
+		binary.BigEndian.Uint16(msg[next:]) != qtype || binary.BigEndian.Uint16(msg[next+2:]) != 1 {
+		return nil, false, errQuestionMismatch
+	}
+	offset := next + 4
+
+	switch rcode := flags & 0x000f; rcode {
+	case 0:
+	case 3:
+		return nil, false, ErrNoSuchName
+	default:
+		return nil, false, fmt.Errorf("DNS server failed with response code %d", rcode)
+	}
+
+	var records []Record
+	for i := 0; i < answers; i++ {
+		_, next, err := readName(msg, offset)
+		if err != nil {
+			return nil, false, err
+		}
+		if next+10 > len(msg) {
+			return nil, false, errMalformed
+		}
+		rrtype := binary.BigEndian.Uint16(msg[next:])
+		ttl := binary.BigEndian.Uint32(msg[next+4:])
+		length := int(binary.BigEndian.Uint16(msg[next+8:]))
+		data := next + 10
+		if data+length > len(msg) {
+			return nil, false, errMalformed
+		}
+		offset = data + length
+		if rrtype != qtype {
+			continue
+		}
+
+		record := Record{Type: rrtype, TTL: time.Duration(ttl) * time.Second}
+		switch rrtype {
+		case TypeA, TypeAAAA:
+			if (rrtype == TypeA && length != net.IPv4len) || (rrtype == TypeAAAA && length != net.IPv6len) {
+				return nil, false, errMalformed
+			}
+			record.IP = net.IP(append([]byte(nil), msg[data:data+length]...))
+		case TypeSRV:
+			if length < 7 {
+				return nil, false, errMalformed
+			}
+			record.Priority = binary.BigEndian.Uint16(msg[data:])
+			record.Weight = binary.BigEndian.Uint16(msg[data+2:])
+			record.Port = binary.BigEndian.Uint16(msg[data+4:])
+			if record.Target, _, err = readName(msg, data+6); err != nil {
+				return nil, false, err
+			}
+		}
+		records = append(records, record)
+	}
+	return records, truncated, nil
+}
+
+// readName decodes a possibly compressed name at offset, returning it and
+// the offset just past it
+func readName(msg []byte, offset int) (string, int, error) {
+	var labels []string
+	end := -1
+	for jumps := 0; ; {
+		if offset >= len(msg) {
+			return "", 0, errMalformed
+		}
+		length := int(msg[offset])
+		switch {
+		case length == 0:
+			if end < 0 {
+				end = offset + 1
+			}
+			return strings.Join(labels, "."), end, nil
+		case length&0xc0 == 0xc0:
+			if offset+1 >= len(msg) {
+				return "", 0, errMalformed
+			}
+			if end < 0 {
+				end = offset + 2
+			}
+			// Pointers may only loop back a bounded number of times
+			if jumps++; jumps > 16 {
+				return "", 0, errMalformed
+			}
+			offset = int(binary.BigEndian.Uint16(msg[offset:]) & 0x3fff)
+		case length&0xc0 != 0:
+			return "", 0, errMalformed
+		default:
+			if offset+1+length > len(msg) {
+				return "", 0, errMalformed
+			}
+			labels = append(labels, string(msg[offset+1:offset+1+length]))
+			offset += 1 + length
+		}
+	}
+}
+
+// DNSSource resolves a name's A and AAAA records to one node per address,
+// resolving again when the shortest record TTL runs out
+type DNSSource struct {
+	Client *DNSClient
+	Name   string
+	Port   int
+	Scheme string
+	// Bounds on the re-resolution interval; failed lookups are retried after MinTTL
+	MinTTL time.Duration
+	MaxTTL time.Duration
+}
+
+func (s *DNSSource) Resolve(ctx context.Context) ([]Target, time.Duration, error) {
+	var addresses []Record
+	for _, qtype := range []uint16{TypeA, TypeAAAA} {
+		records, err := s.Client.Lookup(ctx, s.Name, qtype)
+		if err != nil {
+			return nil, s.MinTTL, fmt.Errorf("resolving %s: %w", s.Name, err)
+		}
+		addresses = append(addresses, records...)
+	}
+	if len(addresses) == 0 {
+		return nil, s.MinTTL, fmt.Errorf("resolving %s: no A or AAAA records", s.Name)
+	}
+
+	ttl := addresses[0].TTL
+	seen := make(map[string]bool, len(addresses))
+	targets := make([]Target, 0, len(addresses))
+	for _, record := range addresses {
+		if record.TTL < ttl {
+			ttl = record.TTL
+		}
+		url := nodeURL(s.Scheme, record.IP.String(), s.Port)
+		if !seen[url] {
+			seen[url] = true
+			targets = append(targets, Target{URL: url})
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].URL < targets[j].URL
+	})
+	return targets, clampTTL(ttl, s.MinTTL, s.MaxTTL), nil
+}
+
+// nodeURL builds the URL of a node at host and port
+func nodeURL(scheme, host string, port int) string {
+	if scheme == "" {
+		scheme = "http"
+	}
+	return scheme + "://" + net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// SRVSource resolves a service's SRV records to one node per target. Record
+// weights become node weights and priorities failover levels.
+type SRVSource struct {
+	Client *DNSClient
+	Name   string
+	Scheme string
+	// Bounds on the re-resolution interval; failed lookups are retried after MinTTL
+	MinTTL time.Duration
+	MaxTTL time.Duration
+}
+
+func (s *SRVSource) Resolve(ctx context.Context) ([]Target, time.Duration, error) {
+	records, err := s.Client.Lookup(ctx, s.Name, TypeSRV)
+	if err != nil {
+		return nil, s.MinTTL, fmt.Errorf("resolving %s: %w", s.Name, err)
+	}
+	if len(records) == 0 {
+		return nil, s.MinTTL, fmt.Errorf("resolving %s: no SRV records", s.Name)
+	}
+
+	ttl := records[0].TTL
+	byURL := make(map[string]int, len(records))
+	targets := make([]Target, 0, len(records))
+	for _, record := range records {
+		if record.TTL < ttl {
+			ttl = record.TTL
+		}
+		// A target of "." means the service is deliberately unavailable
+		if record.Target == "" {
+			continue
+		}
+		target := Target{
+			URL:      nodeURL(s.Scheme, record.Target, int(record.Port)),
+			Weight:   int(record.Weight),
+			Priority: int(record.Priority),
+		}
+		// A target listed at several priorities is used at the most preferred one
+		if i, seen := byURL[target.URL]; seen {
+			if target.Priority < targets[i].Priority {
+				targets[i] = target
+			}
+			continue
+		}
+		byURL[target.URL] = len(targets)
+		targets = append(targets, target)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].URL < targets[j].URL
+	})
+	return targets, clampTTL(ttl, s.MinTTL, s.MaxTTL), nil
+}
@@ -0,0 +1,329 @@
+package discovery
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// dnsAnswer is a record served by fakeDNS. Its owner name is always a
+// compression pointer to the question.
+type dnsAnswer struct {
+	rrtype uint16
+	ttl    uint32
+	data   []byte
+}
+
+// dnsReply is how fakeDNS answers a query
+type dnsReply struct {
+	rcode     uint16
+	truncated bool
+	name      string // question echoed back; empty repeats the query's
+	answers   []dnsAnswer
+}
+
+type dnsHandler func(name string, qtype uint16, tcp bool) dnsReply
+
+// startFakeDNS serves handler over UDP and TCP on the same local port and
+// returns its address
+func startFakeDNS(t *testing.T, handler dnsHandler) string {
+	t.Helper()
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	if err != nil {
+		udp.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		udp.Close()
+		tcp.Close()
+	})
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := udp.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if response := fakeDNSResponse(buf[:n], handler, false); response != nil {
+				udp.WriteTo(response, addr)
+			}
+		}
+	}()
+	go func() {
+		for {
+			conn, err := tcp.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var length [2]byte
+				if _, err := io.ReadFull(conn, length[:]); err != nil {
+					return
+				}
+				query := make([]byte, binary.BigEndian.Uint16(length[:]))
+				if _, err := io.ReadFull(conn, query); err != nil {
+					return
+				}
+				response := fakeDNSResponse(query, handler, true)
+				framed := binary.BigEndian.AppendUint16(nil, uint16(len(response)))
+				conn.Write(append(framed, response...))
+			}()
+		}
+	}()
+	return udp.LocalAddr().String()
+}
+
+func fakeDNSResponse(query []byte, handler dnsHandler, tcp bool) []byte {
+	name, next, err := readName(query, 12)
+	if err != nil || next+4 > len(query) {
+		return nil
+	}
+	qtype := binary.BigEndian.Uint16(query[next:])
+	reply := handler(name, qtype, tcp)
+
+	flags := uint16(0x8180) | reply.rcode // response, recursion desired and available
+	if reply.truncated {
+		flags |= 0x0200
+	}
+	msg := binary.BigEndian.AppendUint16(nil, binary.BigEndian.Uint16(query))
+	msg = binary.BigEndian.AppendUint16(msg, flags)
+	msg = binary.BigEndian.AppendUint16(msg, 1)
+	msg = binary.BigEndian.AppendUint16(msg, uint16(len(reply.answers)))
+	msg = append(msg, 0, 0, 0, 0)
+	if reply.name != "" {
+		question, err := buildQuery(0, reply.name, qtype)
+		if err != nil {
+			return nil
+		}
+		msg = append(msg, question[12:]...)
+	} else {
+		msg = append(msg, query[12:next+4]...)
+	}
+	for _, answer := range reply.answers {
+		msg = append(msg, 0xc0, 12) // pointer to the question name
+		msg = binary.BigEndian.AppendUint16(msg, answer.rrtype)
+		msg = binary.BigEndian.AppendUint16(msg, 1)
+		msg = binary.BigEndian.AppendUint32(msg, answer.ttl)
+		msg = binary.BigEndian.AppendUint16(msg, uint16(len(answer.data)))
+		msg = append(msg, answer.data...)
+	}
+	return msg
+}
+
+func aRecord(ip string, ttl uint32) dnsAnswer {
+	return dnsAnswer{rrtype: TypeA, ttl: ttl, data: net.ParseIP(ip).To4()}
+}
+
+func aaaaRecord(ip string, ttl uint32) dnsAnswer {
+	return dnsAnswer{rrtype: TypeAAAA, ttl: ttl, data: net.ParseIP(ip).To16()}
+}
+
+// srvRecord builds an SRV record whose target is label followed by a
+// compression pointer to offset, a suffix of the question name
+func srvRecord(priority, weight, port uint16, label string, offset byte, ttl uint32) dnsAnswer {
+	data := binary.BigEndian.AppendUint16(nil, priority)
+	data = binary.BigEndian.AppendUint16(data, weight)
+	data = binary.BigEndian.AppendUint16(data, port)
+	data = append(data, byte(len(label)))
+	data = append(data, label...)
+	data = append(data, 0xc0, offset)
+	return dnsAnswer{rrtype: TypeSRV, ttl: ttl, data: data}
+}
+
+func TestDNSClientLookup(t *testing.T) {
+	server := startFakeDNS(t, func(name string, qtype uint16, tcp bool) dnsReply {
+		switch qtype {
+		case TypeA:
+			return dnsReply{answers: []dnsAnswer{
+				// Records of other types, such as a CNAME, are skipped
+				{rrtype: 5, ttl: 60, data: []byte{0xc0, 12}},
+				aRecord("10.0.0.1", 30),
+				aRecord("10.0.0.2", 60),
+			}}
+		case TypeAAAA:
+			return dnsReply{answers: []dnsAnswer{aaaaRecord("fd00::1", 45)}}
+		}
+		return dnsReply{}
+	})
+	client := &DNSClient{Server: server, Timeout: time.Second}
+
+	tests := []struct {
+		qtype uint16
+		want  []Record
+	}{
+		{TypeA, []Record{
+			{Type: TypeA, TTL: 30 * time.Second, IP: net.ParseIP("10.0.0.1").To4()},
+			{Type: TypeA, TTL: 60 * time.Second, IP: net.ParseIP("10.0.0.2").To4()},
+		}},
+		{TypeAAAA, []Record{
+			{Type: TypeAAAA, TTL: 45 * time.Second, IP: net.ParseIP("fd00::1")},
+		}},
+	}
+	for _, test := range tests {
+		records, err := client.Lookup(context.Background(), "web.example.com", test.qtype)
+		if err != nil {
+			t.Fatalf("type %d: %v", test.qtype, err)
+		}
+		if !reflect.DeepEqual(records, test.want) {
+			t.Errorf("type %d: got %+v, want %+v", test.qtype, records, test.want)
+		}
+	}
+}
+
+func TestDNSClientLookupSRV(t *testing.T) {
+	// The question _http._tcp.example.com starts at offset 12, so
+	// "example.com" starts at 12 + len("\x05_http\x04_tcp") = 23
+	server := startFakeDNS(t, func(name string, qtype uint16, tcp bool) dnsReply {
+		return dnsReply{answers: []dnsAnswer{
+			srvRecord(10, 5, 8080, "node1", 23, 300),
+			srvRecord(20, 1, 8081, "node2", 23, 120),
+		}}
+	})
+	client := &DNSClient{Server: server, Timeout: time.Second}
+
+	records, err := client.Lookup(context.Background(), "_http._tcp.example.com", TypeSRV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Record{
+		{Type: TypeSRV, TTL: 300 * time.Second, Target: "node1.example.com", Port: 8080, Priority: 10, Weight: 5},
+		{Type: TypeSRV, TTL: 120 * time.Second, Target: "node2.example.com", Port: 8081, Priority: 20, Weight: 1},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("got %+v, want %+v", records, want)
+	}
+}
+
+func TestDNSClientNoSuchName(t *testing.T) {
+	server := startFakeDNS(t, func(name string, qtype uint16, tcp bool) dnsReply {
+		return dnsReply{rcode: 3}
+	})
+	client := &DNSClient{Server: server, Timeout: time.Second}
+
+	_, err := client.Lookup(context.Background(), "missing.example.com", TypeA)
+	if !errors.Is(err, ErrNoSuchName) {
+		t.Fatalf("got %v, want ErrNoSuchName", err)
+	}
+}
+
+func TestDNSClientRetriesTruncatedAnswersOverTCP(t *testing.T) {
+	server := startFakeDNS(t, func(name string, qtype uint16, tcp bool) dnsReply {
+		if !tcp {
+			return dnsReply{truncated: true, answers: []dnsAnswer{aRecord("10.0.0.1", 30)}}
+		}
+		return dnsReply{answers: []dnsAnswer{aRecord("10.0.0.1", 30), aRecord("10.0.0.2", 30)}}
+	})
+	client := &DNSClient{Server: server, Timeout: time.Second}
+
+	records, err := client.Lookup(context.Background(), "web.example.com", TypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want the 2 of the TCP answer", len(records))
+	}
+}
+
+func TestDNSClientRejectsAnswersToOtherQuestions(t *testing.T) {
+	server := startFakeDNS(t, func(name string, qtype uint16, tcp bool) dnsReply {
+		return dnsReply{name: "evil.example.com", answers: []dnsAnswer{aRecord("10.6.6.6", 30)}}
+	})
+	client := &DNSClient{Server: server, Timeout: time.Second}
+
+	_, err := client.Lookup(context.Background(), "web.example.com", TypeA)
+	if !errors.Is(err, errQuestionMismatch) {
+		t.Fatalf("got %v, want errQuestionMismatch", err)
+	}
+}
+
+func TestReadNameRejectsPointerLoops(t *testing.T) {
+	msg := make([]byte, 14)
+	msg[12], msg[13] = 0xc0, 12 // points at itself
+	if _, _, err := readName(msg, 12); !errors.Is(err, errMalformed) {
+		t.Fatalf("got %v, want errMalformed", err)
+	}
+}
+
+func TestDNSSourceClampsTTL(t *testing.T) {
+	tests := []struct {
+		name string
+		ttl  uint32
+		want time.Duration
+	}{
+		{"below minimum", 1, 10 * time.Second},
+		{"within bounds", 60, 60 * time.Second},
+		{"above maximum", 86400, time.Hour},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := startFakeDNS(t, func(name string, qtype uint16, tcp bool) dnsReply {
+				if qtype == TypeAAAA {
+					return dnsReply{}
+				}
+				return dnsReply{answers: []dnsAnswer{aRecord("10.0.0.2", test.ttl), aRecord("10.0.0.1", test.ttl+10)}}
+			})
+			source := &DNSSource{
+				Client: &DNSClient{Server: server, Timeout: time.Second},
+				Name:   "web.example.com",
+				Port:   8080,
+				MinTTL: 10 * time.Second,
+				MaxTTL: time.Hour,
+			}
+
+			targets, ttl, err := source.Resolve(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ttl != test.want {
+				t.Errorf("got TTL %v, want %v", ttl, test.want)
+			}
+			want := []Target{{URL: "http://10.0.0.1:8080"}, {URL: "http://10.0.0.2:8080"}}
+			if !reflect.DeepEqual(targets, want) {
+				t.Errorf("got targets %+v, want %+v", targets, want)
+			}
+		})
+	}
+}
+
+func TestSRVSourceTargets(t *testing.T) {
+	server := startFakeDNS(t, func(name string, qtype uint16, tcp bool) dnsReply {
+		return dnsReply{answers: []dnsAnswer{
+			srvRecord(20, 1, 8080, "node1", 23, 300),
+			srvRecord(10, 5, 8080, "node1", 23, 300), // same target, preferred priority
+			srvRecord(10, 3, 9090, "node2", 23, 30),
+		}}
+	})
+	source := &SRVSource{
+		Client: &DNSClient{Server: server, Timeout: time.Second},
+		Name:   "_http._tcp.example.com",
+		Scheme: "https",
+		MinTTL: 5 * time.Second,
+		MaxTTL: time.Hour,
+	}
+
+	targets, ttl, err := source.Resolve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Target{
+		{URL: "https://node1.example.com:8080", Weight: 5, Priority: 10},
+		{URL: "https://node2.example.com:9090", Weight: 3, Priority: 10},
+	}
+	if !reflect.DeepEqual(targets, want) {
+		t.Errorf("got %+v, want %+v", targets, want)
+	}
+	if ttl != 30*time.Second {
+		t.Errorf("got TTL %v, want the shortest record TTL of 30s", ttl)
+	}
+}
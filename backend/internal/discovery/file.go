@@ -0,0 +1,156 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/CpBruceMeena/go-balance/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// NodeList is the document read by FileSource
+type NodeList struct {
+	Nodes []ListedNode `json:"nodes" yaml:"nodes"`
+}
+
+// ListedNode is a node in a NodeList
+type ListedNode struct {
+	URL    string            `json:"url" yaml:"url"`
+	Weight int               `json:"weight,omitempty" yaml:"weight,omitempty"`
+	Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+}
+
+// ParseNodeList decodes and validates a node list. Unknown fields are
+// rejected like in configuration files, and a document without a nodes key,
+// such as a file caught halfway through being written, is invalid. An empty
+// nodes list is valid.
+func ParseNodeList(data []byte, format config.Format) ([]Target, error) {
+	var list NodeList
+	switch format {
+	case config.FormatJSON:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&list); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+	case config.FormatYAML:
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&list); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("invalid YAML: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+	if list.Nodes == nil {
+		return nil, &config.ValidationError{Fields: []config.FieldError{{Field: "nodes", Message: "is required"}}}
+	}
+
+	var problems []config.FieldError
+	seen := make(map[string]bool, len(list.Nodes))
+	targets := make([]Target, 0, len(list.Nodes))
+	for i, node := range list.Nodes {
+		field := fmt.Sprintf("nodes[%d].", i)
+		if err := config.ValidateNodeURL(node.URL); err != nil {
+			problems = append(problems, config.FieldError{Field: field + "url", Message: err.Error()})
+		} else if seen[node.URL] {
+			problems = append(problems, config.FieldError{Field: field + "url", Message: "duplicate node URL " + node.URL})
+		}
+		seen[node.URL] = true
+		if node.Weight < 0 || node.Weight > config.MaxWeight {
+			problems = append(problems, config.FieldError{
+				Field:   field + "weight",
+				Message: fmt.Sprintf("must be between 0 and %d", config.MaxWeight),
+			})
+		}
+		targets = append(targets, Target{URL: node.URL, Weight: node.Weight, Labels: node.Labels})
+	}
+	if len(problems) > 0 {
+		return nil, &config.ValidationError{Fields: problems}
+	}
+	return targets, nil
+}
+
+// FileSource reads the nodes of a cluster from a JSON or YAML node list,
+// picked by file extension. After the first read, Resolve blocks until the
+// file changes and then stays unchanged for Debounce, so a file being
+// rewritten in several steps is only read once it is complete.
+type FileSource struct {
+	Path     string
+	Interval time.Duration // how often the file is polled
+	Debounce time.Duration
+
+	read bool
+	seen fileState
+}
+
+// fileState is what a poll found: the content, or why it couldn't be read
+type fileState struct {
+	data []byte
+	err  string
+}
+
+func (s fileState) equal(other fileState) bool {
+	return s.err == other.err && bytes.Equal(s.data, other.data)
+}
+
+func readFileState(path string) fileState {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fileState{err: err.Error()}
+	}
+	return fileState{data: data}
+}
+
+func (s *FileSource) Resolve(ctx context.Context) ([]Target, time.Duration, error) {
+	if s.read {
+		if err := s.waitForChange(ctx); err != nil {
+			return nil, 0, err
+		}
+	}
+	s.read = true
+	s.seen = readFileState(s.Path)
+	if s.seen.err != "" {
+		return nil, 0, errors.New(s.seen.err)
+	}
+	targets, err := ParseNodeList(s.seen.data, config.FormatForPath(s.Path))
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", s.Path, err)
+	}
+	return targets, 0, nil
+}
+
+// waitForChange polls until the file differs from what was last read and
+// has then stayed the same for the debounce period
+func (s *FileSource) waitForChange(ctx context.Context) error {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	var pending fileState
+	var changedAt time.Time
+	changing := false
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			current := readFileState(s.Path)
+			switch {
+			case !changing && current.equal(s.seen):
+				continue
+			case !changing || !current.equal(pending):
+				changing = true
+				pending = current
+				changedAt = now
+			}
+			if now.Sub(changedAt) >= s.Debounce {
+				return nil
+			}
+		}
+	}
+}
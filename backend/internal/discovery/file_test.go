@@ -0,0 +1,114 @@
+package discovery
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/CpBruceMeena/go-balance/internal/config"
+)
+
+func TestParseNodeList(t *testing.T) {
+	tests := []struct {
+		name   string
+		format config.Format
+		data   string
+		want   []Target
+		// Fields of a validation error, or a message of any other error
+		wantFields []string
+		wantErr    string
+	}{
+		{
+			name:   "JSON",
+			format: config.FormatJSON,
+			data:   `{"nodes": [{"url": "http://10.0.0.1:8080", "weight": 2, "labels": {"zone": "a"}}, {"url": "http://10.0.0.2:8080"}]}`,
+			want: []Target{
+				{URL: "http://10.0.0.1:8080", Weight: 2, Labels: map[string]string{"zone": "a"}},
+				{URL: "http://10.0.0.2:8080"},
+			},
+		},
+		{
+			name:   "YAML",
+			format: config.FormatYAML,
+			data:   "nodes:\n  - url: http://10.0.0.1:8080\n    weight: 2\n    labels:\n      zone: a\n",
+			want:   []Target{{URL: "http://10.0.0.1:8080", Weight: 2, Labels: map[string]string{"zone": "a"}}},
+		},
+		{
+			name:   "empty nodes list",
+			format: config.FormatYAML,
+			data:   "nodes: []\n",
+			want:   []Target{},
+		},
+		{
+			name:       "empty document",
+			format:     config.FormatJSON,
+			data:       "",
+			wantFields: []string{"nodes"},
+		},
+		{
+			name:       "missing nodes key",
+			format:     config.FormatYAML,
+			data:       "# being written\n",
+			wantFields: []string{"nodes"},
+		},
+		{
+			name:    "unknown field",
+			format:  config.FormatYAML,
+			data:    "nodes:\n  - url: http://10.0.0.1:8080\n    wieght: 2\n",
+			wantErr: "invalid YAML",
+		},
+		{
+			name:    "truncated JSON",
+			format:  config.FormatJSON,
+			data:    `{"nodes": [{"url": "http://10.0.0.1:8080"`,
+			wantErr: "invalid JSON",
+		},
+		{
+			name:   "invalid nodes",
+			format: config.FormatJSON,
+			data: `{"nodes": [
+				{"url": "http://10.0.0.1:8080"},
+				{"url": "http://10.0.0.1:8080", "weight": 1001},
+				{"url": "ftp://10.0.0.3"},
+				{"url": "http://10.0.0.4:8080/?x=1", "weight": -1}]}`,
+			wantFields: []string{"nodes[1].url", "nodes[1].weight", "nodes[2].url", "nodes[3].url", "nodes[3].weight"},
+		},
+		{
+			name:    "unsupported format",
+			format:  config.Format("toml"),
+			data:    `nodes = []`,
+			wantErr: "unsupported format",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			targets, err := ParseNodeList([]byte(test.data), test.format)
+			switch {
+			case test.wantFields != nil:
+				var validation *config.ValidationError
+				if !errors.As(err, &validation) {
+					t.Fatalf("got error %v, want a validation error", err)
+				}
+				fields := make([]string, 0, len(validation.Fields))
+				for _, field := range validation.Fields {
+					fields = append(fields, field.Field)
+				}
+				if !reflect.DeepEqual(fields, test.wantFields) {
+					t.Errorf("got invalid fields %v, want %v", fields, test.wantFields)
+				}
+			case test.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, test.wantErr)
+				}
+			default:
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(targets, test.want) {
+					t.Errorf("got %+v, want %+v", targets, test.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Type identifies the kind of state transition an event describes
+type Type string
+
+const (
+	NodeHealthy             Type = "node.healthy"
+	NodeUnhealthy           Type = "node.unhealthy"
+	NodeAdded               Type = "node.added"
+	NodeRemoved             Type = "node.removed"
+	ClusterCreated          Type = "cluster.created"
+	ClusterDeleted          Type = "cluster.deleted"
+	ClusterAlgorithmChanged Type = "cluster.algorithm_changed"
+)
+
+// Types lists every event type that can be subscribed to
+var Types = []Type{
+	NodeHealthy,
+	NodeUnhealthy,
+	NodeAdded,
+	NodeRemoved,
+	ClusterCreated,
+	ClusterDeleted,
+	ClusterAlgorithmChanged,
+}
+
+// Valid reports whether t is a known event type
+func (t Type) Valid() bool {
+	for _, known := range Types {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is a single state transition, delivered to subscribers as JSON
+type Event struct {
+	ID        string                 `json:"id"`
+	Type      Type                   `json:"type"`
+	Timestamp time.Time              `json:"timestamp"`
+	ClusterID string                 `json:"clusterId,omitempty"`
+	NodeID    string                 `json:"nodeId,omitempty"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+// New creates an event of the given type stamped with the current time
+func New(eventType Type, clusterID, nodeID string, data map[string]interface{}) Event {
+	return Event{
+		ID:        uuid.New().String(),
+		Type:      eventType,
+		Timestamp: time.Now(),
+		ClusterID: clusterID,
+		NodeID:    nodeID,
+		Data:      data,
+	}
+}
+
+// Handler receives published events
+type Handler func(Event)
+
+// Bus fans events out to subscribers. Publish never blocks the caller, so
+// it is safe to call while holding other locks.
+type Bus struct {
+	handlers []Handler
+	queue    []Event
+	wake     chan struct{}
+	mu       sync.Mutex
+}
+
+// NewBus creates a bus and starts its delivery goroutine
+func NewBus() *Bus {
+	b := &Bus{
+		wake: make(chan struct{}, 1),
+	}
+	go b.loop()
+	return b
+}
+
+// Subscribe registers a handler for every future event
+func (b *Bus) Subscribe(handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+}
+
+// Publish queues an event for delivery to all subscribers
+func (b *Bus) Publish(event Event) {
+	b.mu.Lock()
+	b.queue = append(b.queue, event)
+	b.mu.Unlock()
+
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (b *Bus) loop() {
+	for range b.wake {
+		b.mu.Lock()
+		queue := b.queue
+		b.queue = nil
+		handlers := append([]Handler(nil), b.handlers...)
+		b.mu.Unlock()
+
+		for _, event := range queue {
+			for _, handler := range handlers {
+				handler(event)
+			}
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package events
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// SignatureHeader carries the hex HMAC-SHA256 of the timestamp and the
+	// request body; see Sign
+	SignatureHeader = "X-GoBalance-Signature"
+	// TimestampHeader carries the Unix time in seconds the delivery was signed at
+	TimestampHeader = "X-GoBalance-Timestamp"
+	EventHeader     = "X-GoBalance-Event"
+	DeliveryHeader  = "X-GoBalance-Delivery"
+
+	// SignatureTolerance is how far a delivery's timestamp may be from the
+	// receiver's clock; older deliveries should be rejected as replays
+	SignatureTolerance = 5 * time.Minute
+
+	MaxDeliveryAttempts = 5
+	InitialRetryBackoff = time.Second
+	DeliveryLogSize     = 500
+
+	// DeliveryRecordKind is the history kind deliveries are kept under
+	DeliveryRecordKind = "webhook-deliveries"
+)
+
+// DeliveryHistory keeps the delivery log durably; history stores implement it
+type DeliveryHistory interface {
+	AppendRecord(kind string, at time.Time, record interface{}) error
+	Records(kind string, since, until time.Time, limit int) ([]json.RawMessage, error)
+}
+
+// Webhook is a subscriber URL that receives events as JSON POSTs
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Events    []Type    `json:"events"` // Empty subscribes to every event
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (wh *Webhook) wants(eventType Type) bool {
+	if len(wh.Events) == 0 {
+		return true
+	}
+	for _, t := range wh.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery records a single attempt to deliver an event to a webhook
+type Delivery struct {
+	ID         string    `json:"id"`
+	WebhookID  string    `json:"webhookId"`
+	EventID    string    `json:"eventId"`
+	EventType  Type      `json:"eventType"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"statusCode"`
+	Error      string    `json:"error,omitempty"`
+	Success    bool      `json:"success"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// WebhookDispatcher delivers events to registered webhooks, signing each
+// payload and retrying failed deliveries with exponential backoff. Deliveries
+// are logged to a history when there is one, and otherwise kept in memory.
+type WebhookDispatcher struct {
+	webhooks   map[string]*Webhook
+	deliveries []Delivery
+	history    DeliveryHistory
+	client     *http.Client
+	mu         sync.RWMutex
+}
+
+// NewWebhookDispatcher creates a dispatcher and subscribes it to bus
+func NewWebhookDispatcher(bus *Bus) *WebhookDispatcher {
+	d := &WebhookDispatcher{
+		webhooks: make(map[string]*Webhook),
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+	bus.Subscribe(d.dispatch)
+	return d
+}
+
+// Add registers a webhook and returns it with its generated ID
+func (d *WebhookDispatcher) Add(webhook Webhook) Webhook {
+	webhook.ID = uuid.New().String()
+	webhook.CreatedAt = time.Now()
+	if webhook.Events == nil {
+		webhook.Events = []Type{}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.webhooks[webhook.ID] = &webhook
+	return webhook
+}
+
+// Restore registers previously saved webhooks, keeping their IDs
+func (d *WebhookDispatcher) Restore(webhooks []Webhook) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := range webhooks {
+		webhook := webhooks[i]
+		if webhook.Events == nil {
+			webhook.Events = []Type{}
+		}
+		d.webhooks[webhook.ID] = &webhook
+	}
+}
+
+// UseHistory logs deliveries to history from now on
+func (d *WebhookDispatcher) UseHistory(history DeliveryHistory) {
+	d.mu.Lock()
+	d.history = history
+	d.mu.Unlock()
+}
+
+// Remove unregisters a webhook, reporting whether it existed
+func (d *WebhookDispatcher) Remove(id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, exists := d.webhooks[id]; !exists {
+		return false
+	}
+	delete(d.webhooks, id)
+	return true
+}
+
+// List returns all registered webhooks with their secrets redacted
+func (d *WebhookDispatcher) List() []Webhook {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	webhooks := make([]Webhook, 0, len(d.webhooks))
+	for _, webhook := range d.webhooks {
+		redacted := *webhook
+		redacted.Secret = ""
+		webhooks = append(webhooks, redacted)
+	}
+	return webhooks
+}
+
+// Deliveries returns the latest DeliveryLogSize deliveries, newest first,
+// optionally limited to one webhook
+func (d *WebhookDispatcher) Deliveries(webhookID string) ([]Delivery, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	logged := d.deliveries
+	if d.history != nil {
+		records, err := d.history.Records(DeliveryRecordKind, time.Time{}, time.Time{}, 0)
+		if err != nil {
+			return nil, err
+		}
+		logged = make([]Delivery, len(records))
+		for i, record := range records {
+			if err := json.Unmarshal(record, &logged[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	deliveries := make([]Delivery, 0)
+	for i := len(logged) - 1; i >= 0 && len(deliveries) < DeliveryLogSize; i-- {
+		if webhookID == "" || logged[i].WebhookID == webhookID {
+			deliveries = append(deliveries, logged[i])
+		}
+	}
+	return deliveries, nil
+}
+
+// Sign returns the hex-encoded HMAC-SHA256 of "<timestamp>.<body>" using
+// secret. Covering the timestamp lets receivers reject replayed deliveries.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature and timestamp headers of a delivery as a
+// receiver would: the signature must match and the timestamp must be within
+// SignatureTolerance of now
+func Verify(secret, signature, timestamp string, body []byte, now time.Time) bool {
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	age := now.Sub(time.Unix(signedAt, 0))
+	if age > SignatureTolerance || age < -SignatureTolerance {
+		return false
+	}
+	expected := "sha256=" + Sign(secret, signedAt, body)
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
+
+func (d *WebhookDispatcher) dispatch(event Event) {
+	d.mu.RLock()
+	targets := make([]Webhook, 0)
+	for _, webhook := range d.webhooks {
+		if webhook.wants(event.Type) {
+			targets = append(targets, *webhook)
+		}
+	}
+	d.mu.RUnlock()
+
+	for _, webhook := range targets {
+		go d.deliver(webhook, event)
+	}
+}
+
+func (d *WebhookDispatcher) deliver(webhook Webhook, event Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	backoff := InitialRetryBackoff
+	for attempt := 1; attempt <= MaxDeliveryAttempts; attempt++ {
+		statusCode, err := d.post(webhook, event, body)
+		delivery := Delivery{
+			ID:         uuid.New().String(),
+			WebhookID:  webhook.ID,
+			EventID:    event.ID,
+			EventType:  event.Type,
+			Attempt:    attempt,
+			StatusCode: statusCode,
+			Success:    err == nil,
+			Timestamp:  time.Now(),
+		}
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		d.record(delivery)
+
+		if err == nil {
+			return
+		}
+		d.mu.RLock()
+		_, stillRegistered := d.webhooks[webhook.ID]
+		d.mu.RUnlock()
+		if !stillRegistered || attempt == MaxDeliveryAttempts {
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (d *WebhookDispatcher) post(webhook Webhook, event Event, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, string(event.Type))
+	req.Header.Set(DeliveryHeader, event.ID)
+	if webhook.Secret != "" {
+		// Every attempt is signed afresh so retries stay within the tolerance
+		timestamp := time.Now().Unix()
+		req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+		req.Header.Set(SignatureHeader, "sha256="+Sign(webhook.Secret, timestamp, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func (d *WebhookDispatcher) record(delivery Delivery) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.history != nil {
+		if err := d.history.AppendRecord(DeliveryRecordKind, delivery.Timestamp, delivery); err != nil {
+			log.Printf("Failed to log delivery of event %s to webhook %s: %v", delivery.EventID, delivery.WebhookID, err)
+		}
+		return
+	}
+	d.deliveries = append(d.deliveries, delivery)
+	if len(d.deliveries) > DeliveryLogSize {
+		d.deliveries = d.deliveries[len(d.deliveries)-DeliveryLogSize:]
+	}
+}
@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/CpBruceMeena/go-balance/internal/config"
+	"github.com/CpBruceMeena/go-balance/internal/store"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// AuditLogSize bounds the entries kept in memory when no durable audit
+	// store is configured
+	AuditLogSize = 1000
+
+	auditErrorLimit = 512 // bytes of an error response kept in an entry
+)
+
+// AuditEntry records a single mutating admin API call
+type AuditEntry struct {
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Actor     string    `json:"actor"`
+	SourceIP  string    `json:"sourceIp"`
+	Method    string    `json:"method"`
+	Endpoint  string    `json:"endpoint"`
+	Route     string    `json:"route"`
+	ClusterID string    `json:"clusterId,omitempty"`
+	// Names of the clusters whose configuration the call changed
+	Clusters []string    `json:"clusters,omitempty"`
+	Status   int         `json:"status"`
+	Result   string      `json:"result"` // success or failure
+	Error    string      `json:"error,omitempty"`
+	Diff     *ConfigDiff `json:"diff,omitempty"`
+	// Configuration of the changed clusters before and after the call; a
+	// cluster is absent from Before when created and from After when deleted
+	Before map[string]config.ClusterConfig `json:"before,omitempty"`
+	After  map[string]config.ClusterConfig `json:"after,omitempty"`
+	// Set when the call only validated the change (?dryRun=true)
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// auditLog keeps audit entries in a durable history store, or in a bounded
+// in-memory buffer when there is none
+type auditLog struct {
+	mu      sync.RWMutex
+	history store.HistoryStore
+	entries []AuditEntry
+}
+
+var audit = &auditLog{}
+
+// UseHistory makes audit entries, configuration revisions and webhook
+// deliveries durable by writing them to history, for stores that keep no
+// history of their own. It must be called before UseStore so persisted
+// revisions are restored.
+func UseHistory(history store.HistoryStore) {
+	audit.mu.Lock()
+	audit.history = history
+	audit.mu.Unlock()
+
+	clusterManager.mu.Lock()
+	clusterManager.history = history
+	clusterManager.mu.Unlock()
+	clusterManager.webhooks.UseHistory(history)
+}
+
+// useDefault stores entries in history unless another store was chosen
+func (a *auditLog) useDefault(history store.HistoryStore) {
+	a.mu.Lock()
+	if a.history == nil {
+		a.history = history
+	}
+	a.mu.Unlock()
+}
+
+func (a *auditLog) append(entry AuditEntry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.history != nil {
+		if err := a.history.AppendRecord(store.KindAudit, entry.Timestamp, entry); err != nil {
+			log.Printf("Failed to write audit entry for %s %s: %v", entry.Method, entry.Endpoint, err)
+		}
+		return
+	}
+	a.entries = append(a.entries, entry)
+	if len(a.entries) > AuditLogSize {
+		a.entries = a.entries[len(a.entries)-AuditLogSize:]
+	}
+}
+
+// query returns entries within [since, until], oldest first
+func (a *auditLog) query(since, until time.Time) ([]AuditEntry, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.history == nil {
+		entries := make([]AuditEntry, 0, len(a.entries))
+		for _, entry := range a.entries {
+			if (since.IsZero() || !entry.Timestamp.Before(since)) && (until.IsZero() || !entry.Timestamp.After(until)) {
+				entries = append(entries, entry)
+			}
+		}
+		return entries, nil
+	}
+
+	records, err := a.history.Records(store.KindAudit, since, until, 0)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]AuditEntry, 0, len(records))
+	for _, record := range records {
+		var entry AuditEntry
+		if err := json.Unmarshal(record, &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// sourceIP returns the address a request came from, without its port
+func sourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// auditRecorder captures the status and error message of a response
+type auditRecorder struct {
+	http.ResponseWriter
+	status int
+	body   []byte
+}
+
+func (rec *auditRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *auditRecorder) Write(data []byte) (int, error) {
+	if rec.status >= 400 && len(rec.body) < auditErrorLimit {
+		rec.body = append(rec.body, data[:min(len(data), auditErrorLimit-len(rec.body))]...)
+	}
+	return rec.ResponseWriter.Write(data)
+}
+
+// audited wraps a mutating admin handler so every call is recorded with the
+// configuration diff it caused. The diff is taken from snapshots around the
+// call, so changes made concurrently by other calls may show up in it too.
+func (cm *ClusterManager) audited(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		before := cm.exportConfig()
+		recorder := &auditRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(recorder, r)
+		after := cm.exportConfig()
+
+		entry := AuditEntry{
+			ID:        uuid.New().String(),
+			Timestamp: time.Now(),
+			Actor:     requestAuthor(r),
+			SourceIP:  sourceIP(r),
+			Method:    r.Method,
+			Endpoint:  r.URL.Path,
+			ClusterID: mux.Vars(r)["clusterId"],
+			DryRun:    isDryRun(r),
+			Status:    recorder.status,
+			Result:    "success",
+		}
+		if route := mux.CurrentRoute(r); route != nil {
+			entry.Route, _ = route.GetPathTemplate()
+		}
+		if recorder.status >= 400 {
+			entry.Result = "failure"
+			entry.Error = string(recorder.body)
+		}
+		if diff := diffConfigs(before, after); !diff.Empty() {
+			entry.Diff = &diff
+			for _, changes := range [][]ClusterDiff{diff.Created, diff.Updated, diff.Deleted} {
+				for _, change := range changes {
+					entry.Clusters = append(entry.Clusters, change.Name)
+				}
+			}
+			entry.Before = clusterConfigsNamed(before, entry.Clusters)
+			entry.After = clusterConfigsNamed(after, entry.Clusters)
+		}
+		audit.append(entry)
+	}
+}
+
+// clusterConfigsNamed picks the named clusters out of a configuration
+func clusterConfigsNamed(file *config.File, names []string) map[string]config.ClusterConfig {
+	configs := make(map[string]config.ClusterConfig)
+	for _, cc := range file.Clusters {
+		for _, name := range names {
+			if cc.Name == name {
+				configs[name] = cc
+			}
+		}
+	}
+	return configs
+}
+
+// matchesCluster reports whether an entry concerns the cluster with the
+// given ID or name
+func (entry *AuditEntry) matchesCluster(cluster string) bool {
+	if entry.ClusterID == cluster {
+		return true
+	}
+	for _, name := range entry.Clusters {
+		if name == cluster {
+			return true
+		}
+	}
+	return false
+}
+
+// GetAuditLog lists audit entries oldest first, optionally filtered by
+// ?cluster= (ID or name), ?actor=, ?since= and ?until= (RFC 3339) and
+// limited to the latest ?limit= entries. ?format=jsonl exports them as JSON
+// lines.
+func (cm *ClusterManager) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	since, until, err := parseTimeRange(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "since and until must be RFC 3339 timestamps")
+		return
+	}
+	limit := 0
+	if value := query.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a non-negative integer")
+			return
+		}
+	}
+	format := query.Get("format")
+	if format != "" && format != "json" && format != "jsonl" {
+		writeError(w, http.StatusBadRequest, "Format must be json or jsonl")
+		return
+	}
+
+	entries, err := audit.query(since, until)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to read audit log")
+		return
+	}
+	cluster, actor := query.Get("cluster"), query.Get("actor")
+	filtered := make([]AuditEntry, 0, len(entries))
+	for i := range entries {
+		if (cluster == "" || entries[i].matchesCluster(cluster)) && (actor == "" || entries[i].Actor == actor) {
+			filtered = append(filtered, entries[i])
+		}
+	}
+	if limit > 0 && len(filtered) > limit {
+		filtered = filtered[len(filtered)-limit:]
+	}
+
+	if format == "jsonl" {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="audit.jsonl"`)
+		encoder := json.NewEncoder(w)
+		for _, entry := range filtered {
+			encoder.Encode(entry)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(filtered)
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CpBruceMeena/go-balance/internal/config"
+	"github.com/gorilla/mux"
+)
+
+type CloneClusterRequest struct {
+	Name         string `json:"name"`
+	Slug         string `json:"slug"`         // Optional, derived from the name when empty
+	IncludeNodes bool   `json:"includeNodes"` // Copy the source's nodes and their admin states
+}
+
+// CloneCluster creates a cluster with the settings of an existing one under a
+// new name. Health state, traffic statistics and slug aliases are not copied.
+func (cm *ClusterManager) CloneCluster(w http.ResponseWriter, r *http.Request) {
+	var request CloneClusterRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	request.Name = strings.TrimSpace(request.Name)
+	var errs fieldErrors
+	errs.name("name", request.Name)
+	slug := ""
+	if request.Slug != "" {
+		if slug = slugify(request.Slug); slug == "" {
+			errs.add("slug", "must contain letters or digits")
+		}
+	}
+	if errs.write(w) {
+		return
+	}
+
+	cm.mu.RLock()
+	source, exists := cm.clusters[mux.Vars(r)["clusterId"]]
+	if !exists {
+		cm.mu.RUnlock()
+		writeError(w, http.StatusNotFound, "Cluster not found")
+		return
+	}
+	cc := clusterConfigFrom(source)
+	sourceName := source.Name
+	cc.Name = request.Name
+	cc.Slug = slug
+	if !request.IncludeNodes {
+		cc.Nodes = nil
+	}
+	preview := clusterFromConfig(&cc)
+	setSlug(preview, preview.Slug, time.Now())
+	conflict := cm.clusterConflict(preview)
+	cm.mu.RUnlock()
+	if errs = cc.Validate(); errs.write(w) {
+		return
+	}
+	if conflict != nil {
+		writeError(w, http.StatusConflict, "Cluster conflicts with an existing cluster", *conflict)
+		return
+	}
+	if isDryRun(r) {
+		writeDryRun(w, preview)
+		return
+	}
+
+	file := &config.File{Clusters: []config.ClusterConfig{cc}}
+	diff, err := cm.applyConfig(file, configChange{
+		author: requestAuthor(r),
+		action: "Cloned cluster " + sourceName + " as " + request.Name,
+	})
+	if err != nil {
+		writeConfigError(w, "Failed to clone cluster", err)
+		return
+	}
+
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	clone := cm.clusterByName(request.Name)
+	// Another request created a cluster with this name first
+	if clone == nil || len(diff.Created) == 0 {
+		writeError(w, http.StatusConflict, "Cluster conflicts with an existing cluster", config.FieldError{
+			Field:   "name",
+			Message: "is already used by another cluster",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", clusterETag(clone))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(clone)
+}
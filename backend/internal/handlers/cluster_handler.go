@@ -1,33 +1,100 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/CpBruceMeena/go-balance/internal/config"
+	"github.com/CpBruceMeena/go-balance/internal/events"
+	"github.com/CpBruceMeena/go-balance/internal/loadbalancer"
 	"github.com/CpBruceMeena/go-balance/internal/models"
-	"github.com/google/uuid"
+	"github.com/CpBruceMeena/go-balance/internal/store"
 	"github.com/gorilla/mux"
 )
 
 const (
 	HealthCheckEndpoint = "/health"
+
+	DefaultHealthCheckTimeout = 5 // seconds
+	DefaultHealthyThreshold   = 2
+	DefaultUnhealthyThreshold = 3
+
+	MaxConcurrentHealthChecks = 32
+	HealthCheckJitter         = 0.1 // fraction of the health check frequency
+
+	HealthHistorySize = 100
+	DefaultFlapWindow = 600 // seconds
+
+	HealthCheckModeActive    = "active"
+	HealthCheckModeHeartbeat = "heartbeat"
+	HealthCheckModeBoth      = "both"
+	DefaultHeartbeatTTL      = 30 // seconds
+
+	ClusterHealthHealthy  = "healthy"
+	ClusterHealthDegraded = "degraded"
+	ClusterHealthCritical = "critical"
+	// Fraction of healthy nodes below which a cluster is critical
+	ClusterCriticalFraction = 0.5
+
+	DefaultCertExpiryWarningDays = 14
 )
 
 type ClusterManager struct {
 	clusters map[string]*models.Cluster
 	mu       sync.RWMutex
-	// Map to track active health check goroutines
-	healthCheckStops map[string]chan struct{}
+	// Scheduler owning every periodic node health check
+	healthScheduler *loadbalancer.HealthScheduler
+	healthChecker   *loadbalancer.HealthChecker
+	// Scheduler of registration lease expiry, apart from health checks so
+	// slow probes never hold up expiry
+	leaseScheduler *loadbalancer.HealthScheduler
+	// Checkers for clusters with custom health check TLS settings
+	healthCheckers map[string]*loadbalancer.HealthChecker
+	// Per-node health state and probe history, keyed like health checks
+	nodeHealth map[string]*nodeHealth
+	// Draining nodes being watched, keyed like health checks
+	drainWatchers map[string]bool
+	// Optional persistent storage for cluster configuration
+	store store.Store
+	// Store and history writes queued under mu
+	writes storeWriter
+	// Where configuration revisions are persisted; the store itself when it
+	// keeps history
+	history store.HistoryStore
+	// State transition events and their webhook subscribers
+	events   *events.Bus
+	webhooks *events.WebhookDispatcher
+	// Configuration snapshots taken after every change, oldest first
+	revisions []ConfigRevision
+	// Reusable cluster settings, keyed by ID
+	templates map[string]*models.ClusterTemplate
+	// Node discovery of clusters that use it, keyed by cluster ID
+	discoveries map[string]*discoveryRunner
 }
 
+var eventBus = events.NewBus()
+
 var clusterManager = &ClusterManager{
-	clusters:         make(map[string]*models.Cluster),
-	healthCheckStops: make(map[string]chan struct{}),
+	clusters:        make(map[string]*models.Cluster),
+	healthScheduler: loadbalancer.NewHealthScheduler(MaxConcurrentHealthChecks, HealthCheckJitter),
+	healthChecker:   loadbalancer.NewHealthChecker(),
+	leaseScheduler:  loadbalancer.NewHealthScheduler(MaxConcurrentLeaseChecks, 0),
+	nodeHealth:      make(map[string]*nodeHealth),
+	drainWatchers:   make(map[string]bool),
+	healthCheckers:  make(map[string]*loadbalancer.HealthChecker),
+	templates:       make(map[string]*models.ClusterTemplate),
+	discoveries:     make(map[string]*discoveryRunner),
+	events:          eventBus,
+	webhooks:        events.NewWebhookDispatcher(eventBus),
 }
 
 type AddNodeRequest struct {
@@ -36,13 +103,54 @@ type AddNodeRequest struct {
 
 type CreateClusterRequest struct {
 	Name                 string `json:"name"`
+	Slug                 string `json:"slug"`     // Optional; derived from the name when empty
+	Template             string `json:"template"` // Optional template ID or name to start from
+	Algorithm            string `json:"algorithm"`
 	HealthCheckEndpoint  string `json:"healthCheckEndpoint"`
 	HealthCheckFrequency int    `json:"healthCheckFrequency"` // Frequency in seconds
+	HealthCheckTimeout   int    `json:"healthCheckTimeout"`   // Timeout in seconds
+	HealthyThreshold     int    `json:"healthyThreshold"`
+	UnhealthyThreshold   int    `json:"unhealthyThreshold"`
+	FlapThreshold        int    `json:"flapThreshold"`
+	FlapWindow           int    `json:"flapWindow"` // Window in seconds
+	FlapHoldDown         bool   `json:"flapHoldDown"`
+	HealthCheckMode      string `json:"healthCheckMode"`
+	HeartbeatTTL         int    `json:"heartbeatTTL"`   // TTL in seconds
+	PanicThreshold       int    `json:"panicThreshold"` // Percent of healthy nodes
+	StickySessions       bool   `json:"stickySessions"`
+	// TLS settings for HTTPS health checks
+	HealthCheckTLS        *models.HealthCheckTLS `json:"healthCheckTLS"`
+	CertExpiryWarningDays int                    `json:"certExpiryWarningDays"`
+	// Optional source to discover nodes from
+	Discovery *models.Discovery `json:"discovery"`
 }
 
 type UpdateClusterRequest struct {
 	HealthCheckEndpoint  string `json:"healthCheckEndpoint"`
 	HealthCheckFrequency int    `json:"healthCheckFrequency"`
+	HealthCheckTimeout   int    `json:"healthCheckTimeout"`
+	HealthyThreshold     int    `json:"healthyThreshold"`
+	UnhealthyThreshold   int    `json:"unhealthyThreshold"`
+	HealthCheckMode      string `json:"healthCheckMode"`
+	HeartbeatTTL         int    `json:"heartbeatTTL"`
+	// Optional; nil leaves the current flap detection settings unchanged
+	FlapThreshold *int  `json:"flapThreshold"`
+	FlapWindow    *int  `json:"flapWindow"`
+	FlapHoldDown  *bool `json:"flapHoldDown"`
+	// Optional; nil leaves the current panic threshold unchanged
+	PanicThreshold *int `json:"panicThreshold"`
+	// Optional; nil leaves sticky sessions unchanged
+	StickySessions *bool `json:"stickySessions"`
+	// Optional; nil leaves the current TLS settings unchanged
+	HealthCheckTLS        *models.HealthCheckTLS `json:"healthCheckTLS"`
+	CertExpiryWarningDays int                    `json:"certExpiryWarningDays"`
+	// Optional; renaming keeps the previous slug as a temporary alias
+	Name *string `json:"name"`
+	Slug *string `json:"slug"`
+	// Optional; nil leaves discovery unchanged and an empty type turns it off
+	Discovery *models.Discovery `json:"discovery"`
+	// Version the update is based on; alternative to an If-Match header
+	ResourceVersion *int64 `json:"resourceVersion"`
 }
 
 func (cm *ClusterManager) GetClusters(w http.ResponseWriter, r *http.Request) {
@@ -58,46 +166,153 @@ func (cm *ClusterManager) GetClusters(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(clusters)
 }
 
-func slugify(name string) string {
-	name = strings.ToLower(name)
-	name = strings.ReplaceAll(name, " ", "-")
-	name = strings.ReplaceAll(name, "_", "-")
-	return name
+// clusterConfigFromRequest returns the settings of a create request in
+// configuration form, for validation
+func clusterConfigFromRequest(request *CreateClusterRequest) config.ClusterConfig {
+	return config.ClusterConfig{
+		Name:                  request.Name,
+		Algorithm:             request.Algorithm,
+		HealthCheckEndpoint:   request.HealthCheckEndpoint,
+		HealthCheckFrequency:  request.HealthCheckFrequency,
+		HealthCheckTimeout:    request.HealthCheckTimeout,
+		HealthyThreshold:      request.HealthyThreshold,
+		UnhealthyThreshold:    request.UnhealthyThreshold,
+		FlapThreshold:         request.FlapThreshold,
+		FlapWindow:            request.FlapWindow,
+		FlapHoldDown:          request.FlapHoldDown,
+		HealthCheckMode:       request.HealthCheckMode,
+		HeartbeatTTL:          request.HeartbeatTTL,
+		PanicThreshold:        request.PanicThreshold,
+		StickySessions:        request.StickySessions,
+		HealthCheckTLS:        request.HealthCheckTLS,
+		CertExpiryWarningDays: request.CertExpiryWarningDays,
+		Discovery:             request.Discovery,
+	}
 }
 
+func validAlgorithm(algorithm string) bool {
+	for _, known := range config.Algorithms {
+		if algorithm == known {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateCluster creates a cluster. With "template" set, settings missing from
+// the request are taken from that template.
 func (cm *ClusterManager) CreateCluster(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, MaxConfigSize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
 	var request CreateClusterRequest
-
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !unmarshalRequest(w, body, &request) {
 		return
 	}
 
-	// Validate health check frequency
-	if request.HealthCheckFrequency <= 0 {
-		http.Error(w, "Health check frequency must be a positive number", http.StatusBadRequest)
-		return
+	var errs fieldErrors
+	var template *models.ClusterTemplate
+	if request.Template != "" {
+		cm.mu.RLock()
+		template = cm.templateByRef(request.Template)
+		cm.mu.RUnlock()
+		if template == nil {
+			errs.add("template", "no template with this ID or name")
+		} else {
+			// Decode again over the template's settings so the request only
+			// overrides what it sets
+			request = createRequestFromTemplate(template)
+			json.Unmarshal(body, &request)
+		}
 	}
 
-	clusterNameSlug := slugify(request.Name)
-	publicEndpoint := "/api/proxy/" + clusterNameSlug
+	request.Name = strings.TrimSpace(request.Name)
+	settings := clusterConfigFromRequest(&request)
+	errs = append(errs, settings.Validate()...)
+	slug := slugify(request.Slug)
+	switch {
+	case request.Slug != "" && slug == "":
+		errs.add("slug", "must contain letters or digits")
+	case request.Slug == "":
+		if slug = slugify(request.Name); slug == "" && config.NameProblem(request.Name) == "" {
+			errs.add("name", "must contain letters or digits to derive a slug from")
+		}
+	}
+	if len(errs) > 0 {
+		errs.write(w)
+		return
+	}
+	checker, err := newHealthCheckerFor(request.HealthCheckTLS)
+	if err != nil {
+		errs.add("healthCheckTLS", "%v", err)
+		errs.write(w)
+		return
+	}
+	if request.Algorithm == "" {
+		request.Algorithm = "round-robin"
+	}
 
 	cluster := &models.Cluster{
-		ID:                   time.Now().Format("20060102150405"),
-		Name:                 request.Name,
-		Nodes:                make([]models.Node, 0),
-		Algorithm:            "round-robin",
-		HealthCheckEndpoint:  request.HealthCheckEndpoint,
-		HealthCheckFrequency: request.HealthCheckFrequency,
-		PublicEndpoint:       publicEndpoint,
+		Name:                  request.Name,
+		Nodes:                 make([]models.Node, 0),
+		Algorithm:             request.Algorithm,
+		HealthCheckEndpoint:   request.HealthCheckEndpoint,
+		HealthCheckFrequency:  request.HealthCheckFrequency,
+		HealthCheckTimeout:    request.HealthCheckTimeout,
+		HealthyThreshold:      request.HealthyThreshold,
+		UnhealthyThreshold:    request.UnhealthyThreshold,
+		FlapThreshold:         request.FlapThreshold,
+		FlapWindow:            request.FlapWindow,
+		FlapHoldDown:          request.FlapHoldDown,
+		HealthCheckMode:       request.HealthCheckMode,
+		HeartbeatTTL:          request.HeartbeatTTL,
+		PanicThreshold:        request.PanicThreshold,
+		StickySessions:        request.StickySessions,
+		HealthCheckTLS:        request.HealthCheckTLS,
+		CertExpiryWarningDays: request.CertExpiryWarningDays,
+		Discovery:             copyDiscovery(request.Discovery),
+	}
+	if template != nil {
+		cluster.Template = template.ID
 	}
+	setSlug(cluster, slug, time.Now())
+	applyHealthCheckDefaults(cluster)
+	updateClusterHealth(cluster)
 
 	cm.mu.Lock()
+	cluster.ID = cm.newClusterID()
+	conflict := cm.clusterConflict(cluster)
+	if conflict != nil || isDryRun(r) {
+		cm.mu.Unlock()
+		if checker != nil {
+			checker.Close()
+		}
+		if conflict != nil {
+			writeError(w, http.StatusConflict, "Cluster conflicts with an existing cluster", *conflict)
+		} else {
+			touchCluster(cluster)
+			writeDryRun(w, cluster)
+		}
+		return
+	}
+	touchCluster(cluster)
 	cm.clusters[cluster.ID] = cluster
+	cm.setHealthChecker(cluster.ID, checker)
+	cm.persistCluster(cluster)
+	cm.recordRevision(requestAuthor(r), "Created cluster "+cluster.Name)
+	etag, created := clusterETag(cluster), snapshotCluster(cluster)
 	cm.mu.Unlock()
+	cm.syncDiscovery()
+
+	cm.events.Publish(events.New(events.ClusterCreated, created.ID, "", map[string]interface{}{
+		"name": created.Name,
+	}))
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(cluster)
+	w.Header().Set("ETag", etag)
+	json.NewEncoder(w).Encode(&created)
 }
 
 func (cm *ClusterManager) DeleteCluster(w http.ResponseWriter, r *http.Request) {
@@ -105,13 +320,71 @@ func (cm *ClusterManager) DeleteCluster(w http.ResponseWriter, r *http.Request)
 	clusterID := vars["clusterId"]
 
 	cm.mu.Lock()
+	cluster, exists := cm.clusters[clusterID]
+	if exists && !checkClusterVersion(w, r, cluster, nil) {
+		cm.mu.Unlock()
+		return
+	}
+	if isDryRun(r) {
+		defer cm.mu.Unlock()
+		if !exists {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeDryRun(w, cluster)
+		return
+	}
 	delete(cm.clusters, clusterID)
+	cm.setHealthChecker(clusterID, nil)
+	cm.persistClusterDeletion(clusterID)
+	if exists {
+		for _, node := range cluster.Nodes {
+			delete(cm.nodeHealth, healthCheckKey(clusterID, node.ID))
+		}
+		cm.recordRevision(requestAuthor(r), "Deleted cluster "+cluster.Name)
+	}
 	cm.mu.Unlock()
 
+	if exists {
+		cm.syncDiscovery()
+		for _, node := range cluster.Nodes {
+			cm.stopNodeHealthCheck(clusterID, node.ID)
+		}
+		cm.events.Publish(events.New(events.ClusterDeleted, clusterID, "", map[string]interface{}{
+			"name": cluster.Name,
+		}))
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func (cm *ClusterManager) checkNodeHealth(nodeURL, healthCheckEndpoint string) (string, error) {
+// applyHealthCheckDefaults fills in unset health check settings
+func applyHealthCheckDefaults(cluster *models.Cluster) {
+	if cluster.HealthCheckTimeout <= 0 {
+		cluster.HealthCheckTimeout = DefaultHealthCheckTimeout
+	}
+	if cluster.HealthyThreshold <= 0 {
+		cluster.HealthyThreshold = DefaultHealthyThreshold
+	}
+	if cluster.UnhealthyThreshold <= 0 {
+		cluster.UnhealthyThreshold = DefaultUnhealthyThreshold
+	}
+	if cluster.FlapWindow <= 0 {
+		cluster.FlapWindow = DefaultFlapWindow
+	}
+	if cluster.HealthCheckMode == "" {
+		cluster.HealthCheckMode = HealthCheckModeActive
+	}
+	if cluster.HeartbeatTTL <= 0 {
+		cluster.HeartbeatTTL = DefaultHeartbeatTTL
+	}
+	if cluster.CertExpiryWarningDays <= 0 {
+		cluster.CertExpiryWarningDays = DefaultCertExpiryWarningDays
+	}
+}
+
+// healthCheckURL joins a node URL and a health check endpoint into a probe URL
+func healthCheckURL(nodeURL, healthCheckEndpoint string) string {
 	// Ensure URL is properly formatted
 	if !strings.HasPrefix(nodeURL, "http://") && !strings.HasPrefix(nodeURL, "https://") {
 		nodeURL = "http://" + nodeURL
@@ -122,67 +395,83 @@ func (cm *ClusterManager) checkNodeHealth(nodeURL, healthCheckEndpoint string) (
 		healthCheckEndpoint = "/" + healthCheckEndpoint
 	}
 
-	fullURL := nodeURL + healthCheckEndpoint
-	resp, err := http.Get(fullURL)
-	if err != nil {
-		return "unhealthy", err
-	}
-	defer resp.Body.Close()
+	return strings.TrimSuffix(nodeURL, "/") + healthCheckEndpoint
+}
 
-	if resp.StatusCode == http.StatusOK {
-		return "healthy", nil
-	}
-	return "unhealthy", nil
+// healthCheckConfig is a snapshot of the cluster settings a probe needs, so
+// probes never run while holding cm.mu
+type healthCheckConfig struct {
+	checker            *loadbalancer.HealthChecker
+	mode               string
+	endpoint           string
+	frequency          int
+	timeout            time.Duration
+	healthyThreshold   int
+	unhealthyThreshold int
+	heartbeatTTL       time.Duration
 }
 
-func (cm *ClusterManager) startNodeHealthCheck(clusterID, nodeID, nodeURL, healthCheckEndpoint string, frequency int) {
-	if frequency <= 0 {
-		return
+// healthCheckConfigFor snapshots a cluster's health check settings. Callers
+// must hold cm.mu.
+func (cm *ClusterManager) healthCheckConfigFor(cluster *models.Cluster) healthCheckConfig {
+	checker, exists := cm.healthCheckers[cluster.ID]
+	if !exists {
+		checker = cm.healthChecker
 	}
-	stopChan := make(chan struct{})
-	stopKey := fmt.Sprintf("%s-%s", clusterID, nodeID)
-
-	// Store the stop channel
-	cm.mu.Lock()
-	// If there's an existing health check, stop it first
-	if existingStop, exists := cm.healthCheckStops[stopKey]; exists {
-		close(existingStop)
+	return healthCheckConfig{
+		checker:            checker,
+		mode:               cluster.HealthCheckMode,
+		endpoint:           cluster.HealthCheckEndpoint,
+		frequency:          cluster.HealthCheckFrequency,
+		timeout:            time.Duration(cluster.HealthCheckTimeout) * time.Second,
+		healthyThreshold:   cluster.HealthyThreshold,
+		unhealthyThreshold: cluster.UnhealthyThreshold,
+		heartbeatTTL:       time.Duration(cluster.HeartbeatTTL) * time.Second,
 	}
-	cm.healthCheckStops[stopKey] = stopChan
-	cm.mu.Unlock()
+}
 
-	ticker := time.NewTicker(time.Duration(frequency) * time.Second)
-	defer ticker.Stop()
+func (cm *ClusterManager) probeNode(ctx context.Context, nodeURL string, cfg healthCheckConfig) loadbalancer.ProbeResult {
+	return cfg.checker.Probe(ctx, healthCheckURL(nodeURL, cfg.endpoint), cfg.timeout)
+}
 
-	// Perform initial health check
-	healthStatus, _ := cm.checkNodeHealth(nodeURL, healthCheckEndpoint)
-	cm.updateNodeHealthStatus(clusterID, nodeID, healthStatus)
+func healthCheckKey(clusterID, nodeID string) string {
+	return fmt.Sprintf("%s-%s", clusterID, nodeID)
+}
 
-	for {
-		select {
-		case <-ticker.C:
-			healthStatus, err := cm.checkNodeHealth(nodeURL, healthCheckEndpoint)
-			if err != nil {
-				healthStatus = "unhealthy"
+// startNodeHealthCheck schedules periodic health checks for a node, replacing
+// any checks already scheduled for it. Active probes and heartbeat expiry
+// checks are scheduled according to the cluster's health check mode.
+func (cm *ClusterManager) startNodeHealthCheck(clusterID, nodeID, nodeURL string, cfg healthCheckConfig) {
+	key := healthCheckKey(clusterID, nodeID)
+	if usesActiveChecks(cfg.mode) {
+		interval := time.Duration(cfg.frequency) * time.Second
+		cm.healthScheduler.Schedule(key, interval, func(ctx context.Context) {
+			result := cm.probeNode(ctx, nodeURL, cfg)
+			if ctx.Err() != nil {
+				// Node was removed or its checks were rescheduled mid-probe
+				return
 			}
-			cm.updateNodeHealthStatus(clusterID, nodeID, healthStatus)
-		case <-stopChan:
-			return
-		}
+			cm.updateNodeHealthStatus(clusterID, nodeID, result)
+		})
+	} else {
+		cm.healthScheduler.Unschedule(key)
+	}
+
+	if usesHeartbeats(cfg.mode) {
+		cm.scheduleHeartbeatExpiry(clusterID, nodeID, cfg.heartbeatTTL)
+	} else {
+		cm.healthScheduler.Unschedule(heartbeatKey(clusterID, nodeID))
 	}
 }
 
 func (cm *ClusterManager) stopNodeHealthCheck(clusterID, nodeID string) {
-	stopKey := fmt.Sprintf("%s-%s", clusterID, nodeID)
-	cm.mu.Lock()
-	if stopChan, exists := cm.healthCheckStops[stopKey]; exists {
-		close(stopChan)
-		delete(cm.healthCheckStops, stopKey)
-	}
-	cm.mu.Unlock()
+	cm.healthScheduler.Unschedule(healthCheckKey(clusterID, nodeID))
+	cm.healthScheduler.Unschedule(heartbeatKey(clusterID, nodeID))
 }
 
-func (cm *ClusterManager) updateNodeHealthStatus(clusterID, nodeID, healthStatus string) {
+// updateNodeHealthStatus records a probe result on the node. The node only
+// changes state once the cluster's healthy/unhealthy threshold is reached.
+func (cm *ClusterManager) updateNodeHealthStatus(clusterID, nodeID string, result loadbalancer.ProbeResult) {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
@@ -191,103 +480,244 @@ func (cm *ClusterManager) updateNodeHealthStatus(clusterID, nodeID, healthStatus
 		return
 	}
 
-	for i, node := range cluster.Nodes {
-		if node.ID == nodeID {
-			cluster.Nodes[i].HealthStatus = healthStatus
-			cluster.Nodes[i].LastChecked = time.Now()
-			cluster.Nodes[i].IsActive = healthStatus == "healthy"
-			cm.clusters[clusterID] = cluster
+	for i := range cluster.Nodes {
+		if cluster.Nodes[i].ID == nodeID {
+			cm.recordProbeResult(cluster, &cluster.Nodes[i], result)
 			break
 		}
 	}
 }
 
+// recordProbeResult applies a probe result to a node and its history.
+// Callers must hold cm.mu.
+func (cm *ClusterManager) recordProbeResult(cluster *models.Cluster, node *models.Node, result loadbalancer.ProbeResult) {
+	now := time.Now()
+	health := cm.nodeHealthFor(cluster.ID, node)
+	health.history.Add(loadbalancer.NewProbeRecord(result, now))
+
+	if !health.probed {
+		// First result for a new node decides its initial state immediately
+		health.state.Record(result.Healthy, 1, 1)
+		health.state.Healthy = result.Healthy
+		health.probed = true
+	} else {
+		health.state.Record(result.Healthy, cluster.HealthyThreshold, cluster.UnhealthyThreshold)
+	}
+
+	node.ConsecutiveSuccesses = health.state.ConsecutiveSuccesses
+	node.ConsecutiveFailures = health.state.ConsecutiveFailures
+	node.LastChecked = now
+	if !result.CertExpiry.IsZero() {
+		node.CertExpiresAt = result.CertExpiry
+	}
+	cm.refreshNodeHealth(cluster, node, health, now)
+}
+
+// refreshNodeHealth derives a node's status from its active check state,
+// heartbeat freshness and flap history, publishing an event when the node
+// becomes healthy or unhealthy. Callers must hold cm.mu.
+func (cm *ClusterManager) refreshNodeHealth(cluster *models.Cluster, node *models.Node, health *nodeHealth, now time.Time) {
+	if adminState(node) == NodeStateMaintenance {
+		// A probe or heartbeat racing the node into maintenance
+		return
+	}
+	healthy := health.state.Healthy
+	switch cluster.HealthCheckMode {
+	case HealthCheckModeHeartbeat:
+		healthy = heartbeatFresh(cluster, node, now)
+	case HealthCheckModeBoth:
+		healthy = healthy && heartbeatFresh(cluster, node, now)
+	}
+	transitioned := health.known && healthy != health.healthy
+	if transitioned {
+		health.history.AddTransition(now)
+	}
+	health.known = true
+	health.healthy = healthy
+
+	cutoff := now.Add(-time.Duration(cluster.FlapWindow) * time.Second)
+	transitions := health.history.TransitionsSince(cutoff)
+	node.Flapping = cluster.FlapThreshold > 0 && transitions >= cluster.FlapThreshold
+
+	node.IsActive = healthy && !(node.Flapping && cluster.FlapHoldDown)
+	switch {
+	case node.Flapping:
+		node.HealthStatus = "flapping"
+	case healthy && certExpiringSoon(cluster, node, now):
+		node.HealthStatus = "warning"
+	case healthy:
+		node.HealthStatus = "healthy"
+	default:
+		node.HealthStatus = "unhealthy"
+	}
+	updateClusterHealth(cluster)
+
+	if transitioned {
+		eventType := events.NodeUnhealthy
+		if healthy {
+			eventType = events.NodeHealthy
+		}
+		cm.events.Publish(events.New(eventType, cluster.ID, node.ID, map[string]interface{}{
+			"url":           node.URL,
+			"healthStatus":  node.HealthStatus,
+			"clusterHealth": cluster.HealthStatus,
+		}))
+	}
+}
+
 func (cm *ClusterManager) AddNode(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	clusterID := vars["clusterId"]
 
 	var request struct {
 		URL    string `json:"url"`
-		Weight int    `json:"weight"`
+		Weight int    `json:"weight"` // 0 uses the default weight
 	}
-
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !decodeRequest(w, r, &request) {
 		return
 	}
 
 	// Trim whitespace from the node URL
 	request.URL = strings.TrimSpace(request.URL)
+	var errs fieldErrors
+	errs.url("url", request.URL, true)
+	errs.inRange("weight", request.Weight, 0, config.MaxWeight)
+	if errs.write(w) {
+		return
+	}
 
-	cm.mu.Lock()
+	cm.mu.RLock()
 	cluster, exists := cm.clusters[clusterID]
 	if !exists {
-		cm.mu.Unlock()
-		http.Error(w, "Cluster not found", http.StatusNotFound)
+		cm.mu.RUnlock()
+		writeError(w, http.StatusNotFound, "Cluster not found")
 		return
 	}
+	if conflict := nodeURLConflict(cluster, "", request.URL); conflict != nil {
+		cm.mu.RUnlock()
+		writeError(w, http.StatusConflict, "Node conflicts with an existing node", *conflict)
+		return
+	}
+	cfg := cm.healthCheckConfigFor(cluster)
+	cm.mu.RUnlock()
 
-	node := &models.Node{
-		ID:                uuid.New().String(),
-		URL:               request.URL,
-		IsActive:          true,
-		LastChecked:       time.Now(),
-		CreatedAt:         time.Now(),
-		Weight:            request.Weight,
-		ResponseTime:      0,
-		TotalRequests:     0,
-		RequestsPerSec:    0,
-		LastRequest:       time.Time{},
-		RequestTimestamps: []time.Time{},
+	node := newNode(request.URL, request.Weight, nil)
+	// Dry runs don't probe the node, so its health is still unknown
+	if isDryRun(r) {
+		writeDryRun(w, node)
+		return
 	}
 
-	if node.Weight < 1 {
-		node.Weight = 1
+	// Perform the initial health check without holding the lock so a slow
+	// node doesn't stall every other request
+	var result loadbalancer.ProbeResult
+	if usesActiveChecks(cfg.mode) {
+		result = cm.probeNode(r.Context(), node.URL, cfg)
 	}
 
-	// Perform immediate health check
-	healthStatus, err := cm.checkNodeHealth(node.URL, cluster.HealthCheckEndpoint)
-	if err != nil {
-		healthStatus = "unhealthy"
+	cm.mu.Lock()
+	cluster, exists = cm.clusters[clusterID]
+	if !exists {
+		cm.mu.Unlock()
+		writeError(w, http.StatusNotFound, "Cluster not found")
+		return
+	}
+	// Heartbeat-only nodes start unhealthy until their first heartbeat arrives
+	if usesActiveChecks(cfg.mode) {
+		cm.recordProbeResult(cluster, node, result)
+	} else {
+		cm.refreshNodeHealth(cluster, node, cm.nodeHealthFor(clusterID, node), time.Now())
 	}
-	node.HealthStatus = healthStatus
-	node.IsActive = healthStatus == "healthy"
 
 	cluster.Nodes = append(cluster.Nodes, *node)
+	updateClusterHealth(cluster)
+	touchCluster(cluster)
 	cm.clusters[clusterID] = cluster
+	cm.persistCluster(cluster)
+	cm.recordRevision(requestAuthor(r), fmt.Sprintf("Added node %s to cluster %s", node.URL, cluster.Name))
 	cm.mu.Unlock()
 
 	// Start periodic health check for this node
-	go cm.startNodeHealthCheck(clusterID, node.ID, node.URL, cluster.HealthCheckEndpoint, cluster.HealthCheckFrequency)
+	cm.startNodeHealthCheck(clusterID, node.ID, node.URL, cfg)
+
+	cm.events.Publish(events.New(events.NodeAdded, clusterID, node.ID, map[string]interface{}{
+		"url": node.URL,
+	}))
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(node)
 }
 
+// DeleteNode removes a node immediately, or with ?drain=true drains it first
+// (waiting ?timeout= seconds for sticky sessions) and removes it afterwards
 func (cm *ClusterManager) DeleteNode(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	clusterID := vars["clusterId"]
 	nodeID := vars["nodeId"]
 
+	drain := r.URL.Query().Get("drain") == "true"
+	var errs fieldErrors
+	timeout := drainTimeoutQuery(r, &errs)
+	if drain && errs.write(w) {
+		return
+	}
+
 	cm.mu.Lock()
 	cluster, exists := cm.clusters[clusterID]
 	if !exists {
 		cm.mu.Unlock()
-		http.Error(w, "Cluster not found", http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "Cluster not found")
 		return
 	}
 
 	for i, node := range cluster.Nodes {
+		if node.ID == nodeID && managedNode(&node) {
+			cm.mu.Unlock()
+			writeError(w, http.StatusConflict, "Node "+managedNodeMessage(&node))
+			return
+		}
+		if node.ID == nodeID && isDryRun(r) {
+			cm.mu.Unlock()
+			if drain {
+				previewDrain(&node, timeout, DrainThenRemove)
+			}
+			writeDryRun(w, node)
+			return
+		}
+		if node.ID == nodeID && drain {
+			_, start := cm.changeAdminState(cluster, &cluster.Nodes[i], NodeStateDraining, timeout, DrainThenRemove)
+			touchCluster(cluster)
+			cm.persistCluster(cluster)
+			drained := cluster.Nodes[i]
+			cfg := cm.healthCheckConfigFor(cluster)
+			cm.mu.Unlock()
+			if start {
+				cm.startNodeHealthCheck(clusterID, nodeID, drained.URL, cfg)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(drained)
+			return
+		}
 		if node.ID == nodeID {
 			cluster.Nodes = append(cluster.Nodes[:i], cluster.Nodes[i+1:]...)
+			updateClusterHealth(cluster)
+			touchCluster(cluster)
+			delete(cm.nodeHealth, healthCheckKey(clusterID, nodeID))
+			cm.persistCluster(cluster)
+			cm.recordRevision(requestAuthor(r), fmt.Sprintf("Removed node %s from cluster %s", node.URL, cluster.Name))
 			cm.mu.Unlock()
+			cm.stopNodeHealthCheck(clusterID, nodeID)
+			cm.events.Publish(events.New(events.NodeRemoved, clusterID, nodeID, map[string]interface{}{
+				"url": node.URL,
+			}))
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
 	}
 	cm.mu.Unlock()
 
-	http.Error(w, "Node not found", http.StatusNotFound)
+	writeError(w, http.StatusNotFound, "Node not found")
 }
 
 func (cm *ClusterManager) CheckNodeHealth(w http.ResponseWriter, r *http.Request) {
@@ -295,47 +725,42 @@ func (cm *ClusterManager) CheckNodeHealth(w http.ResponseWriter, r *http.Request
 	clusterId := vars["clusterId"]
 	nodeId := vars["nodeId"]
 
-	cm.mu.Lock()
-	defer cm.mu.Unlock()
-
+	cm.mu.RLock()
 	cluster, exists := cm.clusters[clusterId]
 	if !exists {
-		http.Error(w, "Cluster not found", http.StatusNotFound)
+		cm.mu.RUnlock()
+		writeError(w, http.StatusNotFound, "Cluster not found")
 		return
 	}
-
-	var targetNode *models.Node
-	for i, node := range cluster.Nodes {
+	cfg := cm.healthCheckConfigFor(cluster)
+	nodeURL := ""
+	for _, node := range cluster.Nodes {
 		if node.ID == nodeId {
-			targetNode = &cluster.Nodes[i]
+			nodeURL = node.URL
 			break
 		}
 	}
+	cm.mu.RUnlock()
 
-	if targetNode == nil {
-		http.Error(w, "Node not found", http.StatusNotFound)
+	if nodeURL == "" {
+		writeError(w, http.StatusNotFound, "Node not found")
 		return
 	}
 
-	// Perform health check using the cluster's health check endpoint
-	healthCheckUrl := targetNode.URL + cluster.HealthCheckEndpoint
-	resp, err := http.Get(healthCheckUrl)
-	if err != nil {
-		targetNode.HealthStatus = "unhealthy"
-		targetNode.LastChecked = time.Now()
-		json.NewEncoder(w).Encode(targetNode)
-		return
-	}
-	defer resp.Body.Close()
+	// Perform health check using the cluster's health check settings
+	result := cm.probeNode(r.Context(), nodeURL, cfg)
+	cm.updateNodeHealthStatus(clusterId, nodeId, result)
 
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		targetNode.HealthStatus = "healthy"
-	} else {
-		targetNode.HealthStatus = "unhealthy"
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	for _, node := range cluster.Nodes {
+		if node.ID == nodeId {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(node)
+			return
+		}
 	}
-	targetNode.LastChecked = time.Now()
-
-	json.NewEncoder(w).Encode(targetNode)
+	writeError(w, http.StatusNotFound, "Node not found")
 }
 
 func (cm *ClusterManager) UpdateAlgorithm(w http.ResponseWriter, r *http.Request) {
@@ -343,11 +768,17 @@ func (cm *ClusterManager) UpdateAlgorithm(w http.ResponseWriter, r *http.Request
 	clusterID := vars["clusterId"]
 
 	var request struct {
-		Algorithm string `json:"algorithm"`
+		Algorithm       string `json:"algorithm"`
+		ResourceVersion *int64 `json:"resourceVersion"`
 	}
-
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	var errs fieldErrors
+	if !validAlgorithm(request.Algorithm) {
+		errs.add("algorithm", "must be one of %s", strings.Join(config.Algorithms, ", "))
+	}
+	if errs.write(w) {
 		return
 	}
 
@@ -355,15 +786,139 @@ func (cm *ClusterManager) UpdateAlgorithm(w http.ResponseWriter, r *http.Request
 	cluster, exists := cm.clusters[clusterID]
 	if !exists {
 		cm.mu.Unlock()
-		http.Error(w, "Cluster not found", http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "Cluster not found")
+		return
+	}
+
+	if !checkClusterVersion(w, r, cluster, request.ResourceVersion) {
+		cm.mu.Unlock()
+		return
+	}
+	// Setting the current algorithm again changes nothing, so the version
+	// clients hold stays valid
+	if request.Algorithm == cluster.Algorithm {
+		etag, current := clusterETag(cluster), snapshotCluster(cluster)
+		cm.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", etag)
+		json.NewEncoder(w).Encode(&current)
+		return
+	}
+	if isDryRun(r) {
+		preview := snapshotCluster(cluster)
+		cm.mu.Unlock()
+		preview.Algorithm = request.Algorithm
+		touchCluster(&preview)
+		writeDryRun(w, &preview)
 		return
 	}
 
+	previous := cluster.Algorithm
 	cluster.Algorithm = request.Algorithm
+	touchCluster(cluster)
+	cm.persistCluster(cluster)
+	cm.recordRevision(requestAuthor(r), fmt.Sprintf("Changed algorithm of cluster %s to %s", cluster.Name, cluster.Algorithm))
+	etag, updated := clusterETag(cluster), snapshotCluster(cluster)
 	cm.mu.Unlock()
 
+	cm.events.Publish(events.New(events.ClusterAlgorithmChanged, clusterID, "", map[string]interface{}{
+		"from": previous,
+		"to":   request.Algorithm,
+	}))
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(cluster)
+	w.Header().Set("ETag", etag)
+	json.NewEncoder(w).Encode(&updated)
+}
+
+// validate checks the fields of an update that can be judged without the
+// cluster it applies to
+func (request *UpdateClusterRequest) validate() fieldErrors {
+	var errs fieldErrors
+	if !validHealthCheckMode(request.HealthCheckMode) {
+		errs.add("healthCheckMode", "must be one of active, heartbeat or both")
+	}
+	if message := config.EndpointProblem(request.HealthCheckEndpoint); message != "" {
+		errs.add("healthCheckEndpoint", message)
+	}
+	errs.inRange("healthCheckFrequency", request.HealthCheckFrequency, 0, config.MaxInterval)
+	errs.inRange("healthCheckTimeout", request.HealthCheckTimeout, 0, config.MaxInterval)
+	errs.inRange("healthyThreshold", request.HealthyThreshold, 0, config.MaxThreshold)
+	errs.inRange("unhealthyThreshold", request.UnhealthyThreshold, 0, config.MaxThreshold)
+	errs.inRange("heartbeatTTL", request.HeartbeatTTL, 0, config.MaxInterval)
+	if request.FlapThreshold != nil {
+		errs.inRange("flapThreshold", *request.FlapThreshold, 0, config.MaxThreshold)
+	}
+	if request.FlapWindow != nil {
+		errs.inRange("flapWindow", *request.FlapWindow, 0, config.MaxInterval)
+	}
+	if request.PanicThreshold != nil {
+		errs.inRange("panicThreshold", *request.PanicThreshold, 0, 100)
+	}
+	errs.inRange("certExpiryWarningDays", request.CertExpiryWarningDays, 0, config.MaxWarningDays)
+	if request.Name != nil {
+		errs.name("name", strings.TrimSpace(*request.Name))
+	}
+	if request.Slug != nil && slugify(*request.Slug) == "" {
+		errs.add("slug", "must contain letters or digits")
+	}
+	if request.Discovery != nil && request.Discovery.Type != "" {
+		errs = append(errs, config.ValidateDiscovery(request.Discovery)...)
+	}
+	return errs
+}
+
+// applyClusterUpdate copies the settings of an update onto cluster
+func applyClusterUpdate(cluster *models.Cluster, request *UpdateClusterRequest, name, slug, mode string) {
+	if slug != cluster.Slug {
+		setSlug(cluster, slug, time.Now())
+	}
+	cluster.Name = name
+	cluster.HealthCheckEndpoint = request.HealthCheckEndpoint
+	cluster.HealthCheckFrequency = request.HealthCheckFrequency
+	cluster.HealthCheckMode = mode
+	if request.HeartbeatTTL > 0 {
+		cluster.HeartbeatTTL = request.HeartbeatTTL
+	}
+	if request.FlapThreshold != nil {
+		cluster.FlapThreshold = *request.FlapThreshold
+	}
+	if request.FlapWindow != nil {
+		cluster.FlapWindow = *request.FlapWindow
+	}
+	if request.FlapHoldDown != nil {
+		cluster.FlapHoldDown = *request.FlapHoldDown
+	}
+	if request.PanicThreshold != nil {
+		cluster.PanicThreshold = *request.PanicThreshold
+		updateClusterHealth(cluster)
+	}
+	if request.StickySessions != nil {
+		cluster.StickySessions = *request.StickySessions
+	}
+	if request.HealthCheckTLS != nil {
+		cluster.HealthCheckTLS = request.HealthCheckTLS
+	}
+	if request.CertExpiryWarningDays > 0 {
+		cluster.CertExpiryWarningDays = request.CertExpiryWarningDays
+	}
+	if request.Discovery != nil {
+		cluster.Discovery = nil
+		if request.Discovery.Type != "" {
+			cluster.Discovery = copyDiscovery(request.Discovery)
+		}
+	}
+	applyHealthCheckDefaults(cluster)
+	// Zero leaves the current timeout and thresholds unchanged
+	if request.HealthCheckTimeout > 0 {
+		cluster.HealthCheckTimeout = request.HealthCheckTimeout
+	}
+	if request.HealthyThreshold > 0 {
+		cluster.HealthyThreshold = request.HealthyThreshold
+	}
+	if request.UnhealthyThreshold > 0 {
+		cluster.UnhealthyThreshold = request.UnhealthyThreshold
+	}
 }
 
 func (cm *ClusterManager) UpdateCluster(w http.ResponseWriter, r *http.Request) {
@@ -371,47 +926,112 @@ func (cm *ClusterManager) UpdateCluster(w http.ResponseWriter, r *http.Request)
 	clusterID := vars["clusterId"]
 
 	var request UpdateClusterRequest
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !decodeRequest(w, r, &request) {
 		return
 	}
-
-	// Validate health check frequency
-	if request.HealthCheckFrequency <= 0 {
-		http.Error(w, "Health check frequency must be a positive number", http.StatusBadRequest)
+	errs := request.validate()
+	if errs.write(w) {
 		return
 	}
+	var checker *loadbalancer.HealthChecker
+	if request.HealthCheckTLS != nil {
+		var err error
+		if checker, err = newHealthCheckerFor(request.HealthCheckTLS); err != nil {
+			errs.add("healthCheckTLS", "%v", err)
+			errs.write(w)
+			return
+		}
+	}
+	closeChecker := func() {
+		if checker != nil {
+			checker.Close()
+		}
+	}
 
 	cm.mu.Lock()
 	cluster, exists := cm.clusters[clusterID]
 	if !exists {
 		cm.mu.Unlock()
-		http.Error(w, "Cluster not found", http.StatusNotFound)
+		closeChecker()
+		writeError(w, http.StatusNotFound, "Cluster not found")
 		return
 	}
 
+	if !checkClusterVersion(w, r, cluster, request.ResourceVersion) {
+		cm.mu.Unlock()
+		closeChecker()
+		return
+	}
+
+	mode := cluster.HealthCheckMode
+	if request.HealthCheckMode != "" {
+		mode = request.HealthCheckMode
+	}
+	// Validate health check frequency
+	if usesActiveChecks(mode) && request.HealthCheckFrequency <= 0 {
+		cm.mu.Unlock()
+		closeChecker()
+		errs.add("healthCheckFrequency", "must be between 1 and %d", config.MaxInterval)
+		errs.write(w)
+		return
+	}
+	name := cluster.Name
+	if request.Name != nil {
+		name = strings.TrimSpace(*request.Name)
+	}
+	slug := renamedSlug(cluster, name, request.Slug)
+	if conflict := cm.clusterConflict(&models.Cluster{ID: clusterID, Name: name, Slug: slug}); conflict != nil {
+		cm.mu.Unlock()
+		closeChecker()
+		writeError(w, http.StatusConflict, "Cluster conflicts with an existing cluster", *conflict)
+		return
+	}
+	if isDryRun(r) {
+		preview := snapshotCluster(cluster)
+		cm.mu.Unlock()
+		closeChecker()
+		applyClusterUpdate(&preview, &request, name, slug, mode)
+		touchCluster(&preview)
+		writeDryRun(w, &preview)
+		return
+	}
+	action := "Updated cluster " + cluster.Name
+	if name != cluster.Name {
+		action = fmt.Sprintf("Renamed cluster %s to %s", cluster.Name, name)
+	}
+
 	// Create a copy of nodes to avoid holding the lock while stopping health checks
 	nodes := make([]models.Node, len(cluster.Nodes))
 	copy(nodes, cluster.Nodes)
 
 	// Update cluster configuration
-	cluster.HealthCheckEndpoint = request.HealthCheckEndpoint
-	cluster.HealthCheckFrequency = request.HealthCheckFrequency
+	applyClusterUpdate(cluster, &request, name, slug, mode)
+	if request.HealthCheckTLS != nil {
+		cm.setHealthChecker(clusterID, checker)
+	}
+	cfg := cm.healthCheckConfigFor(cluster)
+	touchCluster(cluster)
 	cm.clusters[clusterID] = cluster
+	cm.persistCluster(cluster)
+	cm.recordRevision(requestAuthor(r), action)
+	etag, updated := clusterETag(cluster), snapshotCluster(cluster)
 	cm.mu.Unlock()
-
-	// Stop existing health checks (outside the lock)
-	for _, node := range nodes {
-		cm.stopNodeHealthCheck(clusterID, node.ID)
+	if request.Discovery != nil {
+		cm.syncDiscovery()
 	}
 
-	// Start new health checks with updated configuration
+	// Reschedule health checks with the updated configuration; this cancels
+	// any probe still running with the old settings
 	for _, node := range nodes {
-		go cm.startNodeHealthCheck(clusterID, node.ID, node.URL, cluster.HealthCheckEndpoint, cluster.HealthCheckFrequency)
+		if adminState(&node) == NodeStateMaintenance {
+			continue
+		}
+		cm.startNodeHealthCheck(clusterID, node.ID, node.URL, cfg)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(cluster)
+	w.Header().Set("ETag", etag)
+	json.NewEncoder(w).Encode(&updated)
 }
 
 // Add a proxy handler
@@ -420,30 +1040,57 @@ func (cm *ClusterManager) ProxyToCluster(w http.ResponseWriter, r *http.Request)
 	clusterSlug := vars["clusterSlug"]
 	rest := vars["rest"]
 
-	var targetCluster *models.Cluster
-	for _, cluster := range cm.clusters {
-		if slugify(cluster.Name) == clusterSlug {
-			targetCluster = cluster
-			break
-		}
+	// Pick the target under the lock; the configuration may be reloaded
+	// while the request is in flight
+	cm.mu.Lock()
+	targetCluster := cm.slugOwner(clusterSlug, time.Now())
+	if targetCluster == nil {
+		cm.mu.Unlock()
+		writeError(w, http.StatusNotFound, "Cluster not found")
+		return
 	}
 
-	if targetCluster == nil {
-		http.Error(w, "Cluster not found", http.StatusNotFound)
+	if targetCluster.Slug != clusterSlug {
+		// Renamed cluster; point clients at the new slug while the alias lasts
+		location := targetCluster.PublicEndpoint + "/" + rest
+		if r.URL.RawQuery != "" {
+			location += "?" + r.URL.RawQuery
+		}
+		cm.mu.Unlock()
+		http.Redirect(w, r, location, http.StatusTemporaryRedirect)
 		return
 	}
 
 	if len(targetCluster.Nodes) == 0 {
-		http.Error(w, "No nodes available in cluster", http.StatusServiceUnavailable)
+		cm.mu.Unlock()
+		writeError(w, http.StatusServiceUnavailable, "No nodes available in cluster")
 		return
 	}
 
+	// Below the panic threshold health is ignored so the remaining healthy
+	// nodes aren't overwhelmed
+	panicMode := targetCluster.PanicMode
+	level := activePriority(targetCluster, panicMode)
+	eligible := func(node *models.Node) bool {
+		return routable(node, panicMode) && node.Priority == level
+	}
+
 	// Simple round-robin: pick the next active node
 	var nodeURL string
-	var nodeIdx int
+	var nodeID string
 
-	switch targetCluster.Algorithm {
-	case "round-robin":
+	if sticky := stickyNode(r, targetCluster, time.Now()); sticky != nil {
+		nodeURL = sticky.URL
+		nodeID = sticky.ID
+	}
+	pinned := nodeURL != ""
+	stickySessions := targetCluster.StickySessions
+	publicEndpoint := targetCluster.PublicEndpoint
+
+	switch {
+	case nodeURL != "":
+		// Pinned by the sticky session cookie
+	case targetCluster.Algorithm == "round-robin":
 		// Find the next active node after the last used one
 		startIdx := 0
 		if len(targetCluster.Nodes) > 0 {
@@ -451,53 +1098,61 @@ func (cm *ClusterManager) ProxyToCluster(w http.ResponseWriter, r *http.Request)
 		}
 		for i := 0; i < len(targetCluster.Nodes); i++ {
 			idx := (startIdx + i) % len(targetCluster.Nodes)
-			if targetCluster.Nodes[idx].IsActive {
+			if eligible(&targetCluster.Nodes[idx]) {
 				nodeURL = targetCluster.Nodes[idx].URL
-				nodeIdx = idx
+				nodeID = targetCluster.Nodes[idx].ID
 				break
 			}
 		}
-	case "least-connections":
+	case targetCluster.Algorithm == "least-connections":
 		// Find the node with the least active connections
 		minConnections := -1
-		for i, node := range targetCluster.Nodes {
-			if !node.IsActive {
+		for _, node := range targetCluster.Nodes {
+			if !eligible(&node) {
 				continue
 			}
 			if minConnections == -1 || node.TotalRequests < minConnections {
 				minConnections = node.TotalRequests
 				nodeURL = node.URL
-				nodeIdx = i
+				nodeID = node.ID
 			}
 		}
-	case "weighted-round-robin":
+	case targetCluster.Algorithm == "weighted-round-robin":
 		// Find the node with the highest weight among active nodes
 		maxWeight := -1
-		for i, node := range targetCluster.Nodes {
-			if !node.IsActive {
+		for _, node := range targetCluster.Nodes {
+			if !eligible(&node) {
 				continue
 			}
 			if node.Weight > maxWeight {
 				maxWeight = node.Weight
 				nodeURL = node.URL
-				nodeIdx = i
+				nodeID = node.ID
 			}
 		}
 	default:
 		// Default to round-robin
-		for i, node := range targetCluster.Nodes {
-			if node.IsActive {
+		for _, node := range targetCluster.Nodes {
+			if eligible(&node) {
 				nodeURL = node.URL
-				nodeIdx = i
+				nodeID = node.ID
 				break
 			}
 		}
 	}
 
+	// Counted until the response has been copied so draining nodes finish
+	// long-running responses before they are taken out
+	if nodeURL != "" {
+		acquireNode(targetCluster, nodeID)
+	}
+	cm.mu.Unlock()
+
 	if nodeURL == "" {
-		http.Error(w, "No active nodes available", http.StatusServiceUnavailable)
+		writeError(w, http.StatusServiceUnavailable, "No active nodes available")
 		return
 	}
+	defer cm.releaseNode(targetCluster, nodeID)
 
 	// Proxy the request to the selected node
 	forwardPath := "/" + rest
@@ -509,9 +1164,16 @@ func (cm *ClusterManager) ProxyToCluster(w http.ResponseWriter, r *http.Request)
 		proxyURL += "?" + r.URL.RawQuery
 	}
 
+	// Upgraded connections such as WebSockets keep the node acquired until
+	// they close, so drains wait for them like for any other request
+	if isUpgrade(r) {
+		cm.proxyUpgrade(w, r, targetCluster, nodeID, proxyURL, stickySessions && !pinned, publicEndpoint)
+		return
+	}
+
 	proxyReq, err := http.NewRequest(r.Method, proxyURL, r.Body)
 	if err != nil {
-		http.Error(w, "Failed to create proxy request", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "Failed to create proxy request")
 		return
 	}
 	proxyReq.Header = r.Header
@@ -521,16 +1183,83 @@ func (cm *ClusterManager) ProxyToCluster(w http.ResponseWriter, r *http.Request)
 	resp, err := client.Do(proxyReq)
 	responseDuration := time.Since(startTime).Seconds() * 1000 // ms
 	if err != nil {
-		http.Error(w, "Failed to reach node", http.StatusBadGateway)
+		writeError(w, http.StatusBadGateway, "Failed to reach node")
 		return
 	}
 	defer resp.Body.Close()
 
-	// --- Request tracking logic ---
+	cm.recordRequest(targetCluster, nodeID, responseDuration)
+
+	for k, v := range resp.Header {
+		for _, vv := range v {
+			w.Header().Add(k, vv)
+		}
+	}
+	if stickySessions && !pinned {
+		http.SetCookie(w, stickyCookie(publicEndpoint, nodeID))
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+}
+
+// isUpgrade reports whether r asks to switch protocols, as WebSocket
+// handshakes do
+func isUpgrade(r *http.Request) bool {
+	if r.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, value := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// proxyUpgrade proxies a protocol upgrade to the node at proxyURL and then
+// relays the upgraded connection until either side closes it
+func (cm *ClusterManager) proxyUpgrade(w http.ResponseWriter, r *http.Request, targetCluster *models.Cluster, nodeID, proxyURL string, setCookie bool, publicEndpoint string) {
+	target, err := url.Parse(proxyURL)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create proxy request")
+		return
+	}
+	startTime := time.Now()
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL = target
+			req.Host = target.Host
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			cm.recordRequest(targetCluster, nodeID, time.Since(startTime).Seconds()*1000)
+			if setCookie {
+				resp.Header.Add("Set-Cookie", stickyCookie(publicEndpoint, nodeID).String())
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			writeError(w, http.StatusBadGateway, "Failed to reach node")
+		},
+	}
+	proxy.ServeHTTP(w, r)
+}
+
+// recordRequest counts a request proxied to a node that took duration
+// milliseconds to answer
+func (cm *ClusterManager) recordRequest(targetCluster *models.Cluster, nodeID string, responseDuration float64) {
 	now := time.Now()
 	cm.mu.Lock()
-	// Node-level
-	node := &targetCluster.Nodes[nodeIdx]
+	// Node-level; the node is looked up again because it may have been
+	// removed or moved while the request was proxied
+	node := &models.Node{}
+	for i := range targetCluster.Nodes {
+		if targetCluster.Nodes[i].ID == nodeID {
+			node = &targetCluster.Nodes[i]
+			break
+		}
+	}
 	node.TotalRequests++
 	node.LastRequest = now
 	node.RequestTimestamps = append(node.RequestTimestamps, now)
@@ -563,15 +1292,6 @@ func (cm *ClusterManager) ProxyToCluster(w http.ResponseWriter, r *http.Request)
 	targetCluster.RequestTimestamps = newCTimestamps
 	targetCluster.RequestsPerSec = float64(len(newCTimestamps)) / 60.0
 	cm.mu.Unlock()
-	// --- End request tracking logic ---
-
-	for k, v := range resp.Header {
-		for _, vv := range v {
-			w.Header().Add(k, vv)
-		}
-	}
-	w.WriteHeader(resp.StatusCode)
-	_, _ = io.Copy(w, resp.Body)
 }
 
 func (cm *ClusterManager) GetNodeMetrics(w http.ResponseWriter, r *http.Request) {
@@ -582,7 +1302,7 @@ func (cm *ClusterManager) GetNodeMetrics(w http.ResponseWriter, r *http.Request)
 	cluster, exists := cm.clusters[clusterID]
 	cm.mu.RUnlock()
 	if !exists {
-		http.Error(w, "Cluster not found", http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "Cluster not found")
 		return
 	}
 
@@ -625,16 +1345,103 @@ func (cm *ClusterManager) GetNodeMetrics(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(metrics)
 }
 
+type healthCheckView struct {
+	ClusterID string    `json:"clusterId"`
+	NodeID    string    `json:"nodeId"`
+	URL       string    `json:"url"`
+	Type      string    `json:"type"`     // active or heartbeat
+	Interval  int       `json:"interval"` // seconds
+	NextRun   time.Time `json:"nextRun"`
+	LastRun   time.Time `json:"lastRun"`
+	Running   bool      `json:"running"`
+}
+
+// GetHealthChecks lists every scheduled node health check and when it runs next
+func (cm *ClusterManager) GetHealthChecks(w http.ResponseWriter, r *http.Request) {
+	cm.mu.RLock()
+	checks := make([]healthCheckView, 0)
+	for _, cluster := range cm.clusters {
+		for _, node := range cluster.Nodes {
+			for checkType, key := range map[string]string{
+				HealthCheckModeActive:    healthCheckKey(cluster.ID, node.ID),
+				HealthCheckModeHeartbeat: heartbeatKey(cluster.ID, node.ID),
+			} {
+				probe, scheduled := cm.healthScheduler.Get(key)
+				if !scheduled {
+					continue
+				}
+				checks = append(checks, healthCheckView{
+					ClusterID: cluster.ID,
+					NodeID:    node.ID,
+					URL:       node.URL,
+					Type:      checkType,
+					Interval:  int(probe.Interval / time.Second),
+					NextRun:   probe.NextRun,
+					LastRun:   probe.LastRun,
+					Running:   probe.Running,
+				})
+			}
+		}
+	}
+	cm.mu.RUnlock()
+
+	sort.Slice(checks, func(i, j int) bool {
+		return checks[i].NextRun.Before(checks[j].NextRun)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(checks)
+}
+
+// RegisterClusterRoutes registers the admin API. Mutating admin calls are
+// wrapped with audited so they appear in the audit log.
 func RegisterClusterRoutes(router *mux.Router) {
 	router.HandleFunc("/api/clusters", clusterManager.GetClusters).Methods("GET")
-	router.HandleFunc("/api/clusters", clusterManager.CreateCluster).Methods("POST")
-	router.HandleFunc("/api/clusters/{clusterId}", clusterManager.DeleteCluster).Methods("DELETE")
-	router.HandleFunc("/api/clusters/{clusterId}", clusterManager.UpdateCluster).Methods("PUT")
-	router.HandleFunc("/api/clusters/{clusterId}/nodes", clusterManager.AddNode).Methods("POST")
-	router.HandleFunc("/api/clusters/{clusterId}/nodes/{nodeId}", clusterManager.DeleteNode).Methods("DELETE")
+	router.HandleFunc("/api/clusters", clusterManager.audited(clusterManager.CreateCluster)).Methods("POST")
+	router.HandleFunc("/api/clusters/{clusterId}", clusterManager.GetCluster).Methods("GET")
+	router.HandleFunc("/api/clusters/{clusterId}", clusterManager.audited(clusterManager.DeleteCluster)).Methods("DELETE")
+	router.HandleFunc("/api/clusters/{clusterId}", clusterManager.audited(clusterManager.UpdateCluster)).Methods("PUT")
+	router.HandleFunc("/api/clusters/{clusterId}/clone", clusterManager.audited(clusterManager.CloneCluster)).Methods("POST")
+	router.HandleFunc("/api/clusters/{clusterId}/status", clusterManager.GetClusterStatus).Methods("GET")
+	router.HandleFunc("/api/clusters/{clusterId}/stats/history", clusterManager.GetStatsHistory).Methods("GET")
+	router.HandleFunc("/api/clusters/{clusterId}/nodes", clusterManager.audited(clusterManager.AddNode)).Methods("POST")
+	router.HandleFunc("/api/clusters/{clusterId}/nodes:batch", clusterManager.audited(clusterManager.BatchAddNodes)).Methods("POST")
+	router.HandleFunc("/api/clusters/{clusterId}/nodes:batch", clusterManager.audited(clusterManager.BatchDeleteNodes)).Methods("DELETE")
+	router.HandleFunc("/api/clusters/{clusterId}/nodes:batch", clusterManager.audited(clusterManager.BatchUpdateNodes)).Methods("PATCH")
+	router.HandleFunc("/api/clusters/{clusterId}/nodes/{nodeId}", clusterManager.audited(clusterManager.DeleteNode)).Methods("DELETE")
+	router.HandleFunc("/api/clusters/{clusterId}/nodes/{nodeId}", clusterManager.audited(clusterManager.PatchNode)).Methods("PATCH")
 	router.HandleFunc("/api/clusters/{clusterId}/nodes/{nodeId}/health", clusterManager.CheckNodeHealth).Methods("GET")
-	router.HandleFunc("/api/clusters/{clusterId}/algorithm", clusterManager.UpdateAlgorithm).Methods("PUT")
+	router.HandleFunc("/api/clusters/{clusterId}/nodes/{nodeId}/health/history", clusterManager.GetNodeHealthHistory).Methods("GET")
+	router.HandleFunc("/api/clusters/{clusterId}/nodes/{nodeId}/heartbeat", clusterManager.Heartbeat).Methods("POST")
+	router.HandleFunc("/api/clusters/{clusterId}/heartbeat-token", clusterManager.audited(clusterManager.CreateHeartbeatToken)).Methods("POST")
+	router.HandleFunc("/api/clusters/{clusterId}/heartbeat-token", clusterManager.audited(clusterManager.DeleteHeartbeatToken)).Methods("DELETE")
+	router.HandleFunc("/api/clusters/{clusterId}/registration-token", clusterManager.audited(clusterManager.CreateRegistrationToken)).Methods("POST")
+	router.HandleFunc("/api/clusters/{clusterId}/registration-token", clusterManager.audited(clusterManager.DeleteRegistrationToken)).Methods("DELETE")
+	router.HandleFunc("/api/clusters/{clusterId}/registrations", clusterManager.audited(clusterManager.Register)).Methods("POST")
+	router.HandleFunc("/api/clusters/{clusterId}/registrations/{leaseId}", clusterManager.RenewLease).Methods("PUT")
+	router.HandleFunc("/api/clusters/{clusterId}/registrations/{leaseId}", clusterManager.audited(clusterManager.Deregister)).Methods("DELETE")
+	router.HandleFunc("/api/clusters/{clusterId}/algorithm", clusterManager.audited(clusterManager.UpdateAlgorithm)).Methods("PUT")
 	// Add the proxy route
 	router.HandleFunc("/api/proxy/{clusterSlug}/{rest:.*}", clusterManager.ProxyToCluster)
 	router.HandleFunc("/api/clusters/{clusterId}/nodes/metrics", clusterManager.GetNodeMetrics).Methods("GET")
+	// Registered after nodes/metrics so that route isn't taken for a node ID
+	router.HandleFunc("/api/clusters/{clusterId}/nodes/{nodeId}", clusterManager.GetNode).Methods("GET")
+	router.HandleFunc("/api/healthchecks", clusterManager.GetHealthChecks).Methods("GET")
+	router.HandleFunc("/api/audit", clusterManager.GetAuditLog).Methods("GET")
+	router.HandleFunc("/api/config/status", clusterManager.GetConfigStatus).Methods("GET")
+	router.HandleFunc("/api/config/export", clusterManager.ExportConfig).Methods("GET")
+	router.HandleFunc("/api/config/import", clusterManager.audited(clusterManager.ImportConfig)).Methods("POST")
+	router.HandleFunc("/api/config/revisions", clusterManager.GetConfigRevisions).Methods("GET")
+	router.HandleFunc("/api/config/revisions/{revision}", clusterManager.GetConfigRevision).Methods("GET")
+	router.HandleFunc("/api/config/revisions/{revision}/diff", clusterManager.DiffConfigRevisions).Methods("GET")
+	router.HandleFunc("/api/config/revisions/{revision}/rollback", clusterManager.audited(clusterManager.RollbackConfigRevision)).Methods("POST")
+	router.HandleFunc("/api/templates", clusterManager.GetTemplates).Methods("GET")
+	router.HandleFunc("/api/templates", clusterManager.audited(clusterManager.CreateTemplate)).Methods("POST")
+	router.HandleFunc("/api/templates/{templateId}", clusterManager.GetTemplate).Methods("GET")
+	router.HandleFunc("/api/templates/{templateId}", clusterManager.audited(clusterManager.UpdateTemplate)).Methods("PUT")
+	router.HandleFunc("/api/templates/{templateId}", clusterManager.audited(clusterManager.DeleteTemplate)).Methods("DELETE")
+	router.HandleFunc("/api/webhooks", clusterManager.GetWebhooks).Methods("GET")
+	router.HandleFunc("/api/webhooks", clusterManager.audited(clusterManager.CreateWebhook)).Methods("POST")
+	router.HandleFunc("/api/webhooks/deliveries", clusterManager.GetWebhookDeliveries).Methods("GET")
+	router.HandleFunc("/api/webhooks/{webhookId}", clusterManager.audited(clusterManager.DeleteWebhook)).Methods("DELETE")
 }
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/CpBruceMeena/go-balance/internal/models"
+	"github.com/gorilla/mux"
+)
+
+type clusterStatusResponse struct {
+	ClusterID       string  `json:"clusterId"`
+	Status          string  `json:"status"`
+	HealthyNodes    int     `json:"healthyNodes"`
+	EnabledNodes    int     `json:"enabledNodes"` // in rotation; the healthy fraction is of these
+	TotalNodes      int     `json:"totalNodes"`
+	HealthyFraction float64 `json:"healthyFraction"`
+	PanicMode       bool    `json:"panicMode"`
+	// Set for clusters that discover their nodes
+	Discovery *DiscoveryStatus `json:"discovery,omitempty"`
+}
+
+func healthyNodeCount(cluster *models.Cluster) int {
+	healthy := 0
+	for _, node := range cluster.Nodes {
+		if node.IsActive && adminState(&node) == NodeStateActive {
+			healthy++
+		}
+	}
+	return healthy
+}
+
+// enabledNodeCount counts the nodes in rotation; draining nodes and nodes in
+// maintenance don't count against cluster health
+func enabledNodeCount(cluster *models.Cluster) int {
+	enabled := 0
+	for _, node := range cluster.Nodes {
+		if adminState(&node) == NodeStateActive {
+			enabled++
+		}
+	}
+	return enabled
+}
+
+func healthyFraction(cluster *models.Cluster) float64 {
+	enabled := enabledNodeCount(cluster)
+	if enabled == 0 {
+		return 0
+	}
+	return float64(healthyNodeCount(cluster)) / float64(enabled)
+}
+
+// updateClusterHealth recomputes the cluster's aggregate health and whether it
+// is in panic mode. Callers must hold cm.mu.
+func updateClusterHealth(cluster *models.Cluster) {
+	fraction := healthyFraction(cluster)
+	switch {
+	case enabledNodeCount(cluster) > 0 && fraction == 1:
+		cluster.HealthStatus = ClusterHealthHealthy
+	case fraction >= ClusterCriticalFraction:
+		cluster.HealthStatus = ClusterHealthDegraded
+	default:
+		cluster.HealthStatus = ClusterHealthCritical
+	}
+	cluster.PanicMode = cluster.PanicThreshold > 0 && enabledNodeCount(cluster) > 0 &&
+		fraction*100 < float64(cluster.PanicThreshold)
+}
+
+// routable reports whether a node may receive new traffic. In panic mode
+// every active node is eligible regardless of health.
+func routable(node *models.Node, panicMode bool) bool {
+	return adminState(node) == NodeStateActive && (node.IsActive || panicMode)
+}
+
+// activePriority returns the lowest priority level with a routable node;
+// nodes at higher levels are standbys until every node below them is out of
+// rotation. Callers must hold cm.mu.
+func activePriority(cluster *models.Cluster, panicMode bool) int {
+	level, found := 0, false
+	for i := range cluster.Nodes {
+		node := &cluster.Nodes[i]
+		if routable(node, panicMode) && (!found || node.Priority < level) {
+			level, found = node.Priority, true
+		}
+	}
+	return level
+}
+
+// GetClusterStatus reports aggregate cluster health, answering 503 when the
+// cluster is critical so external monitors can use the status code alone
+func (cm *ClusterManager) GetClusterStatus(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	clusterID := vars["clusterId"]
+
+	cm.mu.RLock()
+	cluster, exists := cm.clusters[clusterID]
+	if !exists {
+		cm.mu.RUnlock()
+		writeError(w, http.StatusNotFound, "Cluster not found")
+		return
+	}
+	status := clusterStatusResponse{
+		ClusterID:       cluster.ID,
+		Status:          cluster.HealthStatus,
+		HealthyNodes:    healthyNodeCount(cluster),
+		EnabledNodes:    enabledNodeCount(cluster),
+		TotalNodes:      len(cluster.Nodes),
+		HealthyFraction: healthyFraction(cluster),
+		PanicMode:       cluster.PanicMode,
+		Discovery:       cm.discoveryStatus(clusterID),
+	}
+	cm.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if status.Status == ClusterHealthCritical {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/CpBruceMeena/go-balance/internal/models"
+	"github.com/gorilla/mux"
+)
+
+func TestGetClusterStatusCountsEnabledNodes(t *testing.T) {
+	cluster := &models.Cluster{
+		ID: "1",
+		Nodes: []models.Node{
+			{ID: "a", IsActive: true, AdminState: NodeStateActive},
+			{ID: "b", IsActive: true, AdminState: NodeStateActive},
+			{ID: "c", AdminState: NodeStateMaintenance, Disabled: true},
+			{ID: "d", AdminState: NodeStateMaintenance, Disabled: true},
+		},
+	}
+	updateClusterHealth(cluster)
+	cm := &ClusterManager{clusters: map[string]*models.Cluster{cluster.ID: cluster}}
+
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/clusters/1/status", nil), map[string]string{"clusterId": "1"})
+	rec := httptest.NewRecorder()
+	cm.GetClusterStatus(rec, req)
+
+	var status clusterStatusResponse
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	want := clusterStatusResponse{
+		ClusterID:       "1",
+		Status:          ClusterHealthHealthy,
+		HealthyNodes:    2,
+		EnabledNodes:    2,
+		TotalNodes:      4,
+		HealthyFraction: 1,
+	}
+	if status != want {
+		t.Errorf("got %+v, want %+v", status, want)
+	}
+	if fraction := float64(status.HealthyNodes) / float64(status.EnabledNodes); fraction != status.HealthyFraction {
+		t.Errorf("healthyFraction %v doesn't follow from healthyNodes over enabledNodes (%v)", status.HealthyFraction, fraction)
+	}
+}
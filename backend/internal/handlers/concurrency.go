@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CpBruceMeena/go-balance/internal/models"
+)
+
+// touchCluster records a configuration change on a cluster, invalidating
+// the entity tag clients based their edits on. Callers must hold cm.mu.
+func touchCluster(cluster *models.Cluster) {
+	cluster.ResourceVersion++
+	cluster.UpdatedAt = time.Now()
+}
+
+// clusterETag formats a cluster's resource version as a strong entity tag
+func clusterETag(cluster *models.Cluster) string {
+	return fmt.Sprintf(`"%d"`, cluster.ResourceVersion)
+}
+
+// checkClusterVersion enforces optimistic concurrency on a cluster update.
+// The request must name the version it was based on, either with If-Match or
+// with a resourceVersion field in the body (bodyVersion). It writes the error
+// response and returns false when the precondition is missing (428), the
+// If-Match tag is stale (412) or the body version is stale (409). Callers must
+// hold cm.mu.
+func checkClusterVersion(w http.ResponseWriter, r *http.Request, cluster *models.Cluster, bodyVersion *int64) bool {
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+	switch {
+	case ifMatch != "":
+		if ifMatch == "*" {
+			return true
+		}
+		for _, tag := range strings.Split(ifMatch, ",") {
+			if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == clusterETag(cluster) {
+				return true
+			}
+		}
+		w.Header().Set("ETag", clusterETag(cluster))
+		writeError(w, http.StatusPreconditionFailed, "Cluster has been modified since it was read; current version is "+strconv.FormatInt(cluster.ResourceVersion, 10))
+		return false
+	case bodyVersion != nil:
+		if *bodyVersion == cluster.ResourceVersion {
+			return true
+		}
+		w.Header().Set("ETag", clusterETag(cluster))
+		writeError(w, http.StatusConflict, "Cluster has been modified since it was read; current version is "+strconv.FormatInt(cluster.ResourceVersion, 10))
+		return false
+	}
+	writeError(w, http.StatusPreconditionRequired, "If-Match header or resourceVersion is required")
+	return false
+}
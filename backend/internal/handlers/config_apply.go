@@ -0,0 +1,732 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/CpBruceMeena/go-balance/internal/config"
+	"github.com/CpBruceMeena/go-balance/internal/events"
+	"github.com/CpBruceMeena/go-balance/internal/loadbalancer"
+	"github.com/CpBruceMeena/go-balance/internal/models"
+	"github.com/google/uuid"
+)
+
+const (
+	// ManagedByConfigFile marks clusters owned by the configuration file;
+	// they are deleted when they disappear from the file
+	ManagedByConfigFile = "config-file"
+
+	ConfigPollInterval = 2 * time.Second
+)
+
+// ConfigDiff describes the changes a configuration makes to the live state
+type ConfigDiff struct {
+	Created []ClusterDiff `json:"created"`
+	Updated []ClusterDiff `json:"updated"`
+	Deleted []ClusterDiff `json:"deleted"`
+}
+
+// ClusterDiff lists the changes to a single cluster. Nodes are identified by URL.
+type ClusterDiff struct {
+	ID           string   `json:"id,omitempty"`
+	Name         string   `json:"name"`
+	Settings     []string `json:"settings,omitempty"` // names of changed settings
+	AddedNodes   []string `json:"addedNodes,omitempty"`
+	RemovedNodes []string `json:"removedNodes,omitempty"`
+	UpdatedNodes []string `json:"updatedNodes,omitempty"`
+}
+
+// Empty reports whether the configuration matches the live state
+func (d ConfigDiff) Empty() bool {
+	return len(d.Created) == 0 && len(d.Updated) == 0 && len(d.Deleted) == 0
+}
+
+// configStatus reports the state of the watched configuration file
+type configStatus struct {
+	Path        string      `json:"path"`
+	LastApplied time.Time   `json:"lastApplied"`
+	LastDiff    *ConfigDiff `json:"lastDiff,omitempty"`
+	LastError   string      `json:"lastError,omitempty"`
+	LastErrorAt *time.Time  `json:"lastErrorAt,omitempty"`
+}
+
+var (
+	configFileStatus   *configStatus
+	configFileStatusMu sync.RWMutex
+)
+
+// UseConfigFile applies the clusters declared in path and then watches the
+// file, applying only what changed whenever it is edited. An invalid file is
+// rejected as a whole and the previously applied configuration stays live.
+func UseConfigFile(path string) error {
+	configFileStatusMu.Lock()
+	configFileStatus = &configStatus{Path: path}
+	configFileStatusMu.Unlock()
+
+	apply := func(file *config.File) error {
+		diff, err := clusterManager.applyConfig(file, configChange{
+			managedBy: ManagedByConfigFile,
+			prune: func(cluster *models.Cluster) bool {
+				return cluster.ManagedBy == ManagedByConfigFile
+			},
+			author: ManagedByConfigFile,
+			action: "Applied " + path,
+		})
+		if err != nil {
+			return err
+		}
+		configFileStatusMu.Lock()
+		configFileStatus.LastApplied = time.Now()
+		configFileStatus.LastDiff = &diff
+		configFileStatus.LastError = ""
+		configFileStatus.LastErrorAt = nil
+		configFileStatusMu.Unlock()
+		return nil
+	}
+	onError := func(err error) {
+		configFileStatusMu.Lock()
+		configFileStatus.LastError = err.Error()
+		now := time.Now()
+		configFileStatus.LastErrorAt = &now
+		configFileStatusMu.Unlock()
+	}
+
+	watcher := config.NewWatcher(path, ConfigPollInterval, apply, onError)
+	if err := watcher.Load(); err != nil {
+		return fmt.Errorf("loading config file %s: %w", path, err)
+	}
+	watcher.Start()
+	return nil
+}
+
+// GetConfigStatus reports when the configuration file was last applied and
+// why the latest version was rejected, if it was
+func (cm *ClusterManager) GetConfigStatus(w http.ResponseWriter, r *http.Request) {
+	configFileStatusMu.RLock()
+	defer configFileStatusMu.RUnlock()
+	if configFileStatus == nil {
+		writeError(w, http.StatusNotFound, "No configuration file in use")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(configFileStatus)
+}
+
+// clusterConfigFrom extracts the configurable settings of a cluster
+func clusterConfigFrom(cluster *models.Cluster) config.ClusterConfig {
+	cc := config.ClusterConfig{
+		Name:                  cluster.Name,
+		Algorithm:             cluster.Algorithm,
+		HealthCheckEndpoint:   cluster.HealthCheckEndpoint,
+		HealthCheckFrequency:  cluster.HealthCheckFrequency,
+		HealthCheckTimeout:    cluster.HealthCheckTimeout,
+		HealthyThreshold:      cluster.HealthyThreshold,
+		UnhealthyThreshold:    cluster.UnhealthyThreshold,
+		FlapThreshold:         cluster.FlapThreshold,
+		FlapWindow:            cluster.FlapWindow,
+		FlapHoldDown:          cluster.FlapHoldDown,
+		HealthCheckMode:       cluster.HealthCheckMode,
+		HeartbeatTTL:          cluster.HeartbeatTTL,
+		PanicThreshold:        cluster.PanicThreshold,
+		StickySessions:        cluster.StickySessions,
+		CertExpiryWarningDays: cluster.CertExpiryWarningDays,
+		Discovery:             copyDiscovery(cluster.Discovery),
+		Nodes:                 make([]config.NodeConfig, 0, len(cluster.Nodes)),
+	}
+	// Slugs derived from the name are left implicit
+	if cluster.Slug != slugify(cluster.Name) {
+		cc.Slug = cluster.Slug
+	}
+	if !emptyTLSSettings(cluster.HealthCheckTLS) {
+		settings := *cluster.HealthCheckTLS
+		cc.HealthCheckTLS = &settings
+	}
+	// Discovered nodes are found again from the discovery settings and
+	// registered nodes register again
+	for _, node := range cluster.Nodes {
+		if !managedNode(&node) {
+			cc.Nodes = append(cc.Nodes, nodeConfigFrom(&node))
+		}
+	}
+	return cc
+}
+
+// clusterSettingsFrom builds a cluster holding the settings of cc with
+// defaults applied, for comparison with and copying onto a live cluster
+func clusterSettingsFrom(cc *config.ClusterConfig) *models.Cluster {
+	cluster := &models.Cluster{
+		Name:                  cc.Name,
+		Algorithm:             cc.Algorithm,
+		HealthCheckEndpoint:   cc.HealthCheckEndpoint,
+		HealthCheckFrequency:  cc.HealthCheckFrequency,
+		HealthCheckTimeout:    cc.HealthCheckTimeout,
+		HealthyThreshold:      cc.HealthyThreshold,
+		UnhealthyThreshold:    cc.UnhealthyThreshold,
+		FlapThreshold:         cc.FlapThreshold,
+		FlapWindow:            cc.FlapWindow,
+		FlapHoldDown:          cc.FlapHoldDown,
+		HealthCheckMode:       cc.HealthCheckMode,
+		HeartbeatTTL:          cc.HeartbeatTTL,
+		PanicThreshold:        cc.PanicThreshold,
+		StickySessions:        cc.StickySessions,
+		CertExpiryWarningDays: cc.CertExpiryWarningDays,
+		Discovery:             copyDiscovery(cc.Discovery),
+	}
+	if cluster.Algorithm == "" {
+		cluster.Algorithm = "round-robin"
+	}
+	cluster.Slug = cc.Slug
+	if cluster.Slug == "" {
+		cluster.Slug = slugify(cc.Name)
+	}
+	if !emptyTLSSettings(cc.HealthCheckTLS) {
+		settings := *cc.HealthCheckTLS
+		cluster.HealthCheckTLS = &settings
+	}
+	applyHealthCheckDefaults(cluster)
+	return cluster
+}
+
+// changedSettings names the settings that differ between two clusters
+func changedSettings(live, desired *models.Cluster) []string {
+	var changed []string
+	check := func(name string, differs bool) {
+		if differs {
+			changed = append(changed, name)
+		}
+	}
+	check("name", live.Name != desired.Name)
+	check("slug", live.Slug != desired.Slug)
+	check("algorithm", live.Algorithm != desired.Algorithm)
+	check("healthCheckEndpoint", live.HealthCheckEndpoint != desired.HealthCheckEndpoint)
+	check("healthCheckFrequency", live.HealthCheckFrequency != desired.HealthCheckFrequency)
+	check("healthCheckTimeout", live.HealthCheckTimeout != desired.HealthCheckTimeout)
+	check("healthyThreshold", live.HealthyThreshold != desired.HealthyThreshold)
+	check("unhealthyThreshold", live.UnhealthyThreshold != desired.UnhealthyThreshold)
+	check("flapThreshold", live.FlapThreshold != desired.FlapThreshold)
+	check("flapWindow", live.FlapWindow != desired.FlapWindow)
+	check("flapHoldDown", live.FlapHoldDown != desired.FlapHoldDown)
+	check("healthCheckMode", live.HealthCheckMode != desired.HealthCheckMode)
+	check("heartbeatTTL", live.HeartbeatTTL != desired.HeartbeatTTL)
+	check("panicThreshold", live.PanicThreshold != desired.PanicThreshold)
+	check("stickySessions", live.StickySessions != desired.StickySessions)
+	check("healthCheckTLS", !sameTLSSettings(live.HealthCheckTLS, desired.HealthCheckTLS))
+	check("certExpiryWarningDays", live.CertExpiryWarningDays != desired.CertExpiryWarningDays)
+	check("discovery", !sameDiscovery(live.Discovery, desired.Discovery))
+	return changed
+}
+
+func emptyTLSSettings(settings *models.HealthCheckTLS) bool {
+	return settings == nil || *settings == (models.HealthCheckTLS{})
+}
+
+// sameTLSSettings compares TLS settings, treating nil and empty as equal
+func sameTLSSettings(a, b *models.HealthCheckTLS) bool {
+	if emptyTLSSettings(a) || emptyTLSSettings(b) {
+		return emptyTLSSettings(a) == emptyTLSSettings(b)
+	}
+	return *a == *b
+}
+
+// copyClusterSettings copies the configurable settings of src onto dst
+func copyClusterSettings(dst, src *models.Cluster) {
+	dst.Name = src.Name
+	dst.Algorithm = src.Algorithm
+	dst.HealthCheckEndpoint = src.HealthCheckEndpoint
+	dst.HealthCheckFrequency = src.HealthCheckFrequency
+	dst.HealthCheckTimeout = src.HealthCheckTimeout
+	dst.HealthyThreshold = src.HealthyThreshold
+	dst.UnhealthyThreshold = src.UnhealthyThreshold
+	dst.FlapThreshold = src.FlapThreshold
+	dst.FlapWindow = src.FlapWindow
+	dst.FlapHoldDown = src.FlapHoldDown
+	dst.HealthCheckMode = src.HealthCheckMode
+	dst.HeartbeatTTL = src.HeartbeatTTL
+	dst.PanicThreshold = src.PanicThreshold
+	dst.StickySessions = src.StickySessions
+	dst.HealthCheckTLS = src.HealthCheckTLS
+	dst.CertExpiryWarningDays = src.CertExpiryWarningDays
+	dst.Discovery = copyDiscovery(src.Discovery)
+}
+
+// diffCluster compares a live cluster with its desired configuration
+func diffCluster(live *models.Cluster, cc *config.ClusterConfig) ClusterDiff {
+	diff := ClusterDiff{
+		ID:       live.ID,
+		Name:     live.Name,
+		Settings: changedSettings(live, clusterSettingsFrom(cc)),
+	}
+
+	desired := make(map[string]config.NodeConfig, len(cc.Nodes))
+	for _, node := range cc.Nodes {
+		desired[node.URL] = node
+	}
+	existing := make(map[string]bool, len(live.Nodes))
+	for _, node := range live.Nodes {
+		existing[node.URL] = true
+		if managedNode(&node) {
+			continue
+		}
+		want, keep := desired[node.URL]
+		switch {
+		case !keep:
+			diff.RemovedNodes = append(diff.RemovedNodes, node.URL)
+		case nodeConfigChanged(&node, want):
+			diff.UpdatedNodes = append(diff.UpdatedNodes, node.URL)
+		}
+	}
+	for _, node := range cc.Nodes {
+		if !existing[node.URL] {
+			diff.AddedNodes = append(diff.AddedNodes, node.URL)
+		}
+	}
+	return diff
+}
+
+func (d ClusterDiff) empty() bool {
+	return len(d.Settings) == 0 && len(d.AddedNodes) == 0 && len(d.RemovedNodes) == 0 && len(d.UpdatedNodes) == 0
+}
+
+// nodeConfigFrom extracts the configurable settings of a node
+func nodeConfigFrom(node *models.Node) config.NodeConfig {
+	return config.NodeConfig{
+		URL:      node.URL,
+		Weight:   node.Weight,
+		Labels:   copyLabels(node.Labels),
+		Disabled: node.Disabled,
+	}
+}
+
+// nodeConfigChanged reports whether a node differs from its desired configuration
+func nodeConfigChanged(node *models.Node, want config.NodeConfig) bool {
+	return node.Weight != nodeWeight(want.Weight) || node.Disabled != want.Disabled ||
+		!sameLabels(node.Labels, want.Labels)
+}
+
+// applyNodeConfig copies the configurable settings of want onto a node.
+// Disabled nodes are put in maintenance; draining nodes keep draining unless
+// disabled.
+func applyNodeConfig(node *models.Node, want config.NodeConfig) {
+	node.Weight = nodeWeight(want.Weight)
+	node.Labels = copyLabels(want.Labels)
+	if want.Disabled {
+		setAdminState(node, NodeStateMaintenance)
+	} else if adminState(node) == NodeStateMaintenance {
+		setAdminState(node, NodeStateActive)
+	}
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	if len(labels) == 0 {
+		return nil
+	}
+	copied := make(map[string]string, len(labels))
+	for k, v := range labels {
+		copied[k] = v
+	}
+	return copied
+}
+
+func sameLabels(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if other, exists := b[k]; !exists || other != v {
+			return false
+		}
+	}
+	return true
+}
+
+// nodeWeight applies the default weight to an unset one
+func nodeWeight(weight int) int {
+	if weight < 1 {
+		return 1
+	}
+	return weight
+}
+
+// planConfig computes the diff between file and the live state. Clusters
+// are matched as by matchClusters; live clusters missing from file are
+// deleted when change.prune returns true for them. Callers must hold cm.mu.
+func (cm *ClusterManager) planConfig(file *config.File, change configChange) ConfigDiff {
+	diff := ConfigDiff{
+		Created: make([]ClusterDiff, 0),
+		Updated: make([]ClusterDiff, 0),
+		Deleted: make([]ClusterDiff, 0),
+	}
+	matched := cm.matchClusters(file, change.clusterIDs)
+	listed := make(map[string]bool, len(matched))
+	for i := range file.Clusters {
+		cc := &file.Clusters[i]
+		live := matched[cc.Name]
+		if live == nil {
+			created := ClusterDiff{Name: cc.Name}
+			for _, node := range cc.Nodes {
+				created.AddedNodes = append(created.AddedNodes, node.URL)
+			}
+			diff.Created = append(diff.Created, created)
+			continue
+		}
+		listed[live.ID] = true
+		if clusterDiff := diffCluster(live, cc); !clusterDiff.empty() {
+			diff.Updated = append(diff.Updated, clusterDiff)
+		}
+	}
+	for _, cluster := range cm.clusters {
+		if !listed[cluster.ID] && change.prune != nil && change.prune(cluster) {
+			deleted := ClusterDiff{ID: cluster.ID, Name: cluster.Name}
+			for _, node := range cluster.Nodes {
+				deleted.RemovedNodes = append(deleted.RemovedNodes, node.URL)
+			}
+			diff.Deleted = append(diff.Deleted, deleted)
+		}
+	}
+	return diff
+}
+
+// matchClusters pairs each cluster of file, by name, with the live cluster it
+// configures: the one whose ID ids gives for its name, if it still exists,
+// or else the live cluster with that name. Clusters matched by ID are
+// renamed to their name in file. Callers must hold cm.mu.
+func (cm *ClusterManager) matchClusters(file *config.File, ids map[string]string) map[string]*models.Cluster {
+	matched := make(map[string]*models.Cluster, len(file.Clusters))
+	claimed := make(map[string]bool, len(file.Clusters))
+	for _, cc := range file.Clusters {
+		if cluster, exists := cm.clusters[ids[cc.Name]]; exists {
+			matched[cc.Name] = cluster
+			claimed[cluster.ID] = true
+		}
+	}
+	for _, cc := range file.Clusters {
+		if matched[cc.Name] != nil {
+			continue
+		}
+		if cluster := cm.clusterByName(cc.Name); cluster != nil && !claimed[cluster.ID] {
+			matched[cc.Name] = cluster
+			claimed[cluster.ID] = true
+		}
+	}
+	return matched
+}
+
+// clusterByName finds a live cluster by name. Callers must hold cm.mu.
+func (cm *ClusterManager) clusterByName(name string) *models.Cluster {
+	for _, cluster := range cm.clusters {
+		if cluster.Name == name {
+			return cluster
+		}
+	}
+	return nil
+}
+
+// newClusterID returns an unused timestamp based cluster ID. Callers must hold cm.mu.
+func (cm *ClusterManager) newClusterID() string {
+	base := time.Now().Format("20060102150405")
+	id := base
+	for i := 2; ; i++ {
+		if _, taken := cm.clusters[id]; !taken {
+			return id
+		}
+		id = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// checkConfigSlugs fails if applying file would leave two clusters with the
+// same slug. matched pairs file clusters with live ones as matchClusters
+// does. Callers must hold cm.mu.
+func (cm *ClusterManager) checkConfigSlugs(file *config.File, matched map[string]*models.Cluster, diff ConfigDiff) error {
+	deleted := make(map[string]bool, len(diff.Deleted))
+	for _, cluster := range diff.Deleted {
+		deleted[cluster.ID] = true
+	}
+	claimed := make(map[string]string, len(file.Clusters))
+	for i := range file.Clusters {
+		cc := &file.Clusters[i]
+		slug := clusterSettingsFrom(cc).Slug
+		if slug == "" {
+			return fmt.Errorf("cluster %q: slug must contain letters or digits", cc.Name)
+		}
+		if other, taken := claimed[slug]; taken {
+			return fmt.Errorf("clusters %q and %q both use slug %q", other, cc.Name, slug)
+		}
+		claimed[slug] = cc.Name
+		owner := cm.slugOwner(slug, time.Now())
+		if owner != nil && owner != matched[cc.Name] && !deleted[owner.ID] {
+			return fmt.Errorf("cluster %q: %w", cc.Name, &slugConflictError{slug: slug, owner: owner.Name})
+		}
+	}
+	return nil
+}
+
+// buildConfigCheckers creates the health checkers for every cluster in file,
+// keyed by cluster name, failing if any TLS settings can't be loaded
+func buildConfigCheckers(file *config.File) (map[string]*loadbalancer.HealthChecker, error) {
+	checkers := make(map[string]*loadbalancer.HealthChecker)
+	for _, cc := range file.Clusters {
+		checker, err := newHealthCheckerFor(cc.HealthCheckTLS)
+		if err != nil {
+			closeCheckers(checkers)
+			return nil, fmt.Errorf("cluster %q: invalid health check TLS settings: %w", cc.Name, err)
+		}
+		checkers[cc.Name] = checker
+	}
+	return checkers, nil
+}
+
+func closeCheckers(checkers map[string]*loadbalancer.HealthChecker) {
+	for _, checker := range checkers {
+		if checker != nil {
+			checker.Close()
+		}
+	}
+}
+
+// configNode identifies a node whose health checks must be (re)started
+type configNode struct {
+	clusterID string
+	nodeID    string
+	url       string
+	probe     bool // run an initial probe before the first scheduled one
+}
+
+// configChange describes where a configuration being applied comes from
+type configChange struct {
+	// Ownership marked on created and updated clusters; empty keeps it
+	managedBy string
+	// Reports whether a live cluster missing from the configuration is deleted
+	prune func(*models.Cluster) bool
+	// Cluster IDs by name, matched before names; see matchClusters
+	clusterIDs map[string]string
+	author     string
+	action     string
+}
+
+// previewConfig validates file against the live state like applyConfig
+// would and returns the diff applying it would make, without changing anything
+func (cm *ClusterManager) previewConfig(file *config.File, change configChange) (ConfigDiff, error) {
+	checkers, err := buildConfigCheckers(file)
+	if err != nil {
+		return ConfigDiff{}, err
+	}
+	closeCheckers(checkers)
+
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	diff := cm.planConfig(file, change)
+	if err := cm.checkConfigSlugs(file, cm.matchClusters(file, change.clusterIDs), diff); err != nil {
+		return ConfigDiff{}, err
+	}
+	return diff, nil
+}
+
+// applyConfig brings the live state in line with file in a single critical
+// section and returns what changed, recording a revision if anything did.
+// Only affected nodes have their health checks started or stopped, and
+// clusters are updated in place so requests already being proxied are
+// unaffected. Nothing is changed if any cluster's TLS settings can't be loaded.
+func (cm *ClusterManager) applyConfig(file *config.File, change configChange) (ConfigDiff, error) {
+	// Build TLS checkers up front so a bad certificate rejects the whole file
+	checkers, err := buildConfigCheckers(file)
+	if err != nil {
+		return ConfigDiff{}, err
+	}
+
+	var published []events.Event
+	var started []configNode
+	var stopped []configNode
+
+	cm.mu.Lock()
+	diff := cm.planConfig(file, change)
+	matched := cm.matchClusters(file, change.clusterIDs)
+	if err := cm.checkConfigSlugs(file, matched, diff); err != nil {
+		cm.mu.Unlock()
+		closeCheckers(checkers)
+		return ConfigDiff{}, err
+	}
+
+	for _, deleted := range diff.Deleted {
+		cluster := cm.clusters[deleted.ID]
+		for _, node := range cluster.Nodes {
+			delete(cm.nodeHealth, healthCheckKey(cluster.ID, node.ID))
+			stopped = append(stopped, configNode{clusterID: cluster.ID, nodeID: node.ID})
+		}
+		delete(cm.clusters, cluster.ID)
+		cm.setHealthChecker(cluster.ID, nil)
+		cm.persistClusterDeletion(cluster.ID)
+		published = append(published, events.New(events.ClusterDeleted, cluster.ID, "", map[string]interface{}{
+			"name": cluster.Name,
+		}))
+	}
+
+	for i := range file.Clusters {
+		cc := &file.Clusters[i]
+		desired := clusterSettingsFrom(cc)
+		cluster := matched[cc.Name]
+		isNew := cluster == nil
+		if isNew {
+			cluster = &models.Cluster{
+				ID:        cm.newClusterID(),
+				Name:      cc.Name,
+				Nodes:     make([]models.Node, 0, len(cc.Nodes)),
+				CreatedAt: time.Now(),
+			}
+			cm.clusters[cluster.ID] = cluster
+			published = append(published, events.New(events.ClusterCreated, cluster.ID, "", map[string]interface{}{
+				"name": cluster.Name,
+			}))
+		}
+
+		settingsChanged := isNew || len(changedSettings(cluster, desired)) > 0
+		nodesChanged := false
+		if settingsChanged {
+			if !isNew && cluster.Algorithm != desired.Algorithm {
+				published = append(published, events.New(events.ClusterAlgorithmChanged, cluster.ID, "", map[string]interface{}{
+					"from": cluster.Algorithm,
+					"to":   desired.Algorithm,
+				}))
+			}
+			copyClusterSettings(cluster, desired)
+			if cluster.Slug != desired.Slug {
+				setSlug(cluster, desired.Slug, time.Now())
+			}
+			cm.setHealthChecker(cluster.ID, checkers[cc.Name])
+		} else if checker := checkers[cc.Name]; checker != nil {
+			checker.Close()
+		}
+		if change.managedBy != "" {
+			cluster.ManagedBy = change.managedBy
+		}
+
+		desiredNodes := make(map[string]config.NodeConfig, len(cc.Nodes))
+		for _, node := range cc.Nodes {
+			desiredNodes[node.URL] = node
+		}
+		kept := make([]models.Node, 0, len(cc.Nodes))
+		existing := make(map[string]bool, len(cluster.Nodes))
+		for _, node := range cluster.Nodes {
+			// Discovered and registered nodes are left to their source
+			if managedNode(&node) {
+				existing[node.URL] = true
+				kept = append(kept, node)
+				continue
+			}
+			want, keep := desiredNodes[node.URL]
+			if !keep {
+				nodesChanged = true
+				delete(cm.nodeHealth, healthCheckKey(cluster.ID, node.ID))
+				stopped = append(stopped, configNode{clusterID: cluster.ID, nodeID: node.ID})
+				published = append(published, events.New(events.NodeRemoved, cluster.ID, node.ID, map[string]interface{}{
+					"url": node.URL,
+				}))
+				continue
+			}
+			stop, start := false, false
+			if nodeConfigChanged(&node, want) {
+				from := adminState(&node)
+				applyNodeConfig(&node, want)
+				stop, start = cm.adminStateChanged(cluster, &node, from)
+				nodesChanged = true
+			}
+			existing[node.URL] = true
+			kept = append(kept, node)
+			if stop {
+				stopped = append(stopped, configNode{clusterID: cluster.ID, nodeID: node.ID})
+			} else if start || (settingsChanged && adminState(&node) != NodeStateMaintenance) {
+				started = append(started, configNode{clusterID: cluster.ID, nodeID: node.ID, url: node.URL, probe: start})
+			}
+		}
+		for _, want := range cc.Nodes {
+			if existing[want.URL] {
+				continue
+			}
+			nodesChanged = true
+			node := models.Node{
+				ID:                uuid.New().String(),
+				URL:               want.URL,
+				AdminState:        NodeStateActive,
+				CreatedAt:         time.Now(),
+				RequestTimestamps: []time.Time{},
+			}
+			applyNodeConfig(&node, want)
+			if adminState(&node) == NodeStateMaintenance {
+				node.HealthStatus = NodeStateMaintenance
+			} else {
+				started = append(started, configNode{clusterID: cluster.ID, nodeID: node.ID, url: node.URL, probe: true})
+			}
+			kept = append(kept, node)
+			published = append(published, events.New(events.NodeAdded, cluster.ID, node.ID, map[string]interface{}{
+				"url": node.URL,
+			}))
+		}
+		cluster.Nodes = kept
+
+		// Heartbeat-only nodes start unhealthy until their first heartbeat
+		if !usesActiveChecks(cluster.HealthCheckMode) {
+			now := time.Now()
+			for j := range cluster.Nodes {
+				node := &cluster.Nodes[j]
+				if node.HealthStatus == "" {
+					cm.refreshNodeHealth(cluster, node, cm.nodeHealthFor(cluster.ID, node), now)
+				}
+			}
+		}
+		if settingsChanged || nodesChanged {
+			updateClusterHealth(cluster)
+			touchCluster(cluster)
+			cm.persistCluster(cluster)
+		}
+	}
+
+	configs := make(map[string]healthCheckConfig)
+	for _, node := range started {
+		if _, exists := configs[node.clusterID]; !exists {
+			configs[node.clusterID] = cm.healthCheckConfigFor(cm.clusters[node.clusterID])
+		}
+	}
+	if !diff.Empty() {
+		cm.recordRevision(change.author, change.action)
+	}
+	cm.mu.Unlock()
+
+	for _, node := range stopped {
+		cm.stopNodeHealthCheck(node.clusterID, node.nodeID)
+	}
+
+	// Probe new nodes concurrently so a slow node doesn't hold up the rest
+	var wg sync.WaitGroup
+	for _, node := range started {
+		node := node
+		cfg := configs[node.clusterID]
+		if node.probe && usesActiveChecks(cfg.mode) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				result := cm.probeNode(context.Background(), node.url, cfg)
+				cm.updateNodeHealthStatus(node.clusterID, node.nodeID, result)
+			}()
+		}
+	}
+	wg.Wait()
+
+	for _, node := range started {
+		cm.startNodeHealthCheck(node.clusterID, node.nodeID, node.url, configs[node.clusterID])
+	}
+	for _, event := range published {
+		cm.events.Publish(event)
+	}
+	cm.syncDiscovery()
+
+	if !diff.Empty() {
+		log.Printf("Configuration applied: %d clusters created, %d updated, %d deleted",
+			len(diff.Created), len(diff.Updated), len(diff.Deleted))
+	}
+	return diff, nil
+}
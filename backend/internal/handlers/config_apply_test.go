@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/CpBruceMeena/go-balance/internal/config"
+	"github.com/CpBruceMeena/go-balance/internal/models"
+)
+
+// liveCluster builds a live cluster matching cc, with defaults applied
+func liveCluster(id string, cc config.ClusterConfig) *models.Cluster {
+	cluster := clusterSettingsFrom(&cc)
+	cluster.ID = id
+	for _, nc := range cc.Nodes {
+		node := models.Node{ID: nc.URL, URL: nc.URL}
+		applyNodeConfig(&node, nc)
+		cluster.Nodes = append(cluster.Nodes, node)
+	}
+	return cluster
+}
+
+func TestPlanConfig(t *testing.T) {
+	web := config.ClusterConfig{
+		Name:                 "web",
+		HealthCheckFrequency: 10,
+		Nodes: []config.NodeConfig{
+			{URL: "http://10.0.0.1:8080"},
+			{URL: "http://10.0.0.2:8080", Weight: 2, Labels: map[string]string{"zone": "a"}},
+		},
+	}
+	api := config.ClusterConfig{Name: "api", HealthCheckFrequency: 10}
+	pruneAll := func(*models.Cluster) bool { return true }
+
+	tests := []struct {
+		name  string
+		file  []config.ClusterConfig
+		prune func(*models.Cluster) bool
+		ids   map[string]string
+		live  func() []*models.Cluster
+		want  ConfigDiff
+	}{
+		{
+			name: "matching configuration",
+			file: []config.ClusterConfig{web},
+			live: func() []*models.Cluster {
+				return []*models.Cluster{liveCluster("1", web)}
+			},
+		},
+		{
+			name: "new cluster",
+			file: []config.ClusterConfig{web},
+			want: ConfigDiff{Created: []ClusterDiff{{
+				Name:       "web",
+				AddedNodes: []string{"http://10.0.0.1:8080", "http://10.0.0.2:8080"},
+			}}},
+		},
+		{
+			name: "changed settings and nodes",
+			file: func() []config.ClusterConfig {
+				changed := web
+				changed.Algorithm = "least-connections"
+				changed.StickySessions = true
+				changed.Nodes = []config.NodeConfig{
+					{URL: "http://10.0.0.2:8080", Weight: 3, Labels: map[string]string{"zone": "a"}},
+					{URL: "http://10.0.0.3:8080"},
+				}
+				return []config.ClusterConfig{changed}
+			}(),
+			live: func() []*models.Cluster {
+				return []*models.Cluster{liveCluster("1", web)}
+			},
+			want: ConfigDiff{Updated: []ClusterDiff{{
+				ID:           "1",
+				Name:         "web",
+				Settings:     []string{"algorithm", "stickySessions"},
+				AddedNodes:   []string{"http://10.0.0.3:8080"},
+				RemovedNodes: []string{"http://10.0.0.1:8080"},
+				UpdatedNodes: []string{"http://10.0.0.2:8080"},
+			}}},
+		},
+		{
+			name: "registered nodes are left alone",
+			file: []config.ClusterConfig{web},
+			live: func() []*models.Cluster {
+				cluster := liveCluster("1", web)
+				cluster.Nodes = append(cluster.Nodes, models.Node{
+					ID:        "registered",
+					URL:       "http://10.0.0.9:8080",
+					Weight:    1,
+					ManagedBy: NodeManagedByRegistration,
+				})
+				return []*models.Cluster{cluster}
+			},
+		},
+		{
+			name: "missing cluster kept without prune",
+			file: []config.ClusterConfig{web},
+			live: func() []*models.Cluster {
+				return []*models.Cluster{liveCluster("1", web), liveCluster("2", api)}
+			},
+		},
+		{
+			name:  "missing cluster kept when prune declines",
+			file:  []config.ClusterConfig{web},
+			prune: func(cluster *models.Cluster) bool { return cluster.ManagedBy == ManagedByConfigFile },
+			live: func() []*models.Cluster {
+				return []*models.Cluster{liveCluster("1", web), liveCluster("2", api)}
+			},
+		},
+		{
+			name:  "missing cluster pruned",
+			file:  []config.ClusterConfig{api},
+			prune: pruneAll,
+			live: func() []*models.Cluster {
+				return []*models.Cluster{liveCluster("1", web), liveCluster("2", api)}
+			},
+			want: ConfigDiff{Deleted: []ClusterDiff{{
+				ID:           "1",
+				Name:         "web",
+				RemovedNodes: []string{"http://10.0.0.1:8080", "http://10.0.0.2:8080"},
+			}}},
+		},
+		{
+			name:  "renamed cluster matched by ID",
+			file:  []config.ClusterConfig{web},
+			prune: pruneAll,
+			ids:   map[string]string{"web": "1"},
+			live: func() []*models.Cluster {
+				renamed := web
+				renamed.Name = "web-renamed"
+				return []*models.Cluster{liveCluster("1", renamed)}
+			},
+			want: ConfigDiff{Updated: []ClusterDiff{{
+				ID:       "1",
+				Name:     "web-renamed",
+				Settings: []string{"name", "slug"},
+			}}},
+		},
+		{
+			name:  "ID matched before a cluster that took the name",
+			file:  []config.ClusterConfig{web},
+			prune: pruneAll,
+			ids:   map[string]string{"web": "1"},
+			live: func() []*models.Cluster {
+				renamed := web
+				renamed.Name = "web-renamed"
+				return []*models.Cluster{liveCluster("1", renamed), liveCluster("2", web)}
+			},
+			want: ConfigDiff{
+				Updated: []ClusterDiff{{ID: "1", Name: "web-renamed", Settings: []string{"name", "slug"}}},
+				Deleted: []ClusterDiff{{
+					ID:           "2",
+					Name:         "web",
+					RemovedNodes: []string{"http://10.0.0.1:8080", "http://10.0.0.2:8080"},
+				}},
+			},
+		},
+		{
+			name: "falls back to names for clusters that no longer exist",
+			file: []config.ClusterConfig{web},
+			ids:  map[string]string{"web": "gone"},
+			live: func() []*models.Cluster {
+				return []*models.Cluster{liveCluster("1", web)}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cm := &ClusterManager{clusters: make(map[string]*models.Cluster)}
+			if test.live != nil {
+				for _, cluster := range test.live() {
+					cm.clusters[cluster.ID] = cluster
+				}
+			}
+
+			diff := cm.planConfig(&config.File{Clusters: test.file}, configChange{prune: test.prune, clusterIDs: test.ids})
+			for _, list := range []*[]ClusterDiff{&test.want.Created, &test.want.Updated, &test.want.Deleted} {
+				if *list == nil {
+					*list = []ClusterDiff{}
+				}
+			}
+			if !reflect.DeepEqual(diff, test.want) {
+				t.Errorf("got %+v, want %+v", diff, test.want)
+			}
+			if diff.Empty() != (len(test.want.Created)+len(test.want.Updated)+len(test.want.Deleted) == 0) {
+				t.Errorf("Empty() is %v for %+v", diff.Empty(), diff)
+			}
+		})
+	}
+}
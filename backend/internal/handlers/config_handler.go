@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/CpBruceMeena/go-balance/internal/config"
+	"github.com/CpBruceMeena/go-balance/internal/models"
+)
+
+const (
+	ImportModeMerge   = "merge"
+	ImportModeReplace = "replace"
+
+	// MaxConfigSize caps the size of an imported configuration
+	MaxConfigSize = 10 << 20
+)
+
+// importResult is returned by an import; DryRun reports that nothing was applied
+type importResult struct {
+	Mode   string     `json:"mode"`
+	DryRun bool       `json:"dryRun"`
+	Diff   ConfigDiff `json:"diff"`
+}
+
+// requestFormat picks the configuration format from the format query
+// parameter, falling back to the given header (Accept or Content-Type)
+func requestFormat(r *http.Request, header string) (config.Format, bool) {
+	switch strings.ToLower(r.URL.Query().Get("format")) {
+	case "json":
+		return config.FormatJSON, true
+	case "yaml", "yml":
+		return config.FormatYAML, true
+	case "":
+	default:
+		return "", false
+	}
+	if strings.Contains(r.Header.Get(header), "yaml") {
+		return config.FormatYAML, true
+	}
+	return config.FormatJSON, true
+}
+
+func contentTypeFor(format config.Format) string {
+	if format == config.FormatYAML {
+		return "application/yaml"
+	}
+	return "application/json"
+}
+
+// exportConfig snapshots the configuration of every cluster, ordered by name
+func (cm *ClusterManager) exportConfig() *config.File {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.configSnapshot()
+}
+
+// configSnapshot is exportConfig for callers already holding cm.mu
+func (cm *ClusterManager) configSnapshot() *config.File {
+	file := &config.File{Clusters: make([]config.ClusterConfig, 0, len(cm.clusters))}
+	for _, cluster := range cm.clusters {
+		file.Clusters = append(file.Clusters, clusterConfigFrom(cluster))
+	}
+	sort.Slice(file.Clusters, func(i, j int) bool {
+		return file.Clusters[i].Name < file.Clusters[j].Name
+	})
+	return file
+}
+
+// ExportConfig returns the configuration of every cluster and node, without
+// runtime state, as JSON or YAML (?format=yaml or Accept: application/yaml)
+func (cm *ClusterManager) ExportConfig(w http.ResponseWriter, r *http.Request) {
+	format, ok := requestFormat(r, "Accept")
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Format must be json or yaml")
+		return
+	}
+
+	data, err := config.Marshal(cm.exportConfig(), format)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to encode configuration")
+		return
+	}
+
+	w.Header().Set("Content-Type", contentTypeFor(format))
+	w.Write(data)
+}
+
+// ImportConfig validates a configuration in the export format and applies
+// it. In merge mode (the default) clusters missing from the body are left
+// alone; in replace mode they are deleted. With ?dryRun=true only the diff is
+// returned.
+func (cm *ClusterManager) ImportConfig(w http.ResponseWriter, r *http.Request) {
+	var errs fieldErrors
+	format, ok := requestFormat(r, "Content-Type")
+	if !ok {
+		errs.add("Content-Type", "must be json or yaml")
+	}
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = ImportModeMerge
+	}
+	if mode != ImportModeMerge && mode != ImportModeReplace {
+		errs.add("mode", "must be merge or replace")
+	}
+	if errs.write(w) {
+		return
+	}
+	dryRun := isDryRun(r)
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, MaxConfigSize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	file, err := config.Parse(data, format)
+	if err != nil {
+		writeConfigError(w, "Invalid configuration", err)
+		return
+	}
+
+	var prune func(*models.Cluster) bool
+	if mode == ImportModeReplace {
+		prune = func(*models.Cluster) bool { return true }
+	}
+
+	result := importResult{Mode: mode, DryRun: dryRun}
+	if dryRun {
+		diff, err := cm.previewConfig(file, configChange{prune: prune})
+		if err != nil {
+			writeConfigError(w, "Invalid configuration", err)
+			return
+		}
+		result.Diff = diff
+	} else {
+		diff, err := cm.applyConfig(file, configChange{
+			prune:  prune,
+			author: requestAuthor(r),
+			action: "Imported configuration (" + mode + ")",
+		})
+		if err != nil {
+			writeConfigError(w, "Invalid configuration", err)
+			return
+		}
+		result.Diff = diff
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// configErrorStatus answers 409 when a configuration clashes with clusters
+// outside it and 400 when it is invalid on its own
+func configErrorStatus(err error) int {
+	var conflict *slugConflictError
+	if errors.As(err, &conflict) {
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,383 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/CpBruceMeena/go-balance/internal/config"
+	"github.com/CpBruceMeena/go-balance/internal/discovery"
+	"github.com/CpBruceMeena/go-balance/internal/events"
+	"github.com/CpBruceMeena/go-balance/internal/models"
+)
+
+const (
+	DiscoveryTypeDNS    = "dns"
+	DiscoveryTypeSRV    = "srv"
+	DiscoveryTypeFile   = "file"
+	DiscoveryTypeConsul = "consul"
+
+	// Node list files are polled this often and read once they have stayed
+	// unchanged for the debounce period
+	DiscoveryFilePollInterval = time.Second
+	DiscoveryFileDebounce     = 2 * time.Second
+
+	// Bounds in seconds on the re-resolution interval when a cluster sets none
+	DefaultDiscoveryMinTTL = 5
+	DefaultDiscoveryMaxTTL = 300
+)
+
+// DiscoveryStatus reports how a cluster's discovery source last resolved
+type DiscoveryStatus struct {
+	Type         string     `json:"type"`
+	Nodes        int        `json:"nodes"` // nodes currently discovered
+	LastResolved *time.Time `json:"lastResolved,omitempty"`
+	NextResolve  *time.Time `json:"nextResolve,omitempty"`
+	LastError    string     `json:"lastError,omitempty"`
+	LastErrorAt  *time.Time `json:"lastErrorAt,omitempty"`
+}
+
+// discoveryRunner resolves a cluster's discovery source until cancelled
+type discoveryRunner struct {
+	clusterID string
+	settings  models.Discovery
+	cancel    context.CancelFunc
+	status    DiscoveryStatus // guarded by cm.mu
+}
+
+// discoveredNode reports whether a node is owned by a discovery source
+func discoveredNode(node *models.Node) bool {
+	for _, kind := range config.DiscoveryTypes {
+		if node.ManagedBy == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// managedNodeMessage explains why a node can't be changed manually
+func managedNodeMessage(node *models.Node) string {
+	if node.ManagedBy == NodeManagedByRegistration {
+		return "is managed by its registration lease"
+	}
+	return "is managed by " + node.ManagedBy + " discovery"
+}
+
+func copyDiscovery(settings *models.Discovery) *models.Discovery {
+	if settings == nil {
+		return nil
+	}
+	copied := *settings
+	return &copied
+}
+
+func sameDiscovery(a, b *models.Discovery) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// newDiscoverySource builds the source for a cluster's discovery settings
+func newDiscoverySource(settings models.Discovery) discovery.Source {
+	if settings.Type == DiscoveryTypeFile {
+		return &discovery.FileSource{
+			Path:     settings.Path,
+			Interval: DiscoveryFilePollInterval,
+			Debounce: DiscoveryFileDebounce,
+		}
+	}
+	minTTL, maxTTL := settings.MinTTL, settings.MaxTTL
+	if minTTL <= 0 {
+		minTTL = DefaultDiscoveryMinTTL
+	}
+	if maxTTL <= 0 {
+		maxTTL = DefaultDiscoveryMaxTTL
+	}
+	if maxTTL < minTTL {
+		maxTTL = minTTL
+	}
+	if settings.Type == DiscoveryTypeConsul {
+		return &discovery.ConsulSource{
+			Address:    settings.Server,
+			Service:    settings.Name,
+			Tag:        settings.Tag,
+			Datacenter: settings.Datacenter,
+			Scheme:     settings.Scheme,
+			Wait:       time.Duration(maxTTL) * time.Second,
+			RetryAfter: time.Duration(minTTL) * time.Second,
+		}
+	}
+	client := &discovery.DNSClient{Server: settings.Server}
+	if settings.Type == DiscoveryTypeSRV {
+		return &discovery.SRVSource{
+			Client: client,
+			Name:   settings.Name,
+			Scheme: settings.Scheme,
+			MinTTL: time.Duration(minTTL) * time.Second,
+			MaxTTL: time.Duration(maxTTL) * time.Second,
+		}
+	}
+	return &discovery.DNSSource{
+		Client: client,
+		Name:   settings.Name,
+		Port:   settings.Port,
+		Scheme: settings.Scheme,
+		MinTTL: time.Duration(minTTL) * time.Second,
+		MaxTTL: time.Duration(maxTTL) * time.Second,
+	}
+}
+
+// discoveredWeight maps a target weight to a node weight. SRV weights go up
+// to 65535, beyond the largest node weight.
+func discoveredWeight(target discovery.Target) int {
+	if target.Weight > config.MaxWeight {
+		return config.MaxWeight
+	}
+	return nodeWeight(target.Weight)
+}
+
+// syncDiscovery runs discovery for exactly the clusters with discovery
+// settings, restarting it where the settings changed. Nodes of clusters
+// whose discovery was turned off stay as ordinary nodes.
+func (cm *ClusterManager) syncDiscovery() {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	for clusterID, runner := range cm.discoveries {
+		cluster, exists := cm.clusters[clusterID]
+		if exists && cluster.Discovery != nil && *cluster.Discovery == runner.settings {
+			continue
+		}
+		runner.cancel()
+		delete(cm.discoveries, clusterID)
+	}
+	for _, cluster := range cm.clusters {
+		switch {
+		case cluster.Discovery == nil:
+			cm.releaseDiscoveredNodes(cluster)
+		case cm.discoveries[cluster.ID] == nil:
+			ctx, cancel := context.WithCancel(context.Background())
+			runner := &discoveryRunner{
+				clusterID: cluster.ID,
+				settings:  *cluster.Discovery,
+				cancel:    cancel,
+				status:    DiscoveryStatus{Type: cluster.Discovery.Type, Nodes: discoveredNodeCount(cluster)},
+			}
+			cm.discoveries[cluster.ID] = runner
+			go cm.runDiscovery(ctx, runner, newDiscoverySource(runner.settings))
+		}
+	}
+}
+
+// releaseDiscoveredNodes turns discovered nodes into ordinary ones.
+// Callers must hold cm.mu.
+func (cm *ClusterManager) releaseDiscoveredNodes(cluster *models.Cluster) {
+	released := false
+	for i := range cluster.Nodes {
+		if discoveredNode(&cluster.Nodes[i]) {
+			cluster.Nodes[i].ManagedBy = ""
+			released = true
+		}
+	}
+	if released {
+		touchCluster(cluster)
+		cm.persistCluster(cluster)
+	}
+}
+
+func discoveredNodeCount(cluster *models.Cluster) int {
+	count := 0
+	for i := range cluster.Nodes {
+		if discoveredNode(&cluster.Nodes[i]) {
+			count++
+		}
+	}
+	return count
+}
+
+// runDiscovery resolves a source and reconciles the cluster's nodes with it
+// until ctx is cancelled
+func (cm *ClusterManager) runDiscovery(ctx context.Context, runner *discoveryRunner, source discovery.Source) {
+	for {
+		targets, wait, err := source.Resolve(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			cm.discoveryFailed(runner, err, wait)
+		} else {
+			cm.reconcileDiscovered(runner, targets, wait)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// discoveryFailed records a failed resolution. Discovered nodes are kept
+// until the source resolves again.
+func (cm *ClusterManager) discoveryFailed(runner *discoveryRunner, err error, wait time.Duration) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if cm.discoveries[runner.clusterID] != runner {
+		return
+	}
+	now := time.Now()
+	if runner.status.LastError != err.Error() {
+		log.Printf("Cluster %s: %s discovery failed, keeping current nodes: %v", runner.clusterID, runner.settings.Type, err)
+	}
+	runner.status.LastError = err.Error()
+	runner.status.LastErrorAt = &now
+	runner.status.NextResolve = nextResolve(now, wait)
+}
+
+// nextResolve returns when a source resolves again, or nil for sources that
+// wait for changes instead
+func nextResolve(now time.Time, wait time.Duration) *time.Time {
+	if wait <= 0 {
+		return nil
+	}
+	next := now.Add(wait)
+	return &next
+}
+
+// reconcileDiscovered adds a node for every new target and removes the
+// discovered nodes no longer listed. Static nodes are never touched, and a
+// target with the URL of a static node is skipped.
+func (cm *ClusterManager) reconcileDiscovered(runner *discoveryRunner, targets []discovery.Target, wait time.Duration) {
+	var published []events.Event
+	var started, stopped []configNode
+
+	cm.mu.Lock()
+	cluster, exists := cm.clusters[runner.clusterID]
+	if !exists || cm.discoveries[runner.clusterID] != runner {
+		cm.mu.Unlock()
+		return
+	}
+	kind := runner.settings.Type
+	desired := make(map[string]discovery.Target, len(targets))
+	for _, target := range targets {
+		desired[target.URL] = target
+	}
+	kept := make([]models.Node, 0, len(cluster.Nodes)+len(targets))
+	existing := make(map[string]bool, len(cluster.Nodes))
+	changed := false
+	for _, node := range cluster.Nodes {
+		existing[node.URL] = true
+		if !discoveredNode(&node) {
+			kept = append(kept, node)
+			continue
+		}
+		target, listed := desired[node.URL]
+		if !listed {
+			changed = true
+			delete(cm.nodeHealth, healthCheckKey(cluster.ID, node.ID))
+			stopped = append(stopped, configNode{clusterID: cluster.ID, nodeID: node.ID})
+			published = append(published, events.New(events.NodeRemoved, cluster.ID, node.ID, map[string]interface{}{
+				"url":       node.URL,
+				"discovery": kind,
+			}))
+			continue
+		}
+		if node.Weight != discoveredWeight(target) || node.Priority != target.Priority || !sameLabels(node.Labels, target.Labels) {
+			changed = true
+			node.Weight = discoveredWeight(target)
+			node.Priority = target.Priority
+			node.Labels = copyLabels(target.Labels)
+		}
+		// Nodes found by an earlier source are taken over by this one
+		if node.ManagedBy != kind {
+			changed = true
+			node.ManagedBy = kind
+		}
+		kept = append(kept, node)
+	}
+	for _, target := range targets {
+		if existing[target.URL] {
+			continue
+		}
+		existing[target.URL] = true
+		changed = true
+		node := newNode(target.URL, discoveredWeight(target), target.Labels)
+		node.Priority = target.Priority
+		node.ManagedBy = kind
+		kept = append(kept, *node)
+		started = append(started, configNode{clusterID: cluster.ID, nodeID: node.ID, url: node.URL, probe: true})
+		published = append(published, events.New(events.NodeAdded, cluster.ID, node.ID, map[string]interface{}{
+			"url":       node.URL,
+			"discovery": kind,
+		}))
+	}
+	cluster.Nodes = kept
+
+	if changed {
+		// Heartbeat-only nodes start unhealthy until their first heartbeat
+		if !usesActiveChecks(cluster.HealthCheckMode) {
+			now := time.Now()
+			for i := range cluster.Nodes {
+				node := &cluster.Nodes[i]
+				if node.HealthStatus == "" {
+					cm.refreshNodeHealth(cluster, node, cm.nodeHealthFor(cluster.ID, node), now)
+				}
+			}
+		}
+		updateClusterHealth(cluster)
+		touchCluster(cluster)
+		cm.persistCluster(cluster)
+	}
+	now := time.Now()
+	runner.status.Nodes = discoveredNodeCount(cluster)
+	runner.status.LastResolved = &now
+	runner.status.NextResolve = nextResolve(now, wait)
+	if runner.status.LastError != "" {
+		log.Printf("Cluster %s: %s discovery recovered", cluster.ID, kind)
+	}
+	runner.status.LastError = ""
+	runner.status.LastErrorAt = nil
+	cfg := cm.healthCheckConfigFor(cluster)
+	cm.mu.Unlock()
+
+	for _, node := range stopped {
+		cm.stopNodeHealthCheck(node.clusterID, node.nodeID)
+	}
+	// Probe new nodes concurrently so a slow node doesn't hold up the rest
+	if usesActiveChecks(cfg.mode) {
+		var wg sync.WaitGroup
+		for _, node := range started {
+			node := node
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				result := cm.probeNode(context.Background(), node.url, cfg)
+				cm.updateNodeHealthStatus(node.clusterID, node.nodeID, result)
+			}()
+		}
+		wg.Wait()
+	}
+	for _, node := range started {
+		cm.startNodeHealthCheck(node.clusterID, node.nodeID, node.url, cfg)
+	}
+	for _, event := range published {
+		cm.events.Publish(event)
+	}
+	if changed {
+		log.Printf("Cluster %s: %s discovery added %d and removed %d nodes", runner.clusterID, kind, len(started), len(stopped))
+	}
+}
+
+// discoveryStatus returns a copy of a cluster's discovery status, or nil
+// without discovery. Callers must hold cm.mu.
+func (cm *ClusterManager) discoveryStatus(clusterID string) *DiscoveryStatus {
+	runner, exists := cm.discoveries[clusterID]
+	if !exists {
+		return nil
+	}
+	status := runner.status
+	return &status
+}
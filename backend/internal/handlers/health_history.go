@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/CpBruceMeena/go-balance/internal/loadbalancer"
+	"github.com/CpBruceMeena/go-balance/internal/models"
+	"github.com/gorilla/mux"
+)
+
+// nodeHealth holds the health engine state for a single node. It is kept
+// apart from models.Node because IsActive may be forced off (e.g. while a
+// node is held down for flapping) independently of the probe results.
+type nodeHealth struct {
+	state   loadbalancer.HealthState // active check state
+	probed  bool                     // state has seen at least one probe
+	healthy bool                     // combined state last applied to the node
+	known   bool
+	history *loadbalancer.HealthHistory
+}
+
+// nodeHealthFor returns the health state of a node, seeding it from the node
+// when it isn't tracked yet. Callers must hold cm.mu.
+func (cm *ClusterManager) nodeHealthFor(clusterID string, node *models.Node) *nodeHealth {
+	key := healthCheckKey(clusterID, node.ID)
+	health, exists := cm.nodeHealth[key]
+	if !exists {
+		healthy := node.HealthStatus == "healthy" || node.HealthStatus == "warning" ||
+			(node.HealthStatus == "flapping" && node.IsActive)
+		health = &nodeHealth{
+			state: loadbalancer.HealthState{
+				Healthy:              healthy,
+				ConsecutiveSuccesses: node.ConsecutiveSuccesses,
+				ConsecutiveFailures:  node.ConsecutiveFailures,
+			},
+			probed:  node.HealthStatus != "",
+			healthy: healthy,
+			known:   node.HealthStatus != "",
+			history: loadbalancer.NewHealthHistory(HealthHistorySize),
+		}
+		cm.nodeHealth[key] = health
+	}
+	return health
+}
+
+type healthHistoryResponse struct {
+	NodeID      string                     `json:"nodeId"`
+	Flapping    bool                       `json:"flapping"`
+	Transitions int                        `json:"transitions"` // State changes within the cluster's flap window
+	Records     []loadbalancer.ProbeRecord `json:"records"`
+}
+
+// GetNodeHealthHistory returns the recent probe results of a node, oldest first
+func (cm *ClusterManager) GetNodeHealthHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	clusterID := vars["clusterId"]
+	nodeID := vars["nodeId"]
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	cluster, exists := cm.clusters[clusterID]
+	if !exists {
+		writeError(w, http.StatusNotFound, "Cluster not found")
+		return
+	}
+
+	for i := range cluster.Nodes {
+		node := &cluster.Nodes[i]
+		if node.ID != nodeID {
+			continue
+		}
+		health := cm.nodeHealthFor(clusterID, node)
+		cutoff := time.Now().Add(-time.Duration(cluster.FlapWindow) * time.Second)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(healthHistoryResponse{
+			NodeID:      node.ID,
+			Flapping:    node.Flapping,
+			Transitions: health.history.TransitionsSince(cutoff),
+			Records:     health.history.Records(),
+		})
+		return
+	}
+
+	writeError(w, http.StatusNotFound, "Node not found")
+}
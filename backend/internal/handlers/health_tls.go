@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/CpBruceMeena/go-balance/internal/loadbalancer"
+	"github.com/CpBruceMeena/go-balance/internal/models"
+)
+
+// tlsDir holds the CA, certificate and key files health check TLS settings
+// may name; empty allows none
+var tlsDir string
+
+// UseTLSDir restricts the files named by health check TLS settings to dir.
+// Relative names are resolved against it.
+func UseTLSDir(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	tlsDir = abs
+	return nil
+}
+
+// tlsFilePath resolves a file named by TLS settings, refusing names outside
+// tlsDir so API callers can't read arbitrary server files
+func tlsFilePath(name string) (string, bool) {
+	if tlsDir == "" {
+		return "", false
+	}
+	path := name
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(tlsDir, path)
+	}
+	rel, err := filepath.Rel(tlsDir, filepath.Clean(path))
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return path, true
+}
+
+// buildHealthCheckTLS turns a cluster's TLS settings into a client TLS config.
+// Errors don't include file contents or system errors, which are only
+// logged, since they are reported to API callers.
+func buildHealthCheckTLS(settings *models.HealthCheckTLS) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         settings.ServerName,
+		InsecureSkipVerify: settings.InsecureSkipVerify,
+	}
+
+	if settings.CAFile != "" {
+		path, ok := tlsFilePath(settings.CAFile)
+		if !ok {
+			return nil, errors.New("caFile must name a file in the TLS directory")
+		}
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("Reading health check CA bundle: %v", err)
+			return nil, errors.New("caFile can't be read")
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("caFile holds no PEM certificates")
+		}
+		config.RootCAs = pool
+	}
+
+	if settings.CertFile != "" || settings.KeyFile != "" {
+		if settings.CertFile == "" || settings.KeyFile == "" {
+			return nil, errors.New("client certificate and key must be set together")
+		}
+		certPath, certOK := tlsFilePath(settings.CertFile)
+		keyPath, keyOK := tlsFilePath(settings.KeyFile)
+		if !certOK || !keyOK {
+			return nil, errors.New("certFile and keyFile must name files in the TLS directory")
+		}
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			log.Printf("Loading health check client certificate: %v", err)
+			return nil, errors.New("certFile and keyFile don't hold a readable certificate and matching key")
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// newHealthCheckerFor returns a dedicated checker for clusters with TLS
+// settings, or nil when the shared default checker should be used
+func newHealthCheckerFor(settings *models.HealthCheckTLS) (*loadbalancer.HealthChecker, error) {
+	if settings == nil || *settings == (models.HealthCheckTLS{}) {
+		return nil, nil
+	}
+	config, err := buildHealthCheckTLS(settings)
+	if err != nil {
+		return nil, err
+	}
+	return loadbalancer.NewHealthCheckerWithTLS(config), nil
+}
+
+// setHealthChecker installs the checker used for a cluster's probes; nil
+// reverts to the shared checker. Callers must hold cm.mu.
+func (cm *ClusterManager) setHealthChecker(clusterID string, checker *loadbalancer.HealthChecker) {
+	if existing, exists := cm.healthCheckers[clusterID]; exists {
+		existing.Close()
+		delete(cm.healthCheckers, clusterID)
+	}
+	if checker != nil {
+		cm.healthCheckers[clusterID] = checker
+	}
+}
+
+// certExpiringSoon reports whether the node's certificate expires within the
+// cluster's warning window
+func certExpiringSoon(cluster *models.Cluster, node *models.Node, now time.Time) bool {
+	if node.CertExpiresAt.IsZero() {
+		return false
+	}
+	window := time.Duration(cluster.CertExpiryWarningDays) * 24 * time.Hour
+	return node.CertExpiresAt.Before(now.Add(window))
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/CpBruceMeena/go-balance/internal/loadbalancer"
+	"github.com/CpBruceMeena/go-balance/internal/models"
+	"github.com/gorilla/mux"
+)
+
+// HeartbeatRequest is the optional load payload a node may push with its heartbeat
+type HeartbeatRequest struct {
+	CPU         *float64 `json:"cpu"`
+	Memory      *float64 `json:"memory"`
+	Connections *int     `json:"connections"`
+}
+
+type heartbeatResponse struct {
+	NodeID       string    `json:"nodeId"`
+	IsActive     bool      `json:"isActive"`
+	HealthStatus string    `json:"healthStatus"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
+
+func validHealthCheckMode(mode string) bool {
+	switch mode {
+	case "", HealthCheckModeActive, HealthCheckModeHeartbeat, HealthCheckModeBoth:
+		return true
+	}
+	return false
+}
+
+func usesActiveChecks(mode string) bool {
+	return mode != HealthCheckModeHeartbeat
+}
+
+func usesHeartbeats(mode string) bool {
+	return mode == HealthCheckModeHeartbeat || mode == HealthCheckModeBoth
+}
+
+func heartbeatKey(clusterID, nodeID string) string {
+	return fmt.Sprintf("%s-%s-heartbeat", clusterID, nodeID)
+}
+
+func heartbeatFresh(cluster *models.Cluster, node *models.Node, now time.Time) bool {
+	if node.LastHeartbeat.IsZero() {
+		return false
+	}
+	return now.Sub(node.LastHeartbeat) <= time.Duration(cluster.HeartbeatTTL)*time.Second
+}
+
+// scheduleHeartbeatExpiry checks twice per TTL whether a node's heartbeat has lapsed
+func (cm *ClusterManager) scheduleHeartbeatExpiry(clusterID, nodeID string, ttl time.Duration) {
+	interval := ttl / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	cm.healthScheduler.Schedule(heartbeatKey(clusterID, nodeID), interval, func(ctx context.Context) {
+		cm.expireHeartbeat(clusterID, nodeID)
+	})
+}
+
+func (cm *ClusterManager) expireHeartbeat(clusterID, nodeID string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	cluster, exists := cm.clusters[clusterID]
+	if !exists {
+		return
+	}
+	for i := range cluster.Nodes {
+		node := &cluster.Nodes[i]
+		if node.ID != nodeID {
+			continue
+		}
+		now := time.Now()
+		health := cm.nodeHealthFor(clusterID, node)
+		if health.healthy && !heartbeatFresh(cluster, node, now) {
+			health.history.Add(loadbalancer.ProbeRecord{
+				Timestamp: now,
+				Error:     "heartbeat expired",
+			})
+		}
+		cm.refreshNodeHealth(cluster, node, health, now)
+		return
+	}
+}
+
+// authorizeHeartbeat checks the bearer token of a heartbeat, answering 403
+// when the cluster has no heartbeat token and 401 when the token is missing
+// or wrong. Callers must hold cm.mu.
+func authorizeHeartbeat(w http.ResponseWriter, r *http.Request, cluster *models.Cluster) bool {
+	if cluster.HeartbeatAuth == nil {
+		writeError(w, http.StatusForbidden, "Cluster has no heartbeat token")
+		return false
+	}
+	return checkBearerToken(w, r, cluster.HeartbeatAuth.TokenHash, "Invalid heartbeat token")
+}
+
+// CreateHeartbeatToken issues the token nodes send heartbeats with,
+// replacing the previous one
+func (cm *ClusterManager) CreateHeartbeatToken(w http.ResponseWriter, r *http.Request) {
+	clusterID := mux.Vars(r)["clusterId"]
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cluster, exists := cm.clusters[clusterID]
+	if !exists {
+		writeError(w, http.StatusNotFound, "Cluster not found")
+		return
+	}
+	now := time.Now()
+	if isDryRun(r) {
+		writeDryRun(w, TokenResponse{IssuedAt: now})
+		return
+	}
+
+	token, hash, err := newNodeToken()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+	cluster.HeartbeatAuth = &models.HeartbeatAuth{TokenHash: hash, IssuedAt: now}
+	touchCluster(cluster)
+	cm.persistCluster(cluster)
+	log.Printf("Cluster %s: issued a new heartbeat token", clusterID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(TokenResponse{Token: token, IssuedAt: now})
+}
+
+// DeleteHeartbeatToken revokes a cluster's heartbeat token. Heartbeats are
+// refused until a new one is issued, so heartbeat nodes go unhealthy.
+func (cm *ClusterManager) DeleteHeartbeatToken(w http.ResponseWriter, r *http.Request) {
+	clusterID := mux.Vars(r)["clusterId"]
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cluster, exists := cm.clusters[clusterID]
+	if !exists {
+		writeError(w, http.StatusNotFound, "Cluster not found")
+		return
+	}
+	if cluster.HeartbeatAuth == nil {
+		writeError(w, http.StatusNotFound, "Cluster has no heartbeat token")
+		return
+	}
+	if isDryRun(r) {
+		writeDryRun(w, cluster.HeartbeatAuth)
+		return
+	}
+	cluster.HeartbeatAuth = nil
+	touchCluster(cluster)
+	cm.persistCluster(cluster)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Heartbeat lets a node that can't be probed report its own liveness. It
+// must carry the cluster's heartbeat token as a bearer token.
+func (cm *ClusterManager) Heartbeat(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	clusterID := vars["clusterId"]
+	nodeID := vars["nodeId"]
+
+	// A heartbeat without a body only reports liveness
+	var request HeartbeatRequest
+	if r.ContentLength != 0 && !decodeRequest(w, r, &request) {
+		return
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	cluster, exists := cm.clusters[clusterID]
+	if !exists {
+		writeError(w, http.StatusNotFound, "Cluster not found")
+		return
+	}
+	if !authorizeHeartbeat(w, r, cluster) {
+		return
+	}
+	if !usesHeartbeats(cluster.HealthCheckMode) {
+		writeError(w, http.StatusConflict, "Cluster does not accept heartbeats")
+		return
+	}
+
+	for i := range cluster.Nodes {
+		node := &cluster.Nodes[i]
+		if node.ID != nodeID {
+			continue
+		}
+
+		now := time.Now()
+		node.LastHeartbeat = now
+		if request.CPU != nil {
+			node.CPU = *request.CPU
+		}
+		if request.Memory != nil {
+			node.Memory = *request.Memory
+		}
+		if request.Connections != nil {
+			node.Connections = *request.Connections
+		}
+
+		health := cm.nodeHealthFor(clusterID, node)
+		health.history.Add(loadbalancer.ProbeRecord{Timestamp: now, Healthy: true})
+		cm.refreshNodeHealth(cluster, node, health, now)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(heartbeatResponse{
+			NodeID:       node.ID,
+			IsActive:     node.IsActive,
+			HealthStatus: node.HealthStatus,
+			ExpiresAt:    now.Add(time.Duration(cluster.HeartbeatTTL) * time.Second),
+		})
+		return
+	}
+
+	writeError(w, http.StatusNotFound, "Node not found")
+}
@@ -0,0 +1,517 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CpBruceMeena/go-balance/internal/config"
+	"github.com/CpBruceMeena/go-balance/internal/events"
+	"github.com/CpBruceMeena/go-balance/internal/models"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// MaxBatchSize caps the number of nodes in a single batch request
+const MaxBatchSize = 1000
+
+// BatchNode is one entry of a batch add
+type BatchNode struct {
+	URL    string            `json:"url"`
+	Weight int               `json:"weight"`
+	Labels map[string]string `json:"labels"`
+}
+
+// BatchNodeResult reports the outcome for one entry of a batch request
+type BatchNodeResult struct {
+	Index  int          `json:"index"`
+	URL    string       `json:"url,omitempty"`
+	NodeID string       `json:"nodeId,omitempty"`
+	Status string       `json:"status"` // added, removed, updated, valid, invalid, not_found or managed
+	Error  string       `json:"error,omitempty"`
+	Node   *models.Node `json:"node,omitempty"`
+}
+
+// BatchNodesRequest selects existing nodes for a batch delete or update
+type BatchNodesRequest struct {
+	NodeIDs []string `json:"nodeIds"`
+	// Only used by batch updates; see PatchNodeRequest
+	Enabled      *bool   `json:"enabled"`
+	AdminState   *string `json:"adminState"`
+	DrainTimeout *int    `json:"drainTimeout"`
+	DrainThen    string  `json:"drainThen"`
+}
+
+// newNode creates a node with defaults applied; it is unprobed until its
+// first health check
+func newNode(url string, weight int, labels map[string]string) *models.Node {
+	return &models.Node{
+		ID:                uuid.New().String(),
+		URL:               url,
+		CreatedAt:         time.Now(),
+		Weight:            nodeWeight(weight),
+		Labels:            copyLabels(labels),
+		AdminState:        NodeStateActive,
+		RequestTimestamps: []time.Time{},
+	}
+}
+
+// parseBatchNodes decodes a batch add body: a JSON list of nodes, an object
+// with a nodes list, or CSV (Content-Type text/csv) with url, weight and
+// labels columns, labels written as key=value pairs separated by ';'
+func parseBatchNodes(r *http.Request) ([]BatchNode, error) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, MaxConfigSize))
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.Contains(r.Header.Get("Content-Type"), "csv") {
+		return parseNodesCSV(data)
+	}
+
+	var nodes []BatchNode
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var wrapped struct {
+			Nodes []BatchNode `json:"nodes"`
+		}
+		err = json.Unmarshal(data, &wrapped)
+		nodes = wrapped.Nodes
+	} else {
+		err = json.Unmarshal(data, &nodes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	return nodes, nil
+}
+
+func parseNodesCSV(data []byte) ([]BatchNode, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+
+	columns := map[string]int{"url": 0, "weight": 1, "labels": 2}
+	if len(rows) > 0 && strings.EqualFold(strings.TrimSpace(rows[0][0]), "url") {
+		columns = make(map[string]int)
+		for i, name := range rows[0] {
+			columns[strings.ToLower(strings.TrimSpace(name))] = i
+		}
+		rows = rows[1:]
+	}
+	field := func(row []string, name string) string {
+		if i, exists := columns[name]; exists && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	nodes := make([]BatchNode, 0, len(rows))
+	for line, row := range rows {
+		node := BatchNode{URL: field(row, "url")}
+		if weight := field(row, "weight"); weight != "" {
+			if node.Weight, err = strconv.Atoi(weight); err != nil {
+				return nil, fmt.Errorf("row %d: invalid weight %q", line+1, weight)
+			}
+		}
+		if labels := field(row, "labels"); labels != "" {
+			node.Labels = make(map[string]string)
+			for _, pair := range strings.Split(labels, ";") {
+				key, value, found := strings.Cut(pair, "=")
+				if !found || strings.TrimSpace(key) == "" {
+					return nil, fmt.Errorf("row %d: labels must be key=value pairs separated by ';'", line+1)
+				}
+				node.Labels[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			}
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// writeBatchResults answers with the per-node results
+func writeBatchResults(w http.ResponseWriter, status int, results []BatchNodeResult) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"results": results,
+	})
+}
+
+// BatchAddNodes validates every entry first and adds either all of them or,
+// if any entry is invalid, none. Initial health checks run concurrently once
+// the nodes are in place, outside the lock.
+func (cm *ClusterManager) BatchAddNodes(w http.ResponseWriter, r *http.Request) {
+	clusterID := mux.Vars(r)["clusterId"]
+
+	entries, err := parseBatchNodes(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	var errs fieldErrors
+	errs.inRange("nodes", len(entries), 1, MaxBatchSize)
+	if errs.write(w) {
+		return
+	}
+
+	cm.mu.Lock()
+	cluster, exists := cm.clusters[clusterID]
+	if !exists {
+		cm.mu.Unlock()
+		writeError(w, http.StatusNotFound, "Cluster not found")
+		return
+	}
+
+	results := make([]BatchNodeResult, len(entries))
+	seen := make(map[string]int, len(cluster.Nodes)+len(entries))
+	for _, node := range cluster.Nodes {
+		seen[node.URL] = -1
+	}
+	valid := true
+	for i := range entries {
+		entry := &entries[i]
+		entry.URL = strings.TrimSpace(entry.URL)
+		results[i] = BatchNodeResult{Index: i, URL: entry.URL, Status: "added"}
+
+		err := config.ValidateNodeURL(entry.URL)
+		if err == nil && (entry.Weight < 0 || entry.Weight > config.MaxWeight) {
+			err = fmt.Errorf("weight must be between 0 and %d", config.MaxWeight)
+		}
+		if previous, duplicate := seen[entry.URL]; err == nil && duplicate {
+			if previous < 0 {
+				err = errors.New("a node with this URL already exists in the cluster")
+			} else {
+				err = fmt.Errorf("duplicates entry %d", previous)
+			}
+		}
+		seen[entry.URL] = i
+		if err != nil {
+			results[i].Status = "invalid"
+			results[i].Error = err.Error()
+			valid = false
+		}
+	}
+	if !valid || isDryRun(r) {
+		cm.mu.Unlock()
+		// Nothing was added; mark the entries that passed validation
+		for i := range results {
+			if results[i].Status == "added" {
+				results[i].Status = "valid"
+			}
+		}
+		status := http.StatusOK
+		if !valid {
+			status = http.StatusBadRequest
+		}
+		writeBatchResults(w, status, results)
+		return
+	}
+
+	cfg := cm.healthCheckConfigFor(cluster)
+	now := time.Now()
+	for i, entry := range entries {
+		node := newNode(entry.URL, entry.Weight, entry.Labels)
+		// Heartbeat-only nodes start unhealthy until their first heartbeat
+		if !usesActiveChecks(cfg.mode) {
+			cm.refreshNodeHealth(cluster, node, cm.nodeHealthFor(clusterID, node), now)
+		}
+		cluster.Nodes = append(cluster.Nodes, *node)
+		results[i].NodeID = node.ID
+	}
+	updateClusterHealth(cluster)
+	touchCluster(cluster)
+	cm.persistCluster(cluster)
+	cm.recordRevision(requestAuthor(r), fmt.Sprintf("Added %d nodes to cluster %s", len(entries), cluster.Name))
+	cm.mu.Unlock()
+
+	if usesActiveChecks(cfg.mode) {
+		// Bound concurrency like the scheduler so a large batch doesn't open
+		// hundreds of connections at once
+		sem := make(chan struct{}, MaxConcurrentHealthChecks)
+		var wg sync.WaitGroup
+		for i := range results {
+			wg.Add(1)
+			go func(result *BatchNodeResult) {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				probe := cm.probeNode(context.Background(), result.URL, cfg)
+				cm.updateNodeHealthStatus(clusterID, result.NodeID, probe)
+			}(&results[i])
+		}
+		wg.Wait()
+	}
+
+	for i := range results {
+		cm.startNodeHealthCheck(clusterID, results[i].NodeID, results[i].URL, cfg)
+		cm.events.Publish(events.New(events.NodeAdded, clusterID, results[i].NodeID, map[string]interface{}{
+			"url": results[i].URL,
+		}))
+	}
+
+	cm.mu.RLock()
+	for i := range results {
+		if node := findNode(cm.clusters[clusterID], results[i].NodeID); node != nil {
+			copied := *node
+			copied.RequestTimestamps = nil
+			results[i].Node = &copied
+		}
+	}
+	cm.mu.RUnlock()
+
+	writeBatchResults(w, http.StatusCreated, results)
+}
+
+// writeDryRunBatch answers a batch dry run, marking every entry valid
+func writeDryRunBatch(w http.ResponseWriter, results []BatchNodeResult) {
+	for i := range results {
+		results[i].Status = "valid"
+	}
+	writeBatchResults(w, http.StatusOK, results)
+}
+
+// findNode looks a node up by ID; cluster may be nil. Callers must hold cm.mu.
+func findNode(cluster *models.Cluster, nodeID string) *models.Node {
+	if cluster == nil {
+		return nil
+	}
+	for i := range cluster.Nodes {
+		if cluster.Nodes[i].ID == nodeID {
+			return &cluster.Nodes[i]
+		}
+	}
+	return nil
+}
+
+// resolveBatchNodes checks that every requested node exists. Callers must hold cm.mu.
+func resolveBatchNodes(cluster *models.Cluster, nodeIDs []string) ([]BatchNodeResult, bool) {
+	results := make([]BatchNodeResult, len(nodeIDs))
+	found := true
+	seen := make(map[string]bool, len(nodeIDs))
+	for i, nodeID := range nodeIDs {
+		results[i] = BatchNodeResult{Index: i, NodeID: nodeID}
+		node := findNode(cluster, nodeID)
+		switch {
+		case node == nil:
+			results[i].Status = "not_found"
+			results[i].Error = "node not found"
+			found = false
+		case seen[nodeID]:
+			results[i].Status = "invalid"
+			results[i].Error = "node listed more than once"
+			found = false
+		default:
+			results[i].URL = node.URL
+		}
+		seen[nodeID] = true
+	}
+	return results, found
+}
+
+// rejectManagedNodes marks the results whose nodes are owned by a discovery
+// source or a registration lease, reporting whether there were none. Callers
+// must hold cm.mu.
+func rejectManagedNodes(cluster *models.Cluster, results []BatchNodeResult) bool {
+	none := true
+	for i := range results {
+		if node := findNode(cluster, results[i].NodeID); node != nil && managedNode(node) {
+			results[i].Status = "managed"
+			results[i].Error = "node " + managedNodeMessage(node)
+			none = false
+		}
+	}
+	return none
+}
+
+func decodeBatchNodesRequest(w http.ResponseWriter, r *http.Request) (BatchNodesRequest, bool) {
+	var request BatchNodesRequest
+	if !decodeRequest(w, r, &request) {
+		return request, false
+	}
+	var errs fieldErrors
+	errs.inRange("nodeIds", len(request.NodeIDs), 1, MaxBatchSize)
+	return request, !errs.write(w)
+}
+
+// BatchDeleteNodes removes all the listed nodes, or none if any is unknown
+func (cm *ClusterManager) BatchDeleteNodes(w http.ResponseWriter, r *http.Request) {
+	clusterID := mux.Vars(r)["clusterId"]
+	request, ok := decodeBatchNodesRequest(w, r)
+	if !ok {
+		return
+	}
+
+	cm.mu.Lock()
+	cluster, exists := cm.clusters[clusterID]
+	if !exists {
+		cm.mu.Unlock()
+		writeError(w, http.StatusNotFound, "Cluster not found")
+		return
+	}
+	results, found := resolveBatchNodes(cluster, request.NodeIDs)
+	if !found {
+		cm.mu.Unlock()
+		writeBatchResults(w, http.StatusBadRequest, results)
+		return
+	}
+	if !rejectManagedNodes(cluster, results) {
+		cm.mu.Unlock()
+		writeBatchResults(w, http.StatusConflict, results)
+		return
+	}
+	if isDryRun(r) {
+		cm.mu.Unlock()
+		writeDryRunBatch(w, results)
+		return
+	}
+
+	removed := make(map[string]bool, len(request.NodeIDs))
+	for i := range results {
+		removed[results[i].NodeID] = true
+		results[i].Status = "removed"
+		delete(cm.nodeHealth, healthCheckKey(clusterID, results[i].NodeID))
+	}
+	kept := make([]models.Node, 0, len(cluster.Nodes)-len(removed))
+	for _, node := range cluster.Nodes {
+		if !removed[node.ID] {
+			kept = append(kept, node)
+		}
+	}
+	cluster.Nodes = kept
+	updateClusterHealth(cluster)
+	touchCluster(cluster)
+	cm.persistCluster(cluster)
+	cm.recordRevision(requestAuthor(r), fmt.Sprintf("Removed %d nodes from cluster %s", len(results), cluster.Name))
+	cm.mu.Unlock()
+
+	for _, result := range results {
+		cm.stopNodeHealthCheck(clusterID, result.NodeID)
+		cm.events.Publish(events.New(events.NodeRemoved, clusterID, result.NodeID, map[string]interface{}{
+			"url": result.URL,
+		}))
+	}
+
+	writeBatchResults(w, http.StatusOK, results)
+}
+
+// BatchUpdateNodes changes the admin state of all the listed nodes, or of
+// none if any is unknown
+func (cm *ClusterManager) BatchUpdateNodes(w http.ResponseWriter, r *http.Request) {
+	clusterID := mux.Vars(r)["clusterId"]
+	request, ok := decodeBatchNodesRequest(w, r)
+	if !ok {
+		return
+	}
+	var errs fieldErrors
+	state := ""
+	switch {
+	case request.Enabled != nil && request.AdminState != nil:
+		errs.add("adminState", "set either enabled or adminState, not both")
+	case request.Enabled != nil && *request.Enabled:
+		state = NodeStateActive
+	case request.Enabled != nil:
+		state = NodeStateMaintenance
+	case request.AdminState != nil && validAdminState(*request.AdminState):
+		state = *request.AdminState
+	case request.AdminState != nil:
+		errs.add("adminState", "must be active, draining or maintenance")
+	default:
+		errs.add("adminState", "enabled or adminState is required")
+	}
+	drainTimeout, drainThen := parseDrainOptions(&errs, request.DrainTimeout, request.DrainThen)
+	if errs.write(w) {
+		return
+	}
+
+	cm.mu.Lock()
+	cluster, exists := cm.clusters[clusterID]
+	if !exists {
+		cm.mu.Unlock()
+		writeError(w, http.StatusNotFound, "Cluster not found")
+		return
+	}
+	results, found := resolveBatchNodes(cluster, request.NodeIDs)
+	if !found {
+		cm.mu.Unlock()
+		writeBatchResults(w, http.StatusBadRequest, results)
+		return
+	}
+	// Drained managed nodes would only be discovered or registered again
+	if state == NodeStateDraining && drainThen == DrainThenRemove && !rejectManagedNodes(cluster, results) {
+		cm.mu.Unlock()
+		writeBatchResults(w, http.StatusConflict, results)
+		return
+	}
+	if isDryRun(r) {
+		for i := range results {
+			preview := *findNode(cluster, results[i].NodeID)
+			preview.RequestTimestamps = nil
+			if state == NodeStateDraining {
+				previewDrain(&preview, drainTimeout, drainThen)
+			} else {
+				setAdminState(&preview, state)
+			}
+			results[i].Node = &preview
+		}
+		cm.mu.Unlock()
+		writeDryRunBatch(w, results)
+		return
+	}
+
+	var stopped, started []int
+	for i := range results {
+		node := findNode(cluster, results[i].NodeID)
+		stop, start := cm.changeAdminState(cluster, node, state, drainTimeout, drainThen)
+		if stop {
+			stopped = append(stopped, i)
+		}
+		if start {
+			started = append(started, i)
+		}
+		results[i].Status = "updated"
+	}
+	updateClusterHealth(cluster)
+	touchCluster(cluster)
+	cm.persistCluster(cluster)
+	cm.recordRevision(requestAuthor(r), fmt.Sprintf("Set %d nodes in cluster %s to %s", len(results), cluster.Name, state))
+	cfg := cm.healthCheckConfigFor(cluster)
+	cm.mu.Unlock()
+
+	for _, i := range stopped {
+		cm.stopNodeHealthCheck(clusterID, results[i].NodeID)
+	}
+	// Nodes back from maintenance are checked right away, like new nodes
+	if usesActiveChecks(cfg.mode) {
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, MaxConcurrentHealthChecks)
+		for _, i := range started {
+			wg.Add(1)
+			go func(result *BatchNodeResult) {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				probe := cm.probeNode(context.Background(), result.URL, cfg)
+				cm.updateNodeHealthStatus(clusterID, result.NodeID, probe)
+			}(&results[i])
+		}
+		wg.Wait()
+	}
+	for _, i := range started {
+		cm.startNodeHealthCheck(clusterID, results[i].NodeID, results[i].URL, cfg)
+	}
+
+	writeBatchResults(w, http.StatusOK, results)
+}
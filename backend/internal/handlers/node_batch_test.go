@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseNodesCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		want    []BatchNode
+		wantErr string
+	}{
+		{
+			name: "default columns",
+			csv:  "http://10.0.0.1:8080,2,zone=a;tier=web\nhttp://10.0.0.2:8080\n",
+			want: []BatchNode{
+				{URL: "http://10.0.0.1:8080", Weight: 2, Labels: map[string]string{"zone": "a", "tier": "web"}},
+				{URL: "http://10.0.0.2:8080"},
+			},
+		},
+		{
+			name: "header picks the column order",
+			csv:  " URL ,labels,weight\nhttp://10.0.0.1:8080,zone = b,3\n",
+			want: []BatchNode{
+				{URL: "http://10.0.0.1:8080", Weight: 3, Labels: map[string]string{"zone": "b"}},
+			},
+		},
+		{
+			name: "header without optional columns",
+			csv:  "url\nhttp://10.0.0.1:8080\n",
+			want: []BatchNode{{URL: "http://10.0.0.1:8080"}},
+		},
+		{
+			name: "empty",
+			csv:  "",
+			want: []BatchNode{},
+		},
+		{
+			name:    "invalid weight",
+			csv:     "http://10.0.0.1:8080,1\nhttp://10.0.0.2:8080,heavy\n",
+			wantErr: `row 2: invalid weight "heavy"`,
+		},
+		{
+			name:    "label without a value",
+			csv:     "http://10.0.0.1:8080,1,zone\n",
+			wantErr: "row 1: labels must be key=value pairs",
+		},
+		{
+			name:    "label without a key",
+			csv:     "http://10.0.0.1:8080,1,=a\n",
+			wantErr: "row 1: labels must be key=value pairs",
+		},
+		{
+			name:    "malformed CSV",
+			csv:     "\"http://10.0.0.1:8080\n",
+			wantErr: "invalid CSV",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			nodes, err := parseNodesCSV([]byte(test.csv))
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(nodes, test.want) {
+				t.Errorf("got %+v, want %+v", nodes, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/CpBruceMeena/go-balance/internal/config"
+	"github.com/CpBruceMeena/go-balance/internal/events"
+	"github.com/CpBruceMeena/go-balance/internal/models"
+)
+
+const (
+	// Node admin states set by operators, independent of health
+	NodeStateActive      = "active"
+	NodeStateDraining    = "draining"    // no new requests except sticky sessions
+	NodeStateMaintenance = "maintenance" // out of rotation and not health checked
+
+	// What happens to a node once it has drained
+	DrainThenMaintenance = "maintenance"
+	DrainThenRemove      = "remove"
+
+	DefaultDrainTimeout = 30 // seconds
+	DrainPollInterval   = time.Second
+
+	// StickyCookie pins a client to a node ID. The proxy sets it for clusters
+	// with sticky sessions; backends of other clusters may set it themselves.
+	StickyCookie = "gobalance-node"
+)
+
+// adminState returns a node's admin state. Nodes saved before admin states
+// existed only carry the Disabled flag.
+func adminState(node *models.Node) string {
+	switch {
+	case node.AdminState != "":
+		return node.AdminState
+	case node.Disabled:
+		return NodeStateMaintenance
+	default:
+		return NodeStateActive
+	}
+}
+
+func validAdminState(state string) bool {
+	return state == NodeStateActive || state == NodeStateDraining || state == NodeStateMaintenance
+}
+
+// setAdminState moves a node to state, keeping Disabled in step with
+// maintenance so configuration files and older clients keep working
+func setAdminState(node *models.Node, state string) {
+	node.AdminState = state
+	node.Disabled = state == NodeStateMaintenance
+	if state != NodeStateDraining {
+		node.DrainDeadline = nil
+		node.DrainThen = ""
+	}
+}
+
+// adminStateChanged applies the health side effects of a node having left
+// admin state from, reporting whether its health checks must be stopped or
+// started. Callers must hold cm.mu.
+func (cm *ClusterManager) adminStateChanged(cluster *models.Cluster, node *models.Node, from string) (stop, start bool) {
+	to := adminState(node)
+	if (from == NodeStateMaintenance) == (to == NodeStateMaintenance) {
+		updateClusterHealth(cluster)
+		return false, false
+	}
+
+	// Health isn't tracked in maintenance, so the node starts over either way
+	delete(cm.nodeHealth, healthCheckKey(cluster.ID, node.ID))
+	node.IsActive = false
+	node.ConsecutiveSuccesses = 0
+	node.ConsecutiveFailures = 0
+	node.Flapping = false
+	if to == NodeStateMaintenance {
+		node.HealthStatus = NodeStateMaintenance
+		updateClusterHealth(cluster)
+		return true, false
+	}
+	node.HealthStatus = ""
+	// Heartbeat-only nodes stay unhealthy until their next heartbeat
+	if !usesActiveChecks(cluster.HealthCheckMode) {
+		cm.refreshNodeHealth(cluster, node, cm.nodeHealthFor(cluster.ID, node), time.Now())
+	}
+	updateClusterHealth(cluster)
+	return false, true
+}
+
+// changeAdminState moves a node to state, draining it for timeout seconds
+// first when state is draining, and reports whether its health checks must
+// be stopped or started. Callers must hold cm.mu.
+func (cm *ClusterManager) changeAdminState(cluster *models.Cluster, node *models.Node, state string, timeout int, then string) (stop, start bool) {
+	from := adminState(node)
+	if state == NodeStateDraining {
+		cm.startDrain(cluster, node, timeout, then)
+	} else {
+		setAdminState(node, state)
+	}
+	return cm.adminStateChanged(cluster, node, from)
+}
+
+// startDrain puts a node into draining until timeout has passed and its
+// in-flight requests have finished, then applies then. Draining a node again
+// only updates the drain settings. Callers must hold cm.mu.
+func (cm *ClusterManager) startDrain(cluster *models.Cluster, node *models.Node, timeout int, then string) {
+	previewDrain(node, timeout, then)
+	cm.ensureDrainWatcher(cluster.ID, node.ID)
+}
+
+// ensureDrainWatcher starts watching a draining node unless a watcher
+// already is. Callers must hold cm.mu.
+func (cm *ClusterManager) ensureDrainWatcher(clusterID, nodeID string) {
+	key := healthCheckKey(clusterID, nodeID)
+	if cm.drainWatchers[key] {
+		return
+	}
+	cm.drainWatchers[key] = true
+	go cm.watchDrain(clusterID, nodeID)
+}
+
+// previewDrain sets the drain fields of a node without watching the drain,
+// so dry runs can show a node as it would look
+func previewDrain(node *models.Node, timeout int, then string) {
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+	setAdminState(node, NodeStateDraining)
+	node.DrainDeadline = &deadline
+	node.DrainThen = then
+}
+
+// parseDrainOptions reads a drain timeout in seconds and what to do with the
+// node afterwards, applying defaults for empty values. Problems are added to
+// errs under the drainTimeout and drainThen fields.
+func parseDrainOptions(errs *fieldErrors, timeout *int, then string) (int, string) {
+	seconds := DefaultDrainTimeout
+	if timeout != nil {
+		errs.inRange("drainTimeout", *timeout, 0, config.MaxInterval)
+		seconds = *timeout
+	}
+	switch then {
+	case "":
+		then = DrainThenMaintenance
+	case DrainThenMaintenance, DrainThenRemove:
+	default:
+		errs.add("drainThen", "must be %s or %s", DrainThenMaintenance, DrainThenRemove)
+	}
+	return seconds, then
+}
+
+// drainTimeoutQuery reads ?timeout= for drains started by DeleteNode
+func drainTimeoutQuery(r *http.Request, errs *fieldErrors) int {
+	value := r.URL.Query().Get("timeout")
+	if value == "" {
+		return DefaultDrainTimeout
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil {
+		errs.add("timeout", "must be an integer")
+		return 0
+	}
+	errs.inRange("timeout", seconds, 0, config.MaxInterval)
+	return seconds
+}
+
+// watchDrain polls a draining node until its drain completes, or until it is
+// removed or moved to another admin state
+func (cm *ClusterManager) watchDrain(clusterID, nodeID string) {
+	ticker := time.NewTicker(DrainPollInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if cm.finishDrain(clusterID, nodeID, now) {
+			return
+		}
+	}
+}
+
+// finishDrain completes a drain once the deadline has passed and no requests
+// are in flight, reporting whether the node no longer needs watching
+func (cm *ClusterManager) finishDrain(clusterID, nodeID string, now time.Time) bool {
+	cm.mu.Lock()
+	cluster, exists := cm.clusters[clusterID]
+	node := findNode(cluster, nodeID)
+	if !exists || node == nil || adminState(node) != NodeStateDraining {
+		delete(cm.drainWatchers, healthCheckKey(clusterID, nodeID))
+		cm.mu.Unlock()
+		return true
+	}
+	if (node.DrainDeadline != nil && now.Before(*node.DrainDeadline)) || node.InFlight > 0 {
+		cm.mu.Unlock()
+		return false
+	}
+
+	url := node.URL
+	var event events.Event
+	if node.DrainThen == DrainThenRemove {
+		kept := make([]models.Node, 0, len(cluster.Nodes)-1)
+		for _, other := range cluster.Nodes {
+			if other.ID != nodeID {
+				kept = append(kept, other)
+			}
+		}
+		cluster.Nodes = kept
+		delete(cm.nodeHealth, healthCheckKey(clusterID, nodeID))
+		updateClusterHealth(cluster)
+		event = events.New(events.NodeRemoved, clusterID, nodeID, map[string]interface{}{
+			"url": url,
+		})
+	} else {
+		setAdminState(node, NodeStateMaintenance)
+		cm.adminStateChanged(cluster, node, NodeStateDraining)
+	}
+	delete(cm.drainWatchers, healthCheckKey(clusterID, nodeID))
+	touchCluster(cluster)
+	cm.persistCluster(cluster)
+	action := fmt.Sprintf("Drained node %s in cluster %s", url, cluster.Name)
+	cm.recordRevision("system", action)
+	cm.mu.Unlock()
+
+	cm.stopNodeHealthCheck(clusterID, nodeID)
+	if event.Type != "" {
+		cm.events.Publish(event)
+	}
+	log.Print(action)
+	return true
+}
+
+// acquireNode counts a request being proxied to a node. Callers must hold cm.mu.
+func acquireNode(cluster *models.Cluster, nodeID string) {
+	if node := findNode(cluster, nodeID); node != nil {
+		node.InFlight++
+	}
+}
+
+// releaseNode ends a request counted by acquireNode. The node is looked up
+// again because it may have been moved or removed meanwhile.
+func (cm *ClusterManager) releaseNode(cluster *models.Cluster, nodeID string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if node := findNode(cluster, nodeID); node != nil && node.InFlight > 0 {
+		node.InFlight--
+	}
+}
+
+// stickyCookie pins the client to nodeID for requests under path
+func stickyCookie(path, nodeID string) *http.Cookie {
+	return &http.Cookie{
+		Name:     StickyCookie,
+		Value:    nodeID,
+		Path:     path,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// stickyNode returns the node a request is pinned to by StickyCookie, if it
+// may still receive it. Draining nodes keep their sticky sessions until the
+// drain deadline. Callers must hold cm.mu.
+func stickyNode(r *http.Request, cluster *models.Cluster, now time.Time) *models.Node {
+	cookie, err := r.Cookie(StickyCookie)
+	if err != nil {
+		return nil
+	}
+	node := findNode(cluster, cookie.Value)
+	if node == nil {
+		return nil
+	}
+	switch adminState(node) {
+	case NodeStateActive:
+		if routable(node, cluster.PanicMode) {
+			return node
+		}
+	case NodeStateDraining:
+		if (node.IsActive || cluster.PanicMode) && node.DrainDeadline != nil && now.Before(*node.DrainDeadline) {
+			return node
+		}
+	}
+	return nil
+}
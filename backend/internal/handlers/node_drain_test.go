@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CpBruceMeena/go-balance/internal/models"
+)
+
+func TestDrainingAgainKeepsOneWatcher(t *testing.T) {
+	cluster := &models.Cluster{
+		ID:    "1",
+		Nodes: []models.Node{{ID: "a", IsActive: true, AdminState: NodeStateActive}},
+	}
+	cm := &ClusterManager{
+		clusters:      map[string]*models.Cluster{cluster.ID: cluster},
+		nodeHealth:    make(map[string]*nodeHealth),
+		drainWatchers: make(map[string]bool),
+	}
+	key := healthCheckKey(cluster.ID, "a")
+
+	cm.mu.Lock()
+	node := &cluster.Nodes[0]
+	cm.changeAdminState(cluster, node, NodeStateDraining, 60, DrainThenMaintenance)
+	cm.changeAdminState(cluster, node, NodeStateDraining, 120, DrainThenRemove)
+	if len(cm.drainWatchers) != 1 || !cm.drainWatchers[key] {
+		t.Errorf("got drain watchers %v, want only %s", cm.drainWatchers, key)
+	}
+	if node.DrainThen != DrainThenRemove || time.Until(*node.DrainDeadline) < 60*time.Second {
+		t.Errorf("draining again didn't update the drain settings: %+v", node)
+	}
+	cm.changeAdminState(cluster, node, NodeStateActive, 0, "")
+	cm.mu.Unlock()
+
+	// The watcher stops once the node has left draining, so a later drain
+	// starts a new one
+	if !cm.finishDrain(cluster.ID, "a", time.Now()) {
+		t.Fatal("watcher kept watching a node that left draining")
+	}
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if len(cm.drainWatchers) != 0 {
+		t.Errorf("got drain watchers %v after the drain ended, want none", cm.drainWatchers)
+	}
+}
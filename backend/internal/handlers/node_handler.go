@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CpBruceMeena/go-balance/internal/config"
+	"github.com/CpBruceMeena/go-balance/internal/models"
+	"github.com/gorilla/mux"
+)
+
+// PatchNodeRequest updates a node in place; nil fields are left unchanged
+type PatchNodeRequest struct {
+	URL    *string `json:"url"`
+	Weight *int    `json:"weight"`
+	// Replaces all labels; an empty object clears them
+	Labels map[string]string `json:"labels"`
+	// Shorthand for adminState active (true) or maintenance (false)
+	Enabled *bool `json:"enabled"`
+	// active, draining or maintenance; draining uses the drain settings below
+	AdminState   *string `json:"adminState"`
+	DrainTimeout *int    `json:"drainTimeout"` // seconds sticky sessions are honoured
+	DrainThen    string  `json:"drainThen"`    // maintenance (default) or remove
+}
+
+// nodeURLConflict reports a URL already used by a node of cluster other than
+// nodeID. Callers must hold cm.mu.
+func nodeURLConflict(cluster *models.Cluster, nodeID, url string) *config.FieldError {
+	for _, other := range cluster.Nodes {
+		if other.ID != nodeID && other.URL == url {
+			return &config.FieldError{Field: "url", Message: "is already used by node " + other.ID}
+		}
+	}
+	return nil
+}
+
+// GetCluster returns a single cluster with its resource version as ETag
+func (cm *ClusterManager) GetCluster(w http.ResponseWriter, r *http.Request) {
+	clusterID := mux.Vars(r)["clusterId"]
+
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	cluster, exists := cm.clusters[clusterID]
+	if !exists {
+		writeError(w, http.StatusNotFound, "Cluster not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", clusterETag(cluster))
+	json.NewEncoder(w).Encode(cluster)
+}
+
+// GetNode returns a single node
+func (cm *ClusterManager) GetNode(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	clusterID := vars["clusterId"]
+	nodeID := vars["nodeId"]
+
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	cluster, exists := cm.clusters[clusterID]
+	if !exists {
+		writeError(w, http.StatusNotFound, "Cluster not found")
+		return
+	}
+	for _, node := range cluster.Nodes {
+		if node.ID == nodeID {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("ETag", clusterETag(cluster))
+			json.NewEncoder(w).Encode(node)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "Node not found")
+}
+
+// PatchNode updates a node's URL, weight, labels and admin state without
+// resetting its request stats. Health checks are only restarted when the URL
+// changes or the node leaves maintenance. An If-Match header, when present,
+// must match the cluster's ETag.
+func (cm *ClusterManager) PatchNode(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	clusterID := vars["clusterId"]
+	nodeID := vars["nodeId"]
+
+	var request PatchNodeRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	var errs fieldErrors
+	if request.URL != nil {
+		trimmed := strings.TrimSpace(*request.URL)
+		request.URL = &trimmed
+		errs.url("url", trimmed, true)
+	}
+	if request.Weight != nil {
+		errs.inRange("weight", *request.Weight, 1, config.MaxWeight)
+	}
+	state := ""
+	if request.Enabled != nil {
+		state = NodeStateMaintenance
+		if *request.Enabled {
+			state = NodeStateActive
+		}
+	}
+	if request.AdminState != nil {
+		state = *request.AdminState
+		switch {
+		case request.Enabled != nil:
+			errs.add("adminState", "set either enabled or adminState, not both")
+		case !validAdminState(state):
+			errs.add("adminState", "must be active, draining or maintenance")
+		}
+	}
+	drainTimeout, drainThen := parseDrainOptions(&errs, request.DrainTimeout, request.DrainThen)
+	if errs.write(w) {
+		return
+	}
+
+	cm.mu.Lock()
+	cluster, exists := cm.clusters[clusterID]
+	if !exists {
+		cm.mu.Unlock()
+		writeError(w, http.StatusNotFound, "Cluster not found")
+		return
+	}
+	if r.Header.Get("If-Match") != "" && !checkClusterVersion(w, r, cluster, nil) {
+		cm.mu.Unlock()
+		return
+	}
+	var node *models.Node
+	for i := range cluster.Nodes {
+		if cluster.Nodes[i].ID == nodeID {
+			node = &cluster.Nodes[i]
+			break
+		}
+	}
+	if node == nil {
+		cm.mu.Unlock()
+		writeError(w, http.StatusNotFound, "Node not found")
+		return
+	}
+
+	if managedNode(node) {
+		// Discovery or the node's lease owns its URL, weight and labels; its
+		// admin state may still change
+		var managed fieldErrors
+		message := "can't be changed: node " + managedNodeMessage(node)
+		if request.URL != nil {
+			managed.add("url", "%s", message)
+		}
+		if request.Weight != nil {
+			managed.add("weight", "%s", message)
+		}
+		if request.Labels != nil {
+			managed.add("labels", "%s", message)
+		}
+		if state == NodeStateDraining && drainThen == DrainThenRemove {
+			managed.add("drainThen", "%s", message)
+		}
+		if len(managed) > 0 {
+			cm.mu.Unlock()
+			writeError(w, http.StatusConflict, "Node "+managedNodeMessage(node), managed...)
+			return
+		}
+	}
+
+	urlChanged := request.URL != nil && *request.URL != node.URL
+	if urlChanged {
+		if conflict := nodeURLConflict(cluster, nodeID, *request.URL); conflict != nil {
+			cm.mu.Unlock()
+			writeError(w, http.StatusConflict, "Node conflicts with an existing node", *conflict)
+			return
+		}
+	}
+	if isDryRun(r) {
+		preview := *node
+		cm.mu.Unlock()
+		if urlChanged {
+			preview.URL = *request.URL
+		}
+		if request.Weight != nil {
+			preview.Weight = *request.Weight
+		}
+		if request.Labels != nil {
+			preview.Labels = copyLabels(request.Labels)
+		}
+		if state == NodeStateDraining {
+			previewDrain(&preview, drainTimeout, drainThen)
+		} else if state != "" {
+			setAdminState(&preview, state)
+		}
+		writeDryRun(w, preview)
+		return
+	}
+
+	var changes []string
+	if urlChanged {
+		changes = append(changes, fmt.Sprintf("url %s -> %s", node.URL, *request.URL))
+		node.URL = *request.URL
+		// The new target has no health history; its state is decided by the
+		// first probe below
+		delete(cm.nodeHealth, healthCheckKey(clusterID, nodeID))
+		node.HealthStatus = ""
+		node.IsActive = false
+		node.ConsecutiveSuccesses = 0
+		node.ConsecutiveFailures = 0
+		node.Flapping = false
+		node.CertExpiresAt = time.Time{}
+		if adminState(node) == NodeStateMaintenance {
+			node.HealthStatus = NodeStateMaintenance
+		}
+	}
+	if request.Weight != nil && *request.Weight != node.Weight {
+		changes = append(changes, fmt.Sprintf("weight %d -> %d", node.Weight, *request.Weight))
+		node.Weight = *request.Weight
+	}
+	if request.Labels != nil && !sameLabels(node.Labels, request.Labels) {
+		changes = append(changes, "labels")
+		node.Labels = copyLabels(request.Labels)
+	}
+	var stopChecks, startChecks bool
+	// Draining again restarts the drain with the new settings
+	if state != "" && (state != adminState(node) || state == NodeStateDraining) {
+		changes = append(changes, fmt.Sprintf("admin state %s -> %s", adminState(node), state))
+		stopChecks, startChecks = cm.changeAdminState(cluster, node, state, drainTimeout, drainThen)
+	}
+	maintenance := adminState(node) == NodeStateMaintenance
+
+	cfg := cm.healthCheckConfigFor(cluster)
+	nodeURL := node.URL
+	if urlChanged && !usesActiveChecks(cfg.mode) {
+		cm.refreshNodeHealth(cluster, node, cm.nodeHealthFor(clusterID, node), time.Now())
+	}
+	if len(changes) > 0 {
+		updateClusterHealth(cluster)
+		touchCluster(cluster)
+		cm.persistCluster(cluster)
+		cm.recordRevision(requestAuthor(r), fmt.Sprintf("Updated node %s in cluster %s: %s", nodeURL, cluster.Name, strings.Join(changes, ", ")))
+	}
+	cm.mu.Unlock()
+
+	switch {
+	case maintenance && (urlChanged || stopChecks):
+		cm.stopNodeHealthCheck(clusterID, nodeID)
+	case urlChanged || startChecks:
+		// Probe the new URL right away, then reschedule; this cancels any
+		// probe still running against the old URL
+		cm.stopNodeHealthCheck(clusterID, nodeID)
+		if usesActiveChecks(cfg.mode) {
+			cm.updateNodeHealthStatus(clusterID, nodeID, cm.probeNode(r.Context(), nodeURL, cfg))
+		}
+		cm.startNodeHealthCheck(clusterID, nodeID, nodeURL, cfg)
+	}
+
+	cm.GetNode(w, r)
+}
@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/CpBruceMeena/go-balance/internal/models"
+	"github.com/CpBruceMeena/go-balance/internal/store"
+)
+
+// UseStore makes the cluster manager persist every configuration change to s.
+// Clusters already saved in s are restored and their health checks and
+// drains resumed.
+func UseStore(s store.Store) error {
+	return clusterManager.useStore(s)
+}
+
+func (cm *ClusterManager) useStore(s store.Store) error {
+	clusters, err := s.Load()
+	if err != nil {
+		return err
+	}
+
+	cm.mu.Lock()
+	cm.store = s
+	now := time.Now()
+	for i := range clusters {
+		cluster := &clusters[i]
+		applyHealthCheckDefaults(cluster)
+		if cluster.Nodes == nil {
+			cluster.Nodes = make([]models.Node, 0)
+		}
+		for j := range cluster.Nodes {
+			node := &cluster.Nodes[j]
+			node.RequestTimestamps = []time.Time{}
+			node.InFlight = 0
+			setAdminState(node, adminState(node))
+			if adminState(node) == NodeStateDraining {
+				cm.ensureDrainWatcher(cluster.ID, node.ID)
+			}
+			if node.LeaseID != "" {
+				// Renewals aren't persisted, so leases get a full TTL to be renewed
+				renewLease(node, now)
+			}
+			if node.Disabled {
+				node.IsActive = false
+				node.HealthStatus = NodeStateMaintenance
+			}
+		}
+		updateClusterHealth(cluster)
+
+		checker, err := newHealthCheckerFor(cluster.HealthCheckTLS)
+		if err != nil {
+			log.Printf("Cluster %s: invalid health check TLS settings, using defaults: %v", cluster.ID, err)
+		}
+		cm.clusters[cluster.ID] = cluster
+		cm.setHealthChecker(cluster.ID, checker)
+	}
+	cm.assignMissingSlugs()
+	if templates, ok := s.(store.TemplateStore); ok {
+		if err := cm.loadTemplates(templates); err != nil {
+			log.Printf("Failed to load cluster templates: %v", err)
+		}
+	}
+	if history, ok := s.(store.HistoryStore); ok {
+		audit.useDefault(history)
+		if cm.history == nil {
+			cm.history = history
+		}
+	}
+	if cm.history != nil {
+		if err := cm.loadRevisions(cm.history); err != nil {
+			log.Printf("Failed to load configuration revisions: %v", err)
+		}
+		cm.webhooks.UseHistory(cm.history)
+	}
+	if webhooks, ok := s.(store.WebhookStore); ok {
+		loaded, err := webhooks.LoadWebhooks()
+		if err != nil {
+			log.Printf("Failed to load webhooks: %v", err)
+		}
+		cm.webhooks.Restore(loaded)
+	}
+	// Revisions are only recorded after changes, so take one of the restored
+	// state if it differs from the latest (or there is none yet)
+	if len(clusters) > 0 {
+		cm.recordRevision("system", "Restored configuration from store")
+	}
+	cm.mu.Unlock()
+
+	cm.mu.RLock()
+	for _, cluster := range cm.clusters {
+		cfg := cm.healthCheckConfigFor(cluster)
+		for _, node := range cluster.Nodes {
+			if node.LeaseID != "" {
+				cm.scheduleLeaseExpiry(cluster.ID, node.ID, node.LeaseTTL)
+			}
+			if adminState(&node) == NodeStateMaintenance {
+				continue
+			}
+			cm.startNodeHealthCheck(cluster.ID, node.ID, node.URL, cfg)
+		}
+	}
+	cm.mu.RUnlock()
+	cm.syncDiscovery()
+	log.Printf("Restored %d clusters from store", len(clusters))
+
+	if _, ok := s.(store.HistoryStore); ok {
+		go cm.sampleStats()
+	}
+	return nil
+}
+
+// Shutdown stops health checks, lease expiry and discovery and detaches the
+// store and history once queued writes are applied, so nothing is written to
+// them once they are closed
+func Shutdown() {
+	clusterManager.shutdown()
+}
+
+func (cm *ClusterManager) shutdown() {
+	cm.healthScheduler.Stop()
+	cm.leaseScheduler.Stop()
+
+	cm.mu.Lock()
+	for clusterID, runner := range cm.discoveries {
+		runner.cancel()
+		delete(cm.discoveries, clusterID)
+	}
+	cm.store = nil
+	cm.history = nil
+	cm.mu.Unlock()
+	// Writes queued before the store was detached still reach it
+	cm.writes.flush()
+
+	// Deliveries still being retried are only logged in memory
+	cm.webhooks.UseHistory(nil)
+	audit.mu.Lock()
+	audit.history = nil
+	audit.mu.Unlock()
+}
+
+// snapshotCluster copies a cluster so the store never shares slices with
+// live state that probes and the proxy keep mutating
+func snapshotCluster(cluster *models.Cluster) models.Cluster {
+	snapshot := *cluster
+	snapshot.RequestTimestamps = nil
+	snapshot.Nodes = make([]models.Node, len(cluster.Nodes))
+	copy(snapshot.Nodes, cluster.Nodes)
+	for i := range snapshot.Nodes {
+		snapshot.Nodes[i].RequestTimestamps = nil
+		snapshot.Nodes[i].Labels = copyLabels(snapshot.Nodes[i].Labels)
+	}
+	if cluster.HealthCheckTLS != nil {
+		settings := *cluster.HealthCheckTLS
+		snapshot.HealthCheckTLS = &settings
+	}
+	snapshot.Discovery = copyDiscovery(cluster.Discovery)
+	if cluster.Registration != nil {
+		registration := *cluster.Registration
+		snapshot.Registration = &registration
+	}
+	if cluster.HeartbeatAuth != nil {
+		auth := *cluster.HeartbeatAuth
+		snapshot.HeartbeatAuth = &auth
+	}
+	return snapshot
+}
+
+// storeWriter applies store writes outside cm.mu, so disk I/O never holds
+// up proxying. Writes are queued under cm.mu and applied in that order by a
+// single flush at a time; queued writes with the same key are coalesced
+// into the latest one.
+type storeWriter struct {
+	mu        sync.Mutex
+	queue     []queuedWrite
+	queued    map[string]int // index in queue by key
+	scheduled bool
+	// Held while a batch is applied, so batches never overlap
+	applying sync.Mutex
+}
+
+type queuedWrite struct {
+	key   string
+	write func()
+}
+
+// enqueue queues write and schedules a flush. An empty key is never coalesced.
+func (sw *storeWriter) enqueue(key string, write func()) {
+	sw.mu.Lock()
+	if i, exists := sw.queued[key]; exists && key != "" {
+		sw.queue[i].write = write
+	} else {
+		if sw.queued == nil {
+			sw.queued = make(map[string]int)
+		}
+		sw.queued[key] = len(sw.queue)
+		sw.queue = append(sw.queue, queuedWrite{key: key, write: write})
+	}
+	start := !sw.scheduled
+	sw.scheduled = true
+	sw.mu.Unlock()
+
+	if start {
+		go sw.flush()
+	}
+}
+
+// flush applies every queued write and returns once they are done
+func (sw *storeWriter) flush() {
+	sw.applying.Lock()
+	defer sw.applying.Unlock()
+
+	sw.mu.Lock()
+	queue := sw.queue
+	sw.queue = nil
+	sw.queued = nil
+	sw.scheduled = false
+	sw.mu.Unlock()
+
+	for _, queued := range queue {
+		queued.write()
+	}
+}
+
+// persistCluster saves a snapshot of a cluster after a configuration change.
+// Callers must hold cm.mu so that saves are queued in mutation order.
+func (cm *ClusterManager) persistCluster(cluster *models.Cluster) {
+	if cm.store == nil {
+		return
+	}
+	s, snapshot := cm.store, snapshotCluster(cluster)
+	cm.writes.enqueue("cluster/"+cluster.ID, func() {
+		if err := s.SaveCluster(snapshot); err != nil {
+			log.Printf("Failed to persist cluster %s: %v", snapshot.ID, err)
+		}
+	})
+}
+
+// persistClusterDeletion removes a cluster from the store. Callers must hold cm.mu.
+func (cm *ClusterManager) persistClusterDeletion(clusterID string) {
+	if cm.store == nil {
+		return
+	}
+	s := cm.store
+	cm.writes.enqueue("cluster/"+clusterID, func() {
+		if err := s.DeleteCluster(clusterID); err != nil {
+			log.Printf("Failed to delete cluster %s from store: %v", clusterID, err)
+		}
+	})
+}
+
+// assignMissingSlugs gives clusters saved before slugs were stored the slug
+// derived from their name, suffixed when two names map to the same slug.
+// Older clusters keep the unsuffixed slug. Callers must hold cm.mu.
+func (cm *ClusterManager) assignMissingSlugs() {
+	var missing []*models.Cluster
+	for _, cluster := range cm.clusters {
+		if cluster.Slug == "" {
+			missing = append(missing, cluster)
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool {
+		return missing[i].CreatedAt.Before(missing[j].CreatedAt)
+	})
+	for _, cluster := range missing {
+		base := slugify(cluster.Name)
+		if base == "" {
+			base = slugify(cluster.ID)
+		}
+		slug := cm.uniqueSlug(base)
+		if slug != base {
+			log.Printf("Cluster %s: slug %q is taken, proxying under %q", cluster.ID, base, slug)
+		}
+		setSlug(cluster, slug, time.Now())
+		cm.persistCluster(cluster)
+	}
+}
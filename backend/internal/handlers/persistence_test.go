@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestStoreWriterKeepsOrderAndCoalesces(t *testing.T) {
+	var (
+		sw      storeWriter
+		mu      sync.Mutex
+		applied []string
+	)
+	write := func(name string) func() {
+		return func() {
+			mu.Lock()
+			applied = append(applied, name)
+			mu.Unlock()
+		}
+	}
+
+	// Block flushes until everything is queued so the batch is predictable
+	sw.applying.Lock()
+	sw.enqueue("cluster/1", write("save 1"))
+	sw.enqueue("", write("revision 1"))
+	sw.enqueue("cluster/2", write("save 2"))
+	sw.enqueue("cluster/1", write("delete 1"))
+	sw.enqueue("", write("revision 2"))
+	sw.applying.Unlock()
+	sw.flush()
+
+	want := []string{"delete 1", "revision 1", "save 2", "revision 2"}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(applied, want) {
+		t.Errorf("applied %v, want %v", applied, want)
+	}
+}
@@ -0,0 +1,481 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CpBruceMeena/go-balance/internal/config"
+	"github.com/CpBruceMeena/go-balance/internal/events"
+	"github.com/CpBruceMeena/go-balance/internal/loadbalancer"
+	"github.com/CpBruceMeena/go-balance/internal/models"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// ManagedBy of nodes that registered themselves
+	NodeManagedByRegistration = "registration"
+
+	DefaultLeaseTTL = 30 // seconds
+	MinLeaseTTL     = 5
+	// Lease checks only take the lock, so few need to run at once
+	MaxConcurrentLeaseChecks = 4
+
+	nodeTokenBytes = 32
+)
+
+// RegistrationRequest is sent by a node registering itself with a cluster
+type RegistrationRequest struct {
+	URL    string            `json:"url"`
+	Weight int               `json:"weight"` // 0 uses the default weight
+	Labels map[string]string `json:"labels"`
+	TTL    *int              `json:"ttl"` // seconds; defaults to DefaultLeaseTTL
+}
+
+// LeaseResponse tells a registered node how to keep its registration
+type LeaseResponse struct {
+	LeaseID   string    `json:"leaseId"`
+	NodeID    string    `json:"nodeId"`
+	TTL       int       `json:"ttl"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// TokenResponse returns a newly issued registration or heartbeat token. The
+// token can't be retrieved again.
+type TokenResponse struct {
+	Token    string    `json:"token,omitempty"`
+	IssuedAt time.Time `json:"issuedAt"`
+}
+
+// managedNode reports whether a node is owned by a discovery source or a
+// registration lease. Managed nodes are left out of configuration files and
+// can't be edited or removed manually.
+func managedNode(node *models.Node) bool {
+	return discoveredNode(node) || node.ManagedBy == NodeManagedByRegistration
+}
+
+func leaseKey(clusterID, nodeID string) string {
+	return fmt.Sprintf("%s-%s-lease", clusterID, nodeID)
+}
+
+func leaseResponse(node *models.Node) LeaseResponse {
+	response := LeaseResponse{LeaseID: node.LeaseID, NodeID: node.ID, TTL: node.LeaseTTL}
+	if node.LeaseExpiresAt != nil {
+		response.ExpiresAt = *node.LeaseExpiresAt
+	}
+	return response
+}
+
+// renewLease extends a node's lease by its TTL from now
+func renewLease(node *models.Node, now time.Time) {
+	expires := now.Add(time.Duration(node.LeaseTTL) * time.Second)
+	node.LeaseExpiresAt = &expires
+}
+
+// leaseEnded reports whether a leased node is being drained for removal,
+// after its lease expired or it deregistered
+func leaseEnded(node *models.Node) bool {
+	return adminState(node) == NodeStateDraining && node.DrainThen == DrainThenRemove
+}
+
+// findLease looks a leased node up by lease ID. Callers must hold cm.mu.
+func findLease(cluster *models.Cluster, leaseID string) *models.Node {
+	for i := range cluster.Nodes {
+		if cluster.Nodes[i].LeaseID != "" && cluster.Nodes[i].LeaseID == leaseID {
+			return &cluster.Nodes[i]
+		}
+	}
+	return nil
+}
+
+func hashNodeToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newNodeToken generates a token and the hash kept of it
+func newNodeToken() (token, hash string, err error) {
+	secret := make([]byte, nodeTokenBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	token = hex.EncodeToString(secret)
+	return token, hashNodeToken(token), nil
+}
+
+// checkBearerToken answers 401 with message unless the request's bearer
+// token hashes to tokenHash
+func checkBearerToken(w http.ResponseWriter, r *http.Request, tokenHash, message string) bool {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	hash := hashNodeToken(strings.TrimSpace(token))
+	if !found || subtle.ConstantTimeCompare([]byte(hash), []byte(tokenHash)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="go-balance"`)
+		writeError(w, http.StatusUnauthorized, message)
+		return false
+	}
+	return true
+}
+
+// authorizeRegistration checks the bearer token of a registration call,
+// answering 403 when the cluster doesn't accept registrations and 401 when
+// the token is missing or wrong. Callers must hold cm.mu.
+func authorizeRegistration(w http.ResponseWriter, r *http.Request, cluster *models.Cluster) bool {
+	if cluster.Registration == nil {
+		writeError(w, http.StatusForbidden, "Cluster does not accept registrations")
+		return false
+	}
+	return checkBearerToken(w, r, cluster.Registration.TokenHash, "Invalid registration token")
+}
+
+// scheduleLeaseExpiry checks twice per TTL whether a node's lease has run
+// out. The check unschedules itself once the node is gone.
+func (cm *ClusterManager) scheduleLeaseExpiry(clusterID, nodeID string, ttl int) {
+	interval := time.Duration(ttl) * time.Second / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	cm.leaseScheduler.Schedule(leaseKey(clusterID, nodeID), interval, func(ctx context.Context) {
+		cm.expireLease(clusterID, nodeID)
+	})
+}
+
+// expireLease drains and then removes a node whose lease has run out
+func (cm *ClusterManager) expireLease(clusterID, nodeID string) {
+	cm.mu.Lock()
+	cluster := cm.clusters[clusterID]
+	node := findNode(cluster, nodeID)
+	if node == nil || node.LeaseID == "" {
+		cm.mu.Unlock()
+		cm.leaseScheduler.Unschedule(leaseKey(clusterID, nodeID))
+		return
+	}
+	now := time.Now()
+	if leaseEnded(node) || node.LeaseExpiresAt == nil || now.Before(*node.LeaseExpiresAt) {
+		cm.mu.Unlock()
+		return
+	}
+
+	_, start := cm.changeAdminState(cluster, node, NodeStateDraining, DefaultDrainTimeout, DrainThenRemove)
+	touchCluster(cluster)
+	cm.persistCluster(cluster)
+	leaseID, url := node.LeaseID, node.URL
+	cfg := cm.healthCheckConfigFor(cluster)
+	cm.mu.Unlock()
+
+	if start {
+		cm.startNodeHealthCheck(clusterID, nodeID, url, cfg)
+	}
+	log.Printf("Cluster %s: lease %s of node %s expired, draining it", clusterID, leaseID, url)
+}
+
+// CreateRegistrationToken issues a token nodes use to register with a
+// cluster, replacing the previous one. Nodes already registered keep their
+// leases but can only renew them with the new token.
+func (cm *ClusterManager) CreateRegistrationToken(w http.ResponseWriter, r *http.Request) {
+	clusterID := mux.Vars(r)["clusterId"]
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cluster, exists := cm.clusters[clusterID]
+	if !exists {
+		writeError(w, http.StatusNotFound, "Cluster not found")
+		return
+	}
+	now := time.Now()
+	if isDryRun(r) {
+		writeDryRun(w, TokenResponse{IssuedAt: now})
+		return
+	}
+
+	token, hash, err := newNodeToken()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+	cluster.Registration = &models.Registration{TokenHash: hash, IssuedAt: now}
+	touchCluster(cluster)
+	cm.persistCluster(cluster)
+	log.Printf("Cluster %s: issued a new registration token", clusterID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(TokenResponse{Token: token, IssuedAt: now})
+}
+
+// DeleteRegistrationToken stops a cluster from accepting registrations.
+// Registered nodes can no longer renew, so they are removed as their leases
+// expire.
+func (cm *ClusterManager) DeleteRegistrationToken(w http.ResponseWriter, r *http.Request) {
+	clusterID := mux.Vars(r)["clusterId"]
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cluster, exists := cm.clusters[clusterID]
+	if !exists {
+		writeError(w, http.StatusNotFound, "Cluster not found")
+		return
+	}
+	if cluster.Registration == nil {
+		writeError(w, http.StatusNotFound, "Registration is not enabled")
+		return
+	}
+	if isDryRun(r) {
+		writeDryRun(w, cluster.Registration)
+		return
+	}
+	cluster.Registration = nil
+	touchCluster(cluster)
+	cm.persistCluster(cluster)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Register adds a node that registers itself and leases it for the requested
+// TTL. Registering a URL that already holds a lease renews that lease with
+// the new weight, labels and TTL, taking the node back if it was being
+// removed.
+func (cm *ClusterManager) Register(w http.ResponseWriter, r *http.Request) {
+	clusterID := mux.Vars(r)["clusterId"]
+
+	var request RegistrationRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+
+	cm.mu.Lock()
+	cluster, exists := cm.clusters[clusterID]
+	if !exists {
+		cm.mu.Unlock()
+		writeError(w, http.StatusNotFound, "Cluster not found")
+		return
+	}
+	if !authorizeRegistration(w, r, cluster) {
+		cm.mu.Unlock()
+		return
+	}
+
+	request.URL = strings.TrimSpace(request.URL)
+	var errs fieldErrors
+	errs.url("url", request.URL, true)
+	errs.inRange("weight", request.Weight, 0, config.MaxWeight)
+	ttl := DefaultLeaseTTL
+	if request.TTL != nil {
+		ttl = *request.TTL
+		errs.inRange("ttl", ttl, MinLeaseTTL, config.MaxInterval)
+	}
+	if errs.write(w) {
+		cm.mu.Unlock()
+		return
+	}
+
+	for i := range cluster.Nodes {
+		node := &cluster.Nodes[i]
+		if node.URL != request.URL {
+			continue
+		}
+		if node.ManagedBy != NodeManagedByRegistration {
+			cm.mu.Unlock()
+			writeError(w, http.StatusConflict, "Node conflicts with an existing node", config.FieldError{
+				Field:   "url",
+				Message: "is already used by node " + node.ID,
+			})
+			return
+		}
+		cm.reregister(w, r, cluster, node, request, ttl)
+		return
+	}
+	cfg := cm.healthCheckConfigFor(cluster)
+	cm.mu.Unlock()
+
+	node := newNode(request.URL, request.Weight, request.Labels)
+	node.ManagedBy = NodeManagedByRegistration
+	node.LeaseID = uuid.New().String()
+	node.LeaseTTL = ttl
+	renewLease(node, time.Now())
+	if isDryRun(r) {
+		writeDryRun(w, leaseResponse(node))
+		return
+	}
+
+	// Probe the node without holding the lock, as AddNode does
+	var result loadbalancer.ProbeResult
+	if usesActiveChecks(cfg.mode) {
+		result = cm.probeNode(r.Context(), node.URL, cfg)
+	}
+
+	cm.mu.Lock()
+	cluster, exists = cm.clusters[clusterID]
+	if !exists {
+		cm.mu.Unlock()
+		writeError(w, http.StatusNotFound, "Cluster not found")
+		return
+	}
+	if conflict := nodeURLConflict(cluster, "", node.URL); conflict != nil {
+		cm.mu.Unlock()
+		writeError(w, http.StatusConflict, "Node conflicts with an existing node", *conflict)
+		return
+	}
+	if usesActiveChecks(cfg.mode) {
+		cm.recordProbeResult(cluster, node, result)
+	} else {
+		cm.refreshNodeHealth(cluster, node, cm.nodeHealthFor(clusterID, node), time.Now())
+	}
+	// The lease starts once the node is added, not before the probe
+	renewLease(node, time.Now())
+	cluster.Nodes = append(cluster.Nodes, *node)
+	updateClusterHealth(cluster)
+	touchCluster(cluster)
+	cm.persistCluster(cluster)
+	cm.mu.Unlock()
+
+	cm.startNodeHealthCheck(clusterID, node.ID, node.URL, cfg)
+	cm.scheduleLeaseExpiry(clusterID, node.ID, ttl)
+	cm.events.Publish(events.New(events.NodeAdded, clusterID, node.ID, map[string]interface{}{
+		"url":     node.URL,
+		"leaseId": node.LeaseID,
+	}))
+	log.Printf("Cluster %s: node %s registered with lease %s", clusterID, node.URL, node.LeaseID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(leaseResponse(node))
+}
+
+// reregister renews the lease of a node registering again and applies its
+// new weight, labels and TTL. It unlocks cm.mu, which callers must hold.
+func (cm *ClusterManager) reregister(w http.ResponseWriter, r *http.Request, cluster *models.Cluster, node *models.Node, request RegistrationRequest, ttl int) {
+	if isDryRun(r) {
+		preview := *node
+		cm.mu.Unlock()
+		preview.LeaseTTL = ttl
+		renewLease(&preview, time.Now())
+		writeDryRun(w, leaseResponse(&preview))
+		return
+	}
+
+	changed := node.Weight != nodeWeight(request.Weight) || !sameLabels(node.Labels, request.Labels) || node.LeaseTTL != ttl
+	node.Weight = nodeWeight(request.Weight)
+	node.Labels = copyLabels(request.Labels)
+	node.LeaseTTL = ttl
+	renewLease(node, time.Now())
+	start := false
+	if leaseEnded(node) {
+		// Back before its drain finished
+		changed = true
+		_, start = cm.changeAdminState(cluster, node, NodeStateActive, 0, "")
+	}
+	if changed {
+		touchCluster(cluster)
+		cm.persistCluster(cluster)
+	}
+	response := leaseResponse(node)
+	clusterID, nodeID, url := cluster.ID, node.ID, node.URL
+	cfg := cm.healthCheckConfigFor(cluster)
+	cm.mu.Unlock()
+
+	if start {
+		cm.startNodeHealthCheck(clusterID, nodeID, url, cfg)
+	}
+	// The check interval follows the TTL
+	cm.scheduleLeaseExpiry(clusterID, nodeID, ttl)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// RenewLease extends a registered node's lease by its TTL. Renewals aren't
+// persisted; leases restored after a restart get a full TTL to be renewed.
+func (cm *ClusterManager) RenewLease(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	clusterID := vars["clusterId"]
+	leaseID := vars["leaseId"]
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cluster, exists := cm.clusters[clusterID]
+	if !exists {
+		writeError(w, http.StatusNotFound, "Cluster not found")
+		return
+	}
+	if !authorizeRegistration(w, r, cluster) {
+		return
+	}
+	node := findLease(cluster, leaseID)
+	if node == nil {
+		writeError(w, http.StatusNotFound, "Lease not found")
+		return
+	}
+	if leaseEnded(node) {
+		writeError(w, http.StatusGone, "Lease has ended; register again")
+		return
+	}
+	renewLease(node, time.Now())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(leaseResponse(node))
+}
+
+// Deregister ends a lease early, draining the node (for ?timeout= seconds)
+// and then removing it
+func (cm *ClusterManager) Deregister(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	clusterID := vars["clusterId"]
+	leaseID := vars["leaseId"]
+
+	var errs fieldErrors
+	timeout := drainTimeoutQuery(r, &errs)
+
+	cm.mu.Lock()
+	cluster, exists := cm.clusters[clusterID]
+	if !exists {
+		cm.mu.Unlock()
+		writeError(w, http.StatusNotFound, "Cluster not found")
+		return
+	}
+	if !authorizeRegistration(w, r, cluster) {
+		cm.mu.Unlock()
+		return
+	}
+	if errs.write(w) {
+		cm.mu.Unlock()
+		return
+	}
+	node := findLease(cluster, leaseID)
+	if node == nil {
+		cm.mu.Unlock()
+		writeError(w, http.StatusNotFound, "Lease not found")
+		return
+	}
+	if isDryRun(r) {
+		preview := *node
+		cm.mu.Unlock()
+		previewDrain(&preview, timeout, DrainThenRemove)
+		writeDryRun(w, preview)
+		return
+	}
+
+	start := false
+	if !leaseEnded(node) {
+		_, start = cm.changeAdminState(cluster, node, NodeStateDraining, timeout, DrainThenRemove)
+		touchCluster(cluster)
+		cm.persistCluster(cluster)
+	}
+	drained := *node
+	cfg := cm.healthCheckConfigFor(cluster)
+	cm.mu.Unlock()
+
+	if start {
+		cm.startNodeHealthCheck(clusterID, drained.ID, drained.URL, cfg)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(drained)
+}
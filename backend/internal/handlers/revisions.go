@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/CpBruceMeena/go-balance/internal/config"
+	"github.com/CpBruceMeena/go-balance/internal/models"
+	"github.com/CpBruceMeena/go-balance/internal/store"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// AuthorHeader names the operator making a change; the dashboard sets it
+	AuthorHeader = "X-GoBalance-Author"
+
+	// MaxConfigRevisions bounds the revisions kept in memory
+	MaxConfigRevisions = 1000
+)
+
+// ConfigRevision is an immutable snapshot of the full configuration taken
+// after a change
+type ConfigRevision struct {
+	Number    int          `json:"number"`
+	Author    string       `json:"author"`
+	Timestamp time.Time    `json:"timestamp"`
+	Action    string       `json:"action"`
+	Config    *config.File `json:"config,omitempty"`
+	// Cluster IDs by name, so rollbacks find clusters renamed since
+	ClusterIDs map[string]string `json:"clusterIds,omitempty"`
+}
+
+// requestAuthor identifies who made a request, falling back to its address
+func requestAuthor(r *http.Request) string {
+	if author := r.Header.Get(AuthorHeader); author != "" {
+		return author
+	}
+	return sourceIP(r)
+}
+
+// recordRevision snapshots the current configuration as a new revision
+// unless it matches the latest one. Callers must hold cm.mu.
+func (cm *ClusterManager) recordRevision(author, action string) {
+	snapshot := cm.configSnapshot()
+	ids := make(map[string]string, len(cm.clusters))
+	for _, cluster := range cm.clusters {
+		ids[cluster.Name] = cluster.ID
+	}
+	number := 1
+	if len(cm.revisions) > 0 {
+		latest := cm.revisions[len(cm.revisions)-1]
+		if reflect.DeepEqual(latest.Config, snapshot) && reflect.DeepEqual(latest.ClusterIDs, ids) {
+			return
+		}
+		number = latest.Number + 1
+	}
+
+	revision := ConfigRevision{
+		Number:     number,
+		Author:     author,
+		Timestamp:  time.Now(),
+		Action:     action,
+		Config:     snapshot,
+		ClusterIDs: ids,
+	}
+	cm.revisions = append(cm.revisions, revision)
+	if len(cm.revisions) > MaxConfigRevisions {
+		cm.revisions = cm.revisions[len(cm.revisions)-MaxConfigRevisions:]
+	}
+
+	if history := cm.history; history != nil {
+		cm.writes.enqueue("", func() {
+			if err := history.AppendRecord(store.KindRevisions, revision.Timestamp, revision); err != nil {
+				log.Printf("Failed to persist configuration revision %d: %v", number, err)
+			}
+		})
+	}
+}
+
+// loadRevisions restores revisions persisted in history. Callers must hold cm.mu.
+func (cm *ClusterManager) loadRevisions(history store.HistoryStore) error {
+	records, err := history.Records(store.KindRevisions, time.Time{}, time.Time{}, 0)
+	if err != nil {
+		return err
+	}
+	if len(records) > MaxConfigRevisions {
+		records = records[len(records)-MaxConfigRevisions:]
+	}
+	cm.revisions = make([]ConfigRevision, 0, len(records))
+	for _, record := range records {
+		var revision ConfigRevision
+		if err := json.Unmarshal(record, &revision); err != nil {
+			return err
+		}
+		cm.revisions = append(cm.revisions, revision)
+	}
+	return nil
+}
+
+// revision finds a revision by number. Callers must hold cm.mu.
+func (cm *ClusterManager) revision(number int) (ConfigRevision, bool) {
+	for _, revision := range cm.revisions {
+		if revision.Number == number {
+			return revision, true
+		}
+	}
+	return ConfigRevision{}, false
+}
+
+// clusterFromConfig builds a cluster with the settings and nodes of cc
+func clusterFromConfig(cc *config.ClusterConfig) *models.Cluster {
+	cluster := clusterSettingsFrom(cc)
+	cluster.Nodes = make([]models.Node, 0, len(cc.Nodes))
+	for _, node := range cc.Nodes {
+		clusterNode := models.Node{URL: node.URL}
+		applyNodeConfig(&clusterNode, node)
+		cluster.Nodes = append(cluster.Nodes, clusterNode)
+	}
+	return cluster
+}
+
+// diffConfigs lists the changes that turn from into to
+func diffConfigs(from, to *config.File) ConfigDiff {
+	diff := ConfigDiff{
+		Created: make([]ClusterDiff, 0),
+		Updated: make([]ClusterDiff, 0),
+		Deleted: make([]ClusterDiff, 0),
+	}
+	previous := make(map[string]*config.ClusterConfig, len(from.Clusters))
+	for i := range from.Clusters {
+		previous[from.Clusters[i].Name] = &from.Clusters[i]
+	}
+	for i := range to.Clusters {
+		cc := &to.Clusters[i]
+		old, exists := previous[cc.Name]
+		delete(previous, cc.Name)
+		if !exists {
+			created := ClusterDiff{Name: cc.Name}
+			for _, node := range cc.Nodes {
+				created.AddedNodes = append(created.AddedNodes, node.URL)
+			}
+			diff.Created = append(diff.Created, created)
+			continue
+		}
+		if clusterDiff := diffCluster(clusterFromConfig(old), cc); !clusterDiff.empty() {
+			diff.Updated = append(diff.Updated, clusterDiff)
+		}
+	}
+	for i := range from.Clusters {
+		old := &from.Clusters[i]
+		if _, removed := previous[old.Name]; !removed {
+			continue
+		}
+		deleted := ClusterDiff{Name: old.Name}
+		for _, node := range old.Nodes {
+			deleted.RemovedNodes = append(deleted.RemovedNodes, node.URL)
+		}
+		diff.Deleted = append(diff.Deleted, deleted)
+	}
+	return diff
+}
+
+// revisionNumber parses the {revision} route variable
+func revisionNumber(r *http.Request) (int, bool) {
+	number, err := strconv.Atoi(mux.Vars(r)["revision"])
+	return number, err == nil && number > 0
+}
+
+// GetConfigRevisions lists revisions newest first, without their configuration
+func (cm *ClusterManager) GetConfigRevisions(w http.ResponseWriter, r *http.Request) {
+	cm.mu.RLock()
+	revisions := make([]ConfigRevision, 0, len(cm.revisions))
+	for i := len(cm.revisions) - 1; i >= 0; i-- {
+		revision := cm.revisions[i]
+		revision.Config = nil
+		revisions = append(revisions, revision)
+	}
+	cm.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisions)
+}
+
+// GetConfigRevision returns a single revision including its configuration
+func (cm *ClusterManager) GetConfigRevision(w http.ResponseWriter, r *http.Request) {
+	number, ok := revisionNumber(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid revision number")
+		return
+	}
+
+	cm.mu.RLock()
+	revision, exists := cm.revision(number)
+	cm.mu.RUnlock()
+	if !exists {
+		writeError(w, http.StatusNotFound, "Revision not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revision)
+}
+
+// DiffConfigRevisions returns the changes between revision ?from= (defaulting
+// to the preceding revision) and the requested revision
+func (cm *ClusterManager) DiffConfigRevisions(w http.ResponseWriter, r *http.Request) {
+	number, ok := revisionNumber(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid revision number")
+		return
+	}
+	fromNumber := number - 1
+	if value := r.URL.Query().Get("from"); value != "" {
+		var err error
+		if fromNumber, err = strconv.Atoi(value); err != nil || fromNumber < 0 {
+			writeError(w, http.StatusBadRequest, "Invalid from revision number")
+			return
+		}
+	}
+
+	cm.mu.RLock()
+	to, exists := cm.revision(number)
+	// Revision 0 is the empty configuration before the first revision
+	from, fromExists := ConfigRevision{Config: &config.File{}}, fromNumber == 0
+	if fromNumber > 0 {
+		from, fromExists = cm.revision(fromNumber)
+	}
+	cm.mu.RUnlock()
+	if !exists || !fromExists {
+		writeError(w, http.StatusNotFound, "Revision not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"from": fromNumber,
+		"to":   number,
+		"diff": diffConfigs(from.Config, to.Config),
+	})
+}
+
+// RollbackConfigRevision atomically restores the configuration of a revision.
+// Clusters are matched by their ID in the revision, so clusters renamed since
+// are renamed back and keep their state; clusters that didn't exist in it
+// are deleted. The rollback itself is
+// recorded as a new revision. With ?dryRun=true only the diff is returned.
+func (cm *ClusterManager) RollbackConfigRevision(w http.ResponseWriter, r *http.Request) {
+	number, ok := revisionNumber(r)
+	if !ok {
+		var errs fieldErrors
+		errs.add("revision", "must be a revision number")
+		errs.write(w)
+		return
+	}
+
+	cm.mu.RLock()
+	revision, exists := cm.revision(number)
+	cm.mu.RUnlock()
+	if !exists {
+		writeError(w, http.StatusNotFound, "Revision not found")
+		return
+	}
+
+	change := configChange{
+		prune:      func(*models.Cluster) bool { return true },
+		clusterIDs: revision.ClusterIDs,
+		author:     requestAuthor(r),
+		action:     fmt.Sprintf("Rolled back to revision %d", number),
+	}
+	var diff ConfigDiff
+	var err error
+	if isDryRun(r) {
+		diff, err = cm.previewConfig(revision.Config, change)
+	} else {
+		diff, err = cm.applyConfig(revision.Config, change)
+	}
+	if err != nil {
+		writeError(w, http.StatusConflict, "Failed to restore revision: "+err.Error())
+		return
+	}
+
+	cm.mu.RLock()
+	current := 0
+	if len(cm.revisions) > 0 {
+		current = cm.revisions[len(cm.revisions)-1].Number
+	}
+	cm.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"restored": number,
+		"revision": current,
+		"diff":     diff,
+		"dryRun":   isDryRun(r),
+	})
+}
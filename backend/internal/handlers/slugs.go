@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/CpBruceMeena/go-balance/internal/models"
+)
+
+const (
+	// SlugAliasTTL is how long a cluster's previous slug keeps redirecting
+	// to the new one after a rename
+	SlugAliasTTL = 7 * 24 * time.Hour
+
+	MaxSlugLength = 63
+
+	proxyPathPrefix = "/api/proxy/"
+)
+
+var slugSeparators = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slugify turns a name into a URL-safe slug of lowercase letters and digits
+// separated by single dashes. The result is empty if name has neither.
+func slugify(name string) string {
+	slug := strings.Trim(slugSeparators.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if len(slug) > MaxSlugLength {
+		slug = strings.TrimRight(slug[:MaxSlugLength], "-")
+	}
+	return slug
+}
+
+// slugOwner finds the cluster serving slug, either as its slug or as an
+// unexpired alias. Callers must hold cm.mu.
+func (cm *ClusterManager) slugOwner(slug string, now time.Time) *models.Cluster {
+	var aliased *models.Cluster
+	for _, cluster := range cm.clusters {
+		if cluster.Slug == slug {
+			return cluster
+		}
+		for _, alias := range cluster.SlugAliases {
+			if alias.Slug == slug && now.Before(alias.ExpiresAt) {
+				aliased = cluster
+			}
+		}
+	}
+	return aliased
+}
+
+// slugConflictError reports a slug already used by another cluster
+type slugConflictError struct {
+	slug  string
+	owner string
+}
+
+func (e *slugConflictError) Error() string {
+	return fmt.Sprintf("slug %q is already used by cluster %q", e.slug, e.owner)
+}
+
+// slugConflict reports an error if slug is used by a cluster other than
+// clusterID. Callers must hold cm.mu.
+func (cm *ClusterManager) slugConflict(slug, clusterID string) error {
+	if owner := cm.slugOwner(slug, time.Now()); owner != nil && owner.ID != clusterID {
+		return &slugConflictError{slug: slug, owner: owner.Name}
+	}
+	return nil
+}
+
+// uniqueSlug returns base, or base with the lowest free numeric suffix.
+// Callers must hold cm.mu.
+func (cm *ClusterManager) uniqueSlug(base string) string {
+	slug := base
+	for i := 2; cm.slugOwner(slug, time.Now()) != nil; i++ {
+		suffix := fmt.Sprintf("-%d", i)
+		if len(base)+len(suffix) > MaxSlugLength {
+			base = strings.TrimRight(base[:MaxSlugLength-len(suffix)], "-")
+		}
+		slug = base + suffix
+	}
+	return slug
+}
+
+// setSlug changes a cluster's slug and public endpoint. The previous slug is
+// kept as an alias for SlugAliasTTL so existing clients can follow the move;
+// expired aliases are dropped. Callers must hold cm.mu.
+func setSlug(cluster *models.Cluster, slug string, now time.Time) {
+	aliases := make([]models.SlugAlias, 0, len(cluster.SlugAliases)+1)
+	for _, alias := range cluster.SlugAliases {
+		if alias.Slug != slug && alias.Slug != cluster.Slug && now.Before(alias.ExpiresAt) {
+			aliases = append(aliases, alias)
+		}
+	}
+	if cluster.Slug != "" && cluster.Slug != slug {
+		aliases = append(aliases, models.SlugAlias{Slug: cluster.Slug, ExpiresAt: now.Add(SlugAliasTTL)})
+	}
+	if len(aliases) == 0 {
+		aliases = nil
+	}
+	cluster.SlugAliases = aliases
+	cluster.Slug = slug
+	cluster.PublicEndpoint = proxyPathPrefix + slug
+}
+
+// renamedSlug returns the slug a cluster should have after being renamed to
+// name: an explicit slug wins, and a slug derived from the old name follows
+// the new one. Custom slugs are kept otherwise.
+func renamedSlug(cluster *models.Cluster, name string, slug *string) string {
+	switch {
+	case slug != nil:
+		return slugify(*slug)
+	case cluster.Slug == "" || cluster.Slug == slugify(cluster.Name):
+		return slugify(name)
+	default:
+		return cluster.Slug
+	}
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/CpBruceMeena/go-balance/internal/store"
+	"github.com/gorilla/mux"
+)
+
+// StatsSampleInterval is how often cluster stats are written to history
+const StatsSampleInterval = time.Minute
+
+type clusterStatsSample struct {
+	Timestamp      time.Time `json:"timestamp"`
+	ClusterID      string    `json:"clusterId"`
+	TotalRequests  int       `json:"totalRequests"`
+	RequestsPerSec float64   `json:"requestsPerSec"`
+	HealthyNodes   int       `json:"healthyNodes"`
+	TotalNodes     int       `json:"totalNodes"`
+	HealthStatus   string    `json:"healthStatus"`
+}
+
+func statsKind(clusterID string) string {
+	return store.KindStats + "/" + clusterID
+}
+
+// historyStore returns the store's history support, if it has any
+func (cm *ClusterManager) historyStore() (store.HistoryStore, bool) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	history, ok := cm.store.(store.HistoryStore)
+	return history, ok
+}
+
+// sampleStats periodically records every cluster's stats into the store's
+// history until the store is detached
+func (cm *ClusterManager) sampleStats() {
+	ticker := time.NewTicker(StatsSampleInterval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		history, ok := cm.historyStore()
+		if !ok {
+			return
+		}
+		cm.mu.RLock()
+		samples := make([]clusterStatsSample, 0, len(cm.clusters))
+		for _, cluster := range cm.clusters {
+			samples = append(samples, clusterStatsSample{
+				Timestamp:      now,
+				ClusterID:      cluster.ID,
+				TotalRequests:  cluster.TotalRequests,
+				RequestsPerSec: cluster.RequestsPerSec,
+				HealthyNodes:   healthyNodeCount(cluster),
+				TotalNodes:     len(cluster.Nodes),
+				HealthStatus:   cluster.HealthStatus,
+			})
+		}
+		cm.mu.RUnlock()
+
+		for _, sample := range samples {
+			if err := history.AppendRecord(statsKind(sample.ClusterID), now, sample); err != nil {
+				log.Printf("Failed to record stats for cluster %s: %v", sample.ClusterID, err)
+			}
+		}
+	}
+}
+
+// parseTimeRange reads optional RFC 3339 since/until query parameters
+func parseTimeRange(r *http.Request) (since, until time.Time, err error) {
+	query := r.URL.Query()
+	if value := query.Get("since"); value != "" {
+		if since, err = time.Parse(time.RFC3339, value); err != nil {
+			return
+		}
+	}
+	if value := query.Get("until"); value != "" {
+		until, err = time.Parse(time.RFC3339, value)
+	}
+	return
+}
+
+// GetStatsHistory returns recorded stats samples for a cluster
+func (cm *ClusterManager) GetStatsHistory(w http.ResponseWriter, r *http.Request) {
+	clusterID := mux.Vars(r)["clusterId"]
+
+	history, ok := cm.historyStore()
+	if !ok {
+		writeError(w, http.StatusNotImplemented, "Stats history requires a store with history support")
+		return
+	}
+
+	since, until, err := parseTimeRange(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "since and until must be RFC 3339 timestamps")
+		return
+	}
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a non-negative integer")
+			return
+		}
+	}
+
+	records, err := history.Records(statsKind(clusterID), since, until, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to read stats history")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(records)
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/CpBruceMeena/go-balance/internal/config"
+	"github.com/CpBruceMeena/go-balance/internal/models"
+	"github.com/CpBruceMeena/go-balance/internal/store"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// MaxTemplateDescription caps the length of a template description in bytes
+const MaxTemplateDescription = 1000
+
+// templateByRef finds a template by ID or name. Callers must hold cm.mu.
+func (cm *ClusterManager) templateByRef(ref string) *models.ClusterTemplate {
+	if template, exists := cm.templates[ref]; exists {
+		return template
+	}
+	for _, template := range cm.templates {
+		if template.Name == ref {
+			return template
+		}
+	}
+	return nil
+}
+
+// createRequestFromTemplate returns a create request carrying a template's settings
+func createRequestFromTemplate(template *models.ClusterTemplate) CreateClusterRequest {
+	request := CreateClusterRequest{
+		Algorithm:             template.Algorithm,
+		HealthCheckEndpoint:   template.HealthCheckEndpoint,
+		HealthCheckFrequency:  template.HealthCheckFrequency,
+		HealthCheckTimeout:    template.HealthCheckTimeout,
+		HealthyThreshold:      template.HealthyThreshold,
+		UnhealthyThreshold:    template.UnhealthyThreshold,
+		FlapThreshold:         template.FlapThreshold,
+		FlapWindow:            template.FlapWindow,
+		FlapHoldDown:          template.FlapHoldDown,
+		HealthCheckMode:       template.HealthCheckMode,
+		HeartbeatTTL:          template.HeartbeatTTL,
+		PanicThreshold:        template.PanicThreshold,
+		CertExpiryWarningDays: template.CertExpiryWarningDays,
+	}
+	if template.HealthCheckTLS != nil {
+		settings := *template.HealthCheckTLS
+		request.HealthCheckTLS = &settings
+	}
+	return request
+}
+
+// decodeTemplate reads and validates a template from a request body
+func decodeTemplate(w http.ResponseWriter, r *http.Request) (*models.ClusterTemplate, bool) {
+	var template models.ClusterTemplate
+	if !decodeRequest(w, r, &template) {
+		return nil, false
+	}
+	template.Name = strings.TrimSpace(template.Name)
+
+	var errs fieldErrors
+	errs.name("name", template.Name)
+	if len(template.Description) > MaxTemplateDescription {
+		errs.add("description", "must be at most %d bytes", MaxTemplateDescription)
+	}
+	request := createRequestFromTemplate(&template)
+	settings := clusterConfigFromRequest(&request)
+	errs = append(errs, settings.ValidateSettings(false)...)
+	if len(errs) == 0 {
+		checker, err := newHealthCheckerFor(template.HealthCheckTLS)
+		if err != nil {
+			errs.add("healthCheckTLS", "%v", err)
+		} else if checker != nil {
+			checker.Close()
+		}
+	}
+	if errs.write(w) {
+		return nil, false
+	}
+	return &template, true
+}
+
+// templateNameTaken reports whether another template uses name. Callers must hold cm.mu.
+func (cm *ClusterManager) templateNameTaken(name, templateID string) bool {
+	for _, template := range cm.templates {
+		if template.Name == name && template.ID != templateID {
+			return true
+		}
+	}
+	return false
+}
+
+func writeTemplateNameConflict(w http.ResponseWriter) {
+	writeError(w, http.StatusConflict, "Template conflicts with an existing template", config.FieldError{
+		Field:   "name",
+		Message: "is already used by another template",
+	})
+}
+
+// loadTemplates restores templates from a template store. Callers must hold cm.mu.
+func (cm *ClusterManager) loadTemplates(templates store.TemplateStore) error {
+	loaded, err := templates.LoadTemplates()
+	if err != nil {
+		return err
+	}
+	for i := range loaded {
+		cm.templates[loaded[i].ID] = &loaded[i]
+	}
+	return nil
+}
+
+// persistTemplate saves a template if the store supports it. Callers must hold cm.mu.
+func (cm *ClusterManager) persistTemplate(template *models.ClusterTemplate) {
+	templates, ok := cm.store.(store.TemplateStore)
+	if !ok {
+		return
+	}
+	snapshot := *template
+	if template.HealthCheckTLS != nil {
+		settings := *template.HealthCheckTLS
+		snapshot.HealthCheckTLS = &settings
+	}
+	cm.writes.enqueue("template/"+template.ID, func() {
+		if err := templates.SaveTemplate(snapshot); err != nil {
+			log.Printf("Failed to persist template %s: %v", snapshot.ID, err)
+		}
+	})
+}
+
+// GetTemplates lists templates sorted by name
+func (cm *ClusterManager) GetTemplates(w http.ResponseWriter, r *http.Request) {
+	cm.mu.RLock()
+	templates := make([]models.ClusterTemplate, 0, len(cm.templates))
+	for _, template := range cm.templates {
+		templates = append(templates, *template)
+	}
+	cm.mu.RUnlock()
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(templates)
+}
+
+// GetTemplate returns a single template by ID or name
+func (cm *ClusterManager) GetTemplate(w http.ResponseWriter, r *http.Request) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	template := cm.templateByRef(mux.Vars(r)["templateId"])
+	if template == nil {
+		writeError(w, http.StatusNotFound, "Template not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(template)
+}
+
+func (cm *ClusterManager) CreateTemplate(w http.ResponseWriter, r *http.Request) {
+	template, ok := decodeTemplate(w, r)
+	if !ok {
+		return
+	}
+	template.ID = uuid.New().String()
+	template.CreatedAt = time.Now()
+	template.UpdatedAt = template.CreatedAt
+
+	cm.mu.Lock()
+	if cm.templateNameTaken(template.Name, template.ID) {
+		cm.mu.Unlock()
+		writeTemplateNameConflict(w)
+		return
+	}
+	if isDryRun(r) {
+		cm.mu.Unlock()
+		writeDryRun(w, template)
+		return
+	}
+	cm.templates[template.ID] = template
+	cm.persistTemplate(template)
+	cm.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(template)
+}
+
+// UpdateTemplate replaces a template's settings. Clusters already created
+// from it are unaffected.
+func (cm *ClusterManager) UpdateTemplate(w http.ResponseWriter, r *http.Request) {
+	template, ok := decodeTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	existing := cm.templateByRef(mux.Vars(r)["templateId"])
+	if existing == nil {
+		writeError(w, http.StatusNotFound, "Template not found")
+		return
+	}
+	if cm.templateNameTaken(template.Name, existing.ID) {
+		writeTemplateNameConflict(w)
+		return
+	}
+	template.ID = existing.ID
+	template.CreatedAt = existing.CreatedAt
+	template.UpdatedAt = time.Now()
+	if isDryRun(r) {
+		writeDryRun(w, template)
+		return
+	}
+	cm.templates[template.ID] = template
+	cm.persistTemplate(template)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(template)
+}
+
+func (cm *ClusterManager) DeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	template := cm.templateByRef(mux.Vars(r)["templateId"])
+	if template == nil {
+		writeError(w, http.StatusNotFound, "Template not found")
+		return
+	}
+	if isDryRun(r) {
+		writeDryRun(w, template)
+		return
+	}
+	delete(cm.templates, template.ID)
+	if templates, ok := cm.store.(store.TemplateStore); ok {
+		templateID := template.ID
+		cm.writes.enqueue("template/"+templateID, func() {
+			if err := templates.DeleteTemplate(templateID); err != nil {
+				log.Printf("Failed to delete template %s from store: %v", templateID, err)
+			}
+		})
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+
+	"github.com/CpBruceMeena/go-balance/internal/config"
+	"github.com/CpBruceMeena/go-balance/internal/models"
+)
+
+// ErrorResponse is the JSON body of an admin API request rejected as
+// invalid. Fields lists the offending fields, named as in the request.
+type ErrorResponse struct {
+	Error  string              `json:"error"`
+	Fields []config.FieldError `json:"fields,omitempty"`
+}
+
+// fieldErrors collects the invalid fields of a request
+type fieldErrors []config.FieldError
+
+func (errs *fieldErrors) add(field, format string, args ...interface{}) {
+	*errs = append(*errs, config.FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (errs *fieldErrors) inRange(field string, value, min, max int) {
+	if value < min || value > max {
+		errs.add(field, "must be between %d and %d", min, max)
+	}
+}
+
+// name checks a cluster or template name
+func (errs *fieldErrors) name(field, name string) {
+	if message := config.NameProblem(name); message != "" {
+		errs.add(field, message)
+	}
+}
+
+// url checks a node URL, or any absolute http(s) URL when node is false
+func (errs *fieldErrors) url(field, raw string, node bool) {
+	validate := config.ValidateURL
+	if node {
+		validate = config.ValidateNodeURL
+	}
+	if err := validate(raw); err != nil {
+		errs.add(field, "%v", err)
+	}
+}
+
+// write answers 400 listing the invalid fields, reporting whether there were any
+func (errs fieldErrors) write(w http.ResponseWriter) bool {
+	if len(errs) == 0 {
+		return false
+	}
+	writeError(w, http.StatusBadRequest, "Invalid request", errs...)
+	return true
+}
+
+// writeError answers with an ErrorResponse
+func writeError(w http.ResponseWriter, status int, message string, fields ...config.FieldError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: message, Fields: fields})
+}
+
+// writeConfigError answers for a configuration that failed validation or
+// couldn't be applied: 409 when it clashes with clusters outside it and 400
+// when it is invalid on its own
+func writeConfigError(w http.ResponseWriter, message string, err error) {
+	var invalid *config.ValidationError
+	if errors.As(err, &invalid) {
+		writeError(w, http.StatusBadRequest, message, invalid.Fields...)
+		return
+	}
+	writeError(w, configErrorStatus(err), message+": "+err.Error())
+}
+
+// decodeRequest decodes a JSON request body into v, answering 400 and
+// naming the field when a value has the wrong type
+func decodeRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	data, err := io.ReadAll(io.LimitReader(r.Body, MaxConfigSize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return false
+	}
+	return unmarshalRequest(w, data, v)
+}
+
+// unmarshalRequest is decodeRequest for a body that has already been read
+func unmarshalRequest(w http.ResponseWriter, data []byte, v interface{}) bool {
+	err := json.Unmarshal(data, v)
+	if err == nil {
+		return true
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		writeError(w, http.StatusBadRequest, "Invalid request body", config.FieldError{
+			Field:   typeErr.Field,
+			Message: "must be " + jsonTypeName(typeErr.Type),
+		})
+		return false
+	}
+	writeError(w, http.StatusBadRequest, "Invalid request body")
+	return false
+}
+
+// jsonTypeName describes the JSON value a Go type is decoded from
+func jsonTypeName(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "a list"
+	default:
+		return "an object"
+	}
+}
+
+// clusterConflict reports a field of cluster that clashes with another
+// cluster: names must be unique because configurations identify clusters by
+// them, and slugs because proxy paths do. Callers must hold cm.mu.
+func (cm *ClusterManager) clusterConflict(cluster *models.Cluster) *config.FieldError {
+	if other := cm.clusterByName(cluster.Name); other != nil && other.ID != cluster.ID {
+		return &config.FieldError{Field: "name", Message: "is already used by cluster " + other.ID}
+	}
+	if err := cm.slugConflict(cluster.Slug, cluster.ID); err != nil {
+		return &config.FieldError{Field: "slug", Message: err.Error()}
+	}
+	return nil
+}
+
+// isDryRun reports whether ?dryRun=true asks for a mutation to be validated
+// without being applied
+func isDryRun(r *http.Request) bool {
+	return r.URL.Query().Get("dryRun") == "true"
+}
+
+// writeDryRun answers a dry run with the result the request would have had.
+// Dry runs always answer 200, even where the real call would create,
+// accept or delete.
+func writeDryRun(w http.ResponseWriter, result interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
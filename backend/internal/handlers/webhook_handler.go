@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/CpBruceMeena/go-balance/internal/events"
+	"github.com/CpBruceMeena/go-balance/internal/store"
+	"github.com/gorilla/mux"
+)
+
+type CreateWebhookRequest struct {
+	URL    string        `json:"url"`
+	Secret string        `json:"secret"`
+	Events []events.Type `json:"events"`
+}
+
+func (cm *ClusterManager) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cm.webhooks.List())
+}
+
+func (cm *ClusterManager) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var request CreateWebhookRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+
+	request.URL = strings.TrimSpace(request.URL)
+	var errs fieldErrors
+	errs.url("url", request.URL, false)
+	for i, eventType := range request.Events {
+		if !eventType.Valid() {
+			errs.add(fmt.Sprintf("events[%d]", i), "unknown event type %q", eventType)
+		}
+	}
+	if errs.write(w) {
+		return
+	}
+
+	webhook := events.Webhook{
+		URL:    request.URL,
+		Secret: request.Secret,
+		Events: request.Events,
+	}
+	if isDryRun(r) {
+		webhook.Secret = ""
+		if webhook.Events == nil {
+			webhook.Events = []events.Type{}
+		}
+		writeDryRun(w, webhook)
+		return
+	}
+	webhook = cm.webhooks.Add(webhook)
+	cm.persistWebhook(webhook)
+	webhook.Secret = ""
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(webhook)
+}
+
+func (cm *ClusterManager) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	webhookID := mux.Vars(r)["webhookId"]
+	if isDryRun(r) {
+		for _, webhook := range cm.webhooks.List() {
+			if webhook.ID == webhookID {
+				writeDryRun(w, webhook)
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, "Webhook not found")
+		return
+	}
+	if !cm.webhooks.Remove(webhookID) {
+		writeError(w, http.StatusNotFound, "Webhook not found")
+		return
+	}
+	cm.mu.RLock()
+	if webhooks, ok := cm.store.(store.WebhookStore); ok {
+		cm.writes.enqueue("webhook/"+webhookID, func() {
+			if err := webhooks.DeleteWebhook(webhookID); err != nil {
+				log.Printf("Failed to delete webhook %s from store: %v", webhookID, err)
+			}
+		})
+	}
+	cm.mu.RUnlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetWebhookDeliveries returns recent delivery attempts, newest first. Use
+// ?webhookId= to restrict the log to one webhook.
+func (cm *ClusterManager) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	deliveries, err := cm.webhooks.Deliveries(r.URL.Query().Get("webhookId"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to read webhook deliveries")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// persistWebhook saves a webhook if the store supports it
+func (cm *ClusterManager) persistWebhook(webhook events.Webhook) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	webhooks, ok := cm.store.(store.WebhookStore)
+	if !ok {
+		return
+	}
+	cm.writes.enqueue("webhook/"+webhook.ID, func() {
+		if err := webhooks.SaveWebhook(webhook); err != nil {
+			log.Printf("Failed to persist webhook %s: %v", webhook.ID, err)
+		}
+	})
+}
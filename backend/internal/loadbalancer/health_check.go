@@ -1,10 +1,15 @@
 package loadbalancer
 
 import (
+	"context"
+	"crypto/tls"
 	"net/http"
 	"time"
 )
 
+// DefaultProbeTimeout is used when a probe is run without an explicit timeout
+const DefaultProbeTimeout = 5 * time.Second
+
 // HealthChecker represents a health check manager
 type HealthChecker struct {
 	client *http.Client
@@ -13,31 +18,105 @@ type HealthChecker struct {
 // NewHealthChecker creates a new health checker instance
 func NewHealthChecker() *HealthChecker {
 	return &HealthChecker{
-		client: &http.Client{
-			Timeout: 5 * time.Second,
-		},
+		client: &http.Client{},
 	}
 }
 
-// CheckServerHealth performs a health check on a server
-func (hc *HealthChecker) CheckServerHealth(server *Server) bool {
-	if server.HealthCheck == nil {
+// NewHealthCheckerWithTLS creates a health checker whose HTTPS probes use the
+// given TLS configuration (custom CAs, client certificates, SNI, ...)
+func NewHealthCheckerWithTLS(tlsConfig *tls.Config) *HealthChecker {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &HealthChecker{
+		client: &http.Client{Transport: transport},
+	}
+}
+
+// Close releases idle connections held by the checker
+func (hc *HealthChecker) Close() {
+	hc.client.CloseIdleConnections()
+}
+
+// ProbeResult is the outcome of a single health probe
+type ProbeResult struct {
+	Healthy    bool
+	StatusCode int
+	Latency    time.Duration
+	Err        error
+	// CertExpiry is the expiry of the target's leaf certificate for TLS probes
+	CertExpiry time.Time
+}
+
+// HealthState tracks consecutive probe results so that a target only changes
+// state after crossing its rise (healthy) or fall (unhealthy) threshold
+type HealthState struct {
+	Healthy              bool
+	ConsecutiveSuccesses int
+	ConsecutiveFailures  int
+}
+
+// Record applies a probe result to the state and reports whether Healthy changed
+func (s *HealthState) Record(success bool, healthyThreshold, unhealthyThreshold int) bool {
+	if success {
+		s.ConsecutiveSuccesses++
+		s.ConsecutiveFailures = 0
+		if !s.Healthy && s.ConsecutiveSuccesses >= healthyThreshold {
+			s.Healthy = true
+			return true
+		}
+		return false
+	}
+
+	s.ConsecutiveFailures++
+	s.ConsecutiveSuccesses = 0
+	if s.Healthy && s.ConsecutiveFailures >= unhealthyThreshold {
+		s.Healthy = false
 		return true
 	}
+	return false
+}
 
-	url := server.URL + server.HealthCheck.Path
-	req, err := http.NewRequest("GET", url, nil)
+// Probe performs a GET request against url and treats any 2xx response
+// received within timeout as healthy
+func (hc *HealthChecker) Probe(ctx context.Context, url string, timeout time.Duration) ProbeResult {
+	if timeout <= 0 {
+		timeout = DefaultProbeTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return false
+		return ProbeResult{Err: err}
 	}
 
+	start := time.Now()
 	resp, err := hc.client.Do(req)
+	latency := time.Since(start)
 	if err != nil {
-		return false
+		return ProbeResult{Latency: latency, Err: err}
 	}
 	defer resp.Body.Close()
 
-	return resp.StatusCode >= 200 && resp.StatusCode < 300
+	result := ProbeResult{
+		Healthy:    resp.StatusCode >= 200 && resp.StatusCode < 300,
+		StatusCode: resp.StatusCode,
+		Latency:    latency,
+	}
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		result.CertExpiry = resp.TLS.PeerCertificates[0].NotAfter
+	}
+	return result
+}
+
+// CheckServerHealth performs a health check on a server
+func (hc *HealthChecker) CheckServerHealth(server *Server) bool {
+	if server.HealthCheck == nil {
+		return true
+	}
+
+	url := server.URL + server.HealthCheck.Path
+	return hc.Probe(context.Background(), url, server.HealthCheck.Timeout).Healthy
 }
 
 // StartHealthChecks starts periodic health checks for a server
@@ -48,26 +127,16 @@ func (hc *HealthChecker) StartHealthChecks(server *Server) {
 
 	ticker := time.NewTicker(server.HealthCheck.Interval)
 	go func() {
-		consecutiveFailures := 0
-		consecutiveSuccesses := 0
+		server.mu.RLock()
+		state := HealthState{Healthy: server.IsActive}
+		server.mu.RUnlock()
 
 		for range ticker.C {
 			isHealthy := hc.CheckServerHealth(server)
 
 			server.mu.Lock()
-			if isHealthy {
-				consecutiveSuccesses++
-				consecutiveFailures = 0
-				if consecutiveSuccesses >= server.HealthCheck.HealthyThreshold {
-					server.IsActive = true
-				}
-			} else {
-				consecutiveFailures++
-				consecutiveSuccesses = 0
-				if consecutiveFailures >= server.HealthCheck.UnhealthyThreshold {
-					server.IsActive = false
-				}
-			}
+			state.Record(isHealthy, server.HealthCheck.HealthyThreshold, server.HealthCheck.UnhealthyThreshold)
+			server.IsActive = state.Healthy
 			server.mu.Unlock()
 		}
 	}()
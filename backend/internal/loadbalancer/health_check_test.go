@@ -0,0 +1,67 @@
+package loadbalancer
+
+import "testing"
+
+func TestHealthStateRecord(t *testing.T) {
+	tests := []struct {
+		name    string
+		healthy bool
+		probes  []bool
+		// changed after each probe
+		changed []bool
+		want    HealthState
+	}{
+		{
+			name:    "rises after the healthy threshold",
+			probes:  []bool{true, true, true},
+			changed: []bool{false, false, true},
+			want:    HealthState{Healthy: true, ConsecutiveSuccesses: 3},
+		},
+		{
+			name:    "falls after the unhealthy threshold",
+			healthy: true,
+			probes:  []bool{false, false},
+			changed: []bool{false, true},
+			want:    HealthState{ConsecutiveFailures: 2},
+		},
+		{
+			name:    "a success resets the failure count",
+			healthy: true,
+			probes:  []bool{false, true, false},
+			changed: []bool{false, false, false},
+			want:    HealthState{Healthy: true, ConsecutiveFailures: 1},
+		},
+		{
+			name:    "a failure resets the success count",
+			probes:  []bool{true, true, false, true, true},
+			changed: []bool{false, false, false, false, false},
+			want:    HealthState{ConsecutiveSuccesses: 2},
+		},
+		{
+			name:    "successes past the threshold don't report a change",
+			healthy: true,
+			probes:  []bool{true, true, true, true},
+			changed: []bool{false, false, false, false},
+			want:    HealthState{Healthy: true, ConsecutiveSuccesses: 4},
+		},
+		{
+			name:    "failures past the threshold don't report a change",
+			probes:  []bool{false, false, false},
+			changed: []bool{false, false, false},
+			want:    HealthState{ConsecutiveFailures: 3},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := HealthState{Healthy: test.healthy}
+			for i, success := range test.probes {
+				if changed := state.Record(success, 3, 2); changed != test.changed[i] {
+					t.Errorf("probe %d: changed is %v, want %v", i+1, changed, test.changed[i])
+				}
+			}
+			if state != test.want {
+				t.Errorf("got %+v, want %+v", state, test.want)
+			}
+		})
+	}
+}
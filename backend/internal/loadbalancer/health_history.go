@@ -0,0 +1,93 @@
+package loadbalancer
+
+import (
+	"sync"
+	"time"
+)
+
+// ProbeRecord is a single entry in a target's health history
+type ProbeRecord struct {
+	Timestamp  time.Time `json:"timestamp"`
+	Latency    float64   `json:"latency"` // Latency in milliseconds
+	StatusCode int       `json:"statusCode"`
+	Error      string    `json:"error,omitempty"`
+	Healthy    bool      `json:"healthy"`
+}
+
+// NewProbeRecord converts a probe result into a history record
+func NewProbeRecord(result ProbeResult, at time.Time) ProbeRecord {
+	record := ProbeRecord{
+		Timestamp:  at,
+		Latency:    float64(result.Latency) / float64(time.Millisecond),
+		StatusCode: result.StatusCode,
+		Healthy:    result.Healthy,
+	}
+	if result.Err != nil {
+		record.Error = result.Err.Error()
+	}
+	return record
+}
+
+// HealthHistory is a bounded ring buffer of probe records that also tracks
+// when the target changed state, for flap detection
+type HealthHistory struct {
+	records     []ProbeRecord
+	next        int
+	full        bool
+	transitions []time.Time
+	mu          sync.RWMutex
+}
+
+// NewHealthHistory creates a history holding at most size records
+func NewHealthHistory(size int) *HealthHistory {
+	if size < 1 {
+		size = 1
+	}
+	return &HealthHistory{
+		records: make([]ProbeRecord, size),
+	}
+}
+
+// Add appends a record, overwriting the oldest one once the buffer is full
+func (h *HealthHistory) Add(record ProbeRecord) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records[h.next] = record
+	h.next = (h.next + 1) % len(h.records)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// Records returns the buffered records, oldest first
+func (h *HealthHistory) Records() []ProbeRecord {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if !h.full {
+		return append([]ProbeRecord(nil), h.records[:h.next]...)
+	}
+	records := make([]ProbeRecord, 0, len(h.records))
+	records = append(records, h.records[h.next:]...)
+	return append(records, h.records[:h.next]...)
+}
+
+// AddTransition records a state change at the given time
+func (h *HealthHistory) AddTransition(at time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.transitions = append(h.transitions, at)
+}
+
+// TransitionsSince drops transitions older than cutoff and returns how many remain
+func (h *HealthHistory) TransitionsSince(cutoff time.Time) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	kept := h.transitions[:0]
+	for _, t := range h.transitions {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	h.transitions = kept
+	return len(kept)
+}
@@ -0,0 +1,240 @@
+package loadbalancer
+
+import (
+	"container/heap"
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ProbeFunc runs a single probe. ctx is cancelled when the probe is
+// unscheduled or replaced, so in-flight requests are abandoned promptly.
+type ProbeFunc func(ctx context.Context)
+
+// ScheduledProbe is a read-only view of a probe owned by the scheduler
+type ScheduledProbe struct {
+	Key      string        `json:"key"`
+	Interval time.Duration `json:"interval"`
+	NextRun  time.Time     `json:"nextRun"`
+	LastRun  time.Time     `json:"lastRun"`
+	Running  bool          `json:"running"`
+}
+
+// HealthScheduler owns every periodic probe. Probes are spread over their
+// interval with jitter and the number running at once is capped globally.
+type HealthScheduler struct {
+	mu     sync.Mutex
+	jobs   map[string]*scheduledJob
+	queue  jobQueue
+	wake   chan struct{}
+	sem    chan struct{}
+	jitter float64
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+type scheduledJob struct {
+	key      string
+	interval time.Duration
+	probe    ProbeFunc
+	ctx      context.Context
+	cancel   context.CancelFunc
+	next     time.Time
+	lastRun  time.Time
+	running  bool
+	index    int // position in the queue, -1 while running
+}
+
+// NewHealthScheduler creates and starts a scheduler that runs at most
+// maxConcurrent probes at a time. jitter is the fraction of the interval
+// (0-1) by which each run may be randomly delayed.
+func NewHealthScheduler(maxConcurrent int, jitter float64) *HealthScheduler {
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &HealthScheduler{
+		jobs:   make(map[string]*scheduledJob),
+		wake:   make(chan struct{}, 1),
+		sem:    make(chan struct{}, maxConcurrent),
+		jitter: jitter,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	go s.loop()
+	return s
+}
+
+// Schedule registers a probe under key, replacing (and cancelling) any probe
+// already registered under the same key. The first run happens at a random
+// point within the first interval so that probes added together don't fire
+// together.
+func (s *HealthScheduler) Schedule(key string, interval time.Duration, probe ProbeFunc) {
+	if interval <= 0 {
+		s.Unschedule(key)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	job := &scheduledJob{
+		key:      key,
+		interval: interval,
+		probe:    probe,
+		ctx:      ctx,
+		cancel:   cancel,
+		next:     time.Now().Add(time.Duration(rand.Int63n(int64(interval)))),
+		index:    -1,
+	}
+
+	s.mu.Lock()
+	s.removeLocked(key)
+	s.jobs[key] = job
+	heap.Push(&s.queue, job)
+	s.mu.Unlock()
+	s.signal()
+}
+
+// Unschedule stops the probe registered under key, cancelling it if it is
+// currently running
+func (s *HealthScheduler) Unschedule(key string) {
+	s.mu.Lock()
+	s.removeLocked(key)
+	s.mu.Unlock()
+	s.signal()
+}
+
+func (s *HealthScheduler) removeLocked(key string) {
+	job, exists := s.jobs[key]
+	if !exists {
+		return
+	}
+	job.cancel()
+	if job.index >= 0 {
+		heap.Remove(&s.queue, job.index)
+	}
+	delete(s.jobs, key)
+}
+
+// Get returns the current view of the probe registered under key
+func (s *HealthScheduler) Get(key string) (ScheduledProbe, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, exists := s.jobs[key]
+	if !exists {
+		return ScheduledProbe{}, false
+	}
+	return job.view(), true
+}
+
+// Stop cancels every probe and stops the scheduler
+func (s *HealthScheduler) Stop() {
+	s.cancel()
+}
+
+func (job *scheduledJob) view() ScheduledProbe {
+	return ScheduledProbe{
+		Key:      job.key,
+		Interval: job.interval,
+		NextRun:  job.next,
+		LastRun:  job.lastRun,
+		Running:  job.running,
+	}
+}
+
+func (s *HealthScheduler) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *HealthScheduler) loop() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		s.mu.Lock()
+		now := time.Now()
+		for len(s.queue) > 0 && !s.queue[0].next.After(now) {
+			job := heap.Pop(&s.queue).(*scheduledJob)
+			job.running = true
+			go s.run(job)
+		}
+		wait := time.Hour
+		if len(s.queue) > 0 {
+			wait = s.queue[0].next.Sub(now)
+		}
+		s.mu.Unlock()
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+
+		select {
+		case <-timer.C:
+		case <-s.wake:
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *HealthScheduler) run(job *scheduledJob) {
+	select {
+	case s.sem <- struct{}{}:
+	case <-job.ctx.Done():
+		return
+	}
+
+	s.mu.Lock()
+	job.lastRun = time.Now()
+	s.mu.Unlock()
+
+	job.probe(job.ctx)
+	<-s.sem
+
+	s.mu.Lock()
+	job.running = false
+	if job.ctx.Err() == nil && s.jobs[job.key] == job {
+		delay := job.interval
+		if s.jitter > 0 {
+			delay += time.Duration(rand.Float64() * s.jitter * float64(job.interval))
+		}
+		job.next = time.Now().Add(delay)
+		heap.Push(&s.queue, job)
+	}
+	s.mu.Unlock()
+	s.signal()
+}
+
+// jobQueue is a min-heap of jobs ordered by next run time
+type jobQueue []*scheduledJob
+
+func (q jobQueue) Len() int           { return len(q) }
+func (q jobQueue) Less(i, j int) bool { return q[i].next.Before(q[j].next) }
+func (q jobQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *jobQueue) Push(x interface{}) {
+	job := x.(*scheduledJob)
+	job.index = len(*q)
+	*q = append(*q, job)
+}
+
+func (q *jobQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	job := old[n-1]
+	old[n-1] = nil
+	job.index = -1
+	*q = old[:n-1]
+	return job
+}
@@ -3,14 +3,34 @@ package models
 import "time"
 
 type Node struct {
-	ID           string    `json:"id"`
-	URL          string    `json:"url"`
-	IsActive     bool      `json:"isActive"`
-	HealthStatus string    `json:"healthStatus"`
-	LastChecked  time.Time `json:"lastChecked"`
-	ResponseTime float64   `json:"responseTime"`
-	CreatedAt    time.Time `json:"createdAt"`
-	Weight       int       `json:"weight"`
+	ID           string            `json:"id"`
+	URL          string            `json:"url"`
+	IsActive     bool              `json:"isActive"`
+	HealthStatus string            `json:"healthStatus"`
+	LastChecked  time.Time         `json:"lastChecked"`
+	ResponseTime float64           `json:"responseTime"`
+	CreatedAt    time.Time         `json:"createdAt"`
+	Weight       int               `json:"weight"`
+	Priority     int               `json:"priority,omitempty"` // Failover level; a level only gets traffic while lower ones have no routable node
+	Labels       map[string]string `json:"labels,omitempty"`
+	Disabled     bool              `json:"disabled"` // Set while the node is in maintenance
+	// Operator state: active, draining or maintenance
+	AdminState    string     `json:"adminState"`
+	DrainDeadline *time.Time `json:"drainDeadline,omitempty"` // Sticky sessions are honoured until then
+	DrainThen     string     `json:"drainThen,omitempty"`     // maintenance or remove once drained
+	InFlight      int        `json:"inFlight"`                // Requests currently being proxied to the node
+	ManagedBy     string     `json:"managedBy,omitempty"`     // Discovery source or registration owning the node, which then can't be removed manually
+	// Lease of a node that registered itself; it is drained and removed
+	// unless renewed before LeaseExpiresAt
+	LeaseID        string     `json:"leaseId,omitempty"`
+	LeaseTTL       int        `json:"leaseTTL,omitempty"` // seconds
+	LeaseExpiresAt *time.Time `json:"leaseExpiresAt,omitempty"`
+	// Health check counters
+	ConsecutiveSuccesses int       `json:"consecutiveSuccesses"`
+	ConsecutiveFailures  int       `json:"consecutiveFailures"`
+	Flapping             bool      `json:"flapping"`
+	LastHeartbeat        time.Time `json:"lastHeartbeat"`
+	CertExpiresAt        time.Time `json:"certExpiresAt"` // Leaf certificate expiry seen by HTTPS health checks
 	// Request stats
 	TotalRequests     int         `json:"totalRequests"`
 	RequestsPerSec    float64     `json:"requestsPerSec"`
@@ -22,16 +42,90 @@ type Node struct {
 	Memory            float64     `json:"memory"`
 }
 
+// HealthCheckTLS configures how health checks connect to HTTPS nodes. Files
+// must be in the server's TLS directory; relative names are resolved in it.
+type HealthCheckTLS struct {
+	CAFile             string `json:"caFile,omitempty" yaml:"caFile,omitempty"`     // PEM bundle of CAs trusted in addition to the system roots
+	CertFile           string `json:"certFile,omitempty" yaml:"certFile,omitempty"` // Client certificate for mTLS
+	KeyFile            string `json:"keyFile,omitempty" yaml:"keyFile,omitempty"`
+	ServerName         string `json:"serverName,omitempty" yaml:"serverName,omitempty"` // SNI and verification name override
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty" yaml:"insecureSkipVerify,omitempty"`
+}
+
+// Discovery configures where a cluster's nodes are discovered from.
+// Discovered nodes are added and removed as the source changes.
+type Discovery struct {
+	Type   string `json:"type" yaml:"type"`                         // dns, srv, file or consul
+	Name   string `json:"name,omitempty" yaml:"name,omitempty"`     // DNS name resolved to node addresses, or the SRV or Consul service name
+	Port   int    `json:"port,omitempty" yaml:"port,omitempty"`     // Port of the discovered nodes; SRV records and Consul services carry their own
+	Scheme string `json:"scheme,omitempty" yaml:"scheme,omitempty"` // http (default) or https
+	Server string `json:"server,omitempty" yaml:"server,omitempty"` // DNS server host:port or Consul agent URL; defaults to the system's
+	// Bounds in seconds on the record TTL used as the re-resolution interval.
+	// Consul discovery retries failed queries after MinTTL and blocks for at
+	// most MaxTTL waiting for changes.
+	MinTTL int `json:"minTTL,omitempty" yaml:"minTTL,omitempty"`
+	MaxTTL int `json:"maxTTL,omitempty" yaml:"maxTTL,omitempty"`
+	// JSON or YAML node list watched by file discovery
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	// Only Consul service instances with this tag and in this datacenter
+	Tag        string `json:"tag,omitempty" yaml:"tag,omitempty"`
+	Datacenter string `json:"datacenter,omitempty" yaml:"datacenter,omitempty"`
+}
+
+// Registration lets nodes add themselves to a cluster with a token. Only a
+// hash of the token is kept, and only stores ever see it.
+type Registration struct {
+	TokenHash string    `json:"-"` // hex SHA-256 of the token
+	IssuedAt  time.Time `json:"issuedAt"`
+}
+
+// HeartbeatAuth holds the token nodes send heartbeats with. Only a hash of
+// the token is kept, and only stores ever see it.
+type HeartbeatAuth struct {
+	TokenHash string    `json:"-"` // hex SHA-256 of the token
+	IssuedAt  time.Time `json:"issuedAt"`
+}
+
+// SlugAlias is a previous slug of a cluster that redirects to the current
+// one until it expires
+type SlugAlias struct {
+	Slug      string    `json:"slug"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
 type Cluster struct {
-	ID                   string    `json:"id"`
-	Name                 string    `json:"name"`
-	Algorithm            string    `json:"algorithm"`
-	Nodes                []Node    `json:"nodes"`
-	HealthCheckEndpoint  string    `json:"healthCheckEndpoint"`
-	HealthCheckFrequency int       `json:"healthCheckFrequency"` // Frequency in seconds
-	CreatedAt            time.Time `json:"createdAt"`
-	UpdatedAt            time.Time `json:"updatedAt"`
-	PublicEndpoint       string    `json:"publicEndpoint"`
+	ID                   string `json:"id"`
+	Name                 string `json:"name"`
+	Algorithm            string `json:"algorithm"`
+	Nodes                []Node `json:"nodes"`
+	HealthCheckEndpoint  string `json:"healthCheckEndpoint"`
+	HealthCheckFrequency int    `json:"healthCheckFrequency"` // Frequency in seconds
+	HealthCheckTimeout   int    `json:"healthCheckTimeout"`   // Timeout in seconds
+	HealthyThreshold     int    `json:"healthyThreshold"`     // Consecutive successes before a node is marked healthy
+	UnhealthyThreshold   int    `json:"unhealthyThreshold"`   // Consecutive failures before a node is marked unhealthy
+	FlapThreshold        int    `json:"flapThreshold"`        // State transitions within FlapWindow that mark a node as flapping; 0 disables
+	FlapWindow           int    `json:"flapWindow"`           // Window in seconds
+	FlapHoldDown         bool   `json:"flapHoldDown"`         // Keep flapping nodes out of rotation
+	HealthCheckMode      string `json:"healthCheckMode"`      // active, heartbeat or both
+	HeartbeatTTL         int    `json:"heartbeatTTL"`         // Seconds without a heartbeat before a node is unhealthy
+	PanicThreshold       int    `json:"panicThreshold"`       // Percent of healthy nodes below which routing ignores health; 0 disables
+	StickySessions       bool   `json:"stickySessions"`       // Pin clients to the node that first served them
+	// TLS settings for HTTPS health checks
+	HealthCheckTLS        *HealthCheckTLS `json:"healthCheckTLS,omitempty"`
+	CertExpiryWarningDays int             `json:"certExpiryWarningDays"` // Warn when a node certificate expires within this many days
+	HealthStatus          string          `json:"healthStatus"`          // healthy, degraded or critical
+	PanicMode             bool            `json:"panicMode"`
+	CreatedAt             time.Time       `json:"createdAt"`
+	UpdatedAt             time.Time       `json:"updatedAt"`
+	Slug                  string          `json:"slug"`                  // Path segment the cluster is proxied under
+	SlugAliases           []SlugAlias     `json:"slugAliases,omitempty"` // Previous slugs redirecting here after a rename
+	PublicEndpoint        string          `json:"publicEndpoint"`
+	ManagedBy             string          `json:"managedBy,omitempty"`     // Set when the cluster is owned by a configuration file
+	Template              string          `json:"template,omitempty"`      // ID of the template the cluster was created from
+	Discovery             *Discovery      `json:"discovery,omitempty"`     // Source nodes are discovered from, if any
+	Registration          *Registration   `json:"registration,omitempty"`  // Set while nodes may register themselves
+	HeartbeatAuth         *HeartbeatAuth  `json:"heartbeatAuth,omitempty"` // Set once nodes may send heartbeats
+	ResourceVersion       int64           `json:"resourceVersion"`         // Incremented on every configuration change
 	// Request stats
 	TotalRequests     int         `json:"totalRequests"`
 	RequestsPerSec    float64     `json:"requestsPerSec"`
@@ -39,9 +133,44 @@ type Cluster struct {
 	RequestTimestamps []time.Time `json:"-"`
 }
 
+// ClusterTemplate holds cluster settings shared by many clusters. Clusters
+// created from a template copy its settings, so later edits to the template
+// don't affect them.
+type ClusterTemplate struct {
+	ID                   string `json:"id"`
+	Name                 string `json:"name"`
+	Description          string `json:"description,omitempty"`
+	Algorithm            string `json:"algorithm"`
+	HealthCheckEndpoint  string `json:"healthCheckEndpoint"`
+	HealthCheckFrequency int    `json:"healthCheckFrequency"`
+	HealthCheckTimeout   int    `json:"healthCheckTimeout"`
+	HealthyThreshold     int    `json:"healthyThreshold"`
+	UnhealthyThreshold   int    `json:"unhealthyThreshold"`
+	FlapThreshold        int    `json:"flapThreshold"`
+	FlapWindow           int    `json:"flapWindow"`
+	FlapHoldDown         bool   `json:"flapHoldDown"`
+	HealthCheckMode      string `json:"healthCheckMode"`
+	HeartbeatTTL         int    `json:"heartbeatTTL"`
+	PanicThreshold       int    `json:"panicThreshold"`
+	// TLS settings for HTTPS health checks
+	HealthCheckTLS        *HealthCheckTLS `json:"healthCheckTLS,omitempty"`
+	CertExpiryWarningDays int             `json:"certExpiryWarningDays"`
+	CreatedAt             time.Time       `json:"createdAt"`
+	UpdatedAt             time.Time       `json:"updatedAt"`
+}
+
 type CreateClusterRequest struct {
 	Name                 string `json:"name"`
 	Algorithm            string `json:"algorithm"`
 	HealthCheckEndpoint  string `json:"healthCheckEndpoint"`
 	HealthCheckFrequency int    `json:"healthCheckFrequency"` // Frequency in seconds
+	HealthCheckTimeout   int    `json:"healthCheckTimeout"`   // Timeout in seconds
+	HealthyThreshold     int    `json:"healthyThreshold"`
+	UnhealthyThreshold   int    `json:"unhealthyThreshold"`
+	FlapThreshold        int    `json:"flapThreshold"`
+	FlapWindow           int    `json:"flapWindow"`
+	FlapHoldDown         bool   `json:"flapHoldDown"`
+	HealthCheckMode      string `json:"healthCheckMode"`
+	HeartbeatTTL         int    `json:"heartbeatTTL"`
+	PanicThreshold       int    `json:"panicThreshold"`
 }
@@ -0,0 +1,352 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/CpBruceMeena/go-balance/internal/events"
+	"github.com/CpBruceMeena/go-balance/internal/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	metaBucket     = []byte("meta")
+	clustersBucket = []byte("clusters")
+	nodesBucket    = []byte("nodes") // one nested bucket of nodes per cluster
+	historyBucket  = []byte("history")
+	templateBucket = []byte("templates")
+	webhookBucket  = []byte("webhooks")
+
+	schemaVersionKey = []byte("schema_version")
+)
+
+// migrations upgrade the database one schema version at a time; the schema
+// version is the number of migrations applied
+var migrations = []func(tx *bolt.Tx) error{
+	// 1: clusters and their nodes
+	func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{clustersBucket, nodesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// 2: time-ordered history records
+	func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(historyBucket)
+		return err
+	},
+	// 3: cluster templates
+	func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(templateBucket)
+		return err
+	},
+	// 4: webhook subscriptions
+	func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(webhookBucket)
+		return err
+	},
+}
+
+// SchemaVersion is the schema version written by this build
+var SchemaVersion = len(migrations)
+
+// BoltStore keeps clusters, nodes, templates and history in an embedded
+// bbolt database. Each cluster is saved together with its nodes in a single
+// transaction.
+type BoltStore struct {
+	db        *bolt.DB
+	retention time.Duration
+	done      chan struct{}
+}
+
+// NewBoltStore opens (or creates) the database at path and migrates it to the
+// current schema. When retention is positive, stats history and webhook
+// deliveries older than retention are compacted away hourly.
+func NewBoltStore(path string, retention time.Duration) (*BoltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &BoltStore{
+		db:        db,
+		retention: retention,
+		done:      make(chan struct{}),
+	}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if retention > 0 {
+		go compactLoop(s, s.retention, s.done)
+	}
+	return s, nil
+}
+
+func (s *BoltStore) migrate() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+
+		version := 0
+		if raw := meta.Get(schemaVersionKey); raw != nil {
+			version = int(binary.BigEndian.Uint64(raw))
+		}
+		if version > SchemaVersion {
+			return fmt.Errorf("database schema version %d is newer than supported version %d", version, SchemaVersion)
+		}
+
+		for ; version < SchemaVersion; version++ {
+			if err := migrations[version](tx); err != nil {
+				return fmt.Errorf("migrating to schema version %d: %w", version+1, err)
+			}
+		}
+		return meta.Put(schemaVersionKey, encodeUint64(uint64(version)))
+	})
+}
+
+func (s *BoltStore) Load() ([]models.Cluster, error) {
+	clusters := make([]models.Cluster, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		nodes := tx.Bucket(nodesBucket)
+		return tx.Bucket(clustersBucket).ForEach(func(id, data []byte) error {
+			var stored storedCluster
+			if err := json.Unmarshal(data, &stored); err != nil {
+				return fmt.Errorf("decoding cluster %s: %w", id, err)
+			}
+			cluster := stored.restore()
+			cluster.Nodes = make([]models.Node, 0)
+			if clusterNodes := nodes.Bucket(id); clusterNodes != nil {
+				err := clusterNodes.ForEach(func(_, data []byte) error {
+					var node models.Node
+					if err := json.Unmarshal(data, &node); err != nil {
+						return fmt.Errorf("decoding node of cluster %s: %w", id, err)
+					}
+					cluster.Nodes = append(cluster.Nodes, node)
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+			clusters = append(clusters, cluster)
+			return nil
+		})
+	})
+	return clusters, err
+}
+
+func (s *BoltStore) SaveCluster(cluster models.Cluster) error {
+	nodes := cluster.Nodes
+	cluster.Nodes = nil
+	data, err := json.Marshal(newStoredCluster(cluster))
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		id := []byte(cluster.ID)
+		if err := tx.Bucket(clustersBucket).Put(id, data); err != nil {
+			return err
+		}
+
+		// Replace the cluster's nodes wholesale so removed nodes disappear
+		parent := tx.Bucket(nodesBucket)
+		if err := parent.DeleteBucket(id); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+			return err
+		}
+		clusterNodes, err := parent.CreateBucket(id)
+		if err != nil {
+			return err
+		}
+		// Keys keep nodes in their cluster order
+		for i, node := range nodes {
+			nodeData, err := json.Marshal(node)
+			if err != nil {
+				return err
+			}
+			if err := clusterNodes.Put(encodeUint64(uint64(i)), nodeData); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) DeleteCluster(clusterID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		id := []byte(clusterID)
+		if err := tx.Bucket(clustersBucket).Delete(id); err != nil {
+			return err
+		}
+		err := tx.Bucket(nodesBucket).DeleteBucket(id)
+		if err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+			return err
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore) LoadTemplates() ([]models.ClusterTemplate, error) {
+	templates := make([]models.ClusterTemplate, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(templateBucket).ForEach(func(id, data []byte) error {
+			var template models.ClusterTemplate
+			if err := json.Unmarshal(data, &template); err != nil {
+				return fmt.Errorf("decoding template %s: %w", id, err)
+			}
+			templates = append(templates, template)
+			return nil
+		})
+	})
+	return templates, err
+}
+
+func (s *BoltStore) SaveTemplate(template models.ClusterTemplate) error {
+	data, err := json.Marshal(template)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(templateBucket).Put([]byte(template.ID), data)
+	})
+}
+
+func (s *BoltStore) DeleteTemplate(templateID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(templateBucket).Delete([]byte(templateID))
+	})
+}
+
+func (s *BoltStore) LoadWebhooks() ([]events.Webhook, error) {
+	webhooks := make([]events.Webhook, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(webhookBucket).ForEach(func(id, data []byte) error {
+			var webhook events.Webhook
+			if err := json.Unmarshal(data, &webhook); err != nil {
+				return fmt.Errorf("decoding webhook %s: %w", id, err)
+			}
+			webhooks = append(webhooks, webhook)
+			return nil
+		})
+	})
+	return webhooks, err
+}
+
+func (s *BoltStore) SaveWebhook(webhook events.Webhook) error {
+	data, err := json.Marshal(webhook)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(webhookBucket).Put([]byte(webhook.ID), data)
+	})
+}
+
+func (s *BoltStore) DeleteWebhook(webhookID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(webhookBucket).Delete([]byte(webhookID))
+	})
+}
+
+func (s *BoltStore) AppendRecord(kind string, at time.Time, record interface{}) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		records, err := tx.Bucket(historyBucket).CreateBucketIfNotExists([]byte(kind))
+		if err != nil {
+			return err
+		}
+		// Timestamp prefix keeps records time ordered; the sequence keeps
+		// records with equal timestamps distinct
+		seq, err := records.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := append(encodeUint64(uint64(at.UnixNano())), encodeUint64(seq)...)
+		return records.Put(key, data)
+	})
+}
+
+func (s *BoltStore) Records(kind string, since, until time.Time, limit int) ([]json.RawMessage, error) {
+	result := make([]json.RawMessage, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		records := tx.Bucket(historyBucket).Bucket([]byte(kind))
+		if records == nil {
+			return nil
+		}
+		c := records.Cursor()
+		k, v := c.First()
+		if !since.IsZero() {
+			k, v = c.Seek(encodeUint64(uint64(since.UnixNano())))
+		}
+		var max []byte
+		if !until.IsZero() {
+			max = encodeUint64(uint64(until.UnixNano()))
+		}
+		for ; k != nil; k, v = c.Next() {
+			if max != nil && bytes.Compare(k[:8], max) > 0 {
+				break
+			}
+			result = append(result, append(json.RawMessage(nil), v...))
+			if limit > 0 && len(result) >= limit {
+				break
+			}
+		}
+		return nil
+	})
+	return result, err
+}
+
+func (s *BoltStore) Compact(retention time.Duration) (int, error) {
+	cutoff := encodeUint64(uint64(time.Now().Add(-retention).UnixNano()))
+	removed := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(historyBucket).ForEach(func(kind, v []byte) error {
+			if v != nil || !expiring(string(kind)) {
+				return nil // not a nested bucket, or kept forever
+			}
+			records := tx.Bucket(historyBucket).Bucket(kind)
+			// Collect first; deleting through a cursor while iterating skips keys
+			expired := make([][]byte, 0)
+			c := records.Cursor()
+			for k, _ := c.First(); k != nil && bytes.Compare(k[:8], cutoff) < 0; k, _ = c.Next() {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+			for _, k := range expired {
+				if err := records.Delete(k); err != nil {
+					return err
+				}
+			}
+			removed += len(expired)
+			return nil
+		})
+	})
+	return removed, err
+}
+
+func (s *BoltStore) Close() error {
+	close(s.done)
+	return s.db.Close()
+}
+
+func encodeUint64(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
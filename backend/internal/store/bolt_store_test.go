@@ -0,0 +1,61 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBoltStoreCompact(t *testing.T) {
+	s, err := NewBoltStore(filepath.Join(t.TempDir(), "go-balance.db"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tests := []struct {
+		kind    string
+		expires bool
+	}{
+		{KindStats, true},
+		{KindStats + "/cluster-1", true},
+		{KindDeliveries, true},
+		{KindAudit, false},
+		{KindRevisions, false},
+		{"statsd", false}, // only "stats" itself and its "/" kinds expire
+	}
+	now := time.Now()
+	for _, test := range tests {
+		for _, at := range []time.Time{now.Add(-3 * time.Hour), now.Add(-2 * time.Hour), now} {
+			if err := s.AppendRecord(test.kind, at, map[string]int64{"at": at.UnixNano()}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	removed, err := s.Compact(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 6 {
+		t.Errorf("removed %d records, want the 2 old ones of each of the 3 expiring kinds", removed)
+	}
+	for _, test := range tests {
+		records, err := s.Records(test.kind, time.Time{}, time.Time{}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := 3
+		if test.expires {
+			want = 1
+		}
+		if len(records) != want {
+			t.Errorf("%s: %d records left, want %d", test.kind, len(records), want)
+		}
+	}
+
+	// Compacting again finds nothing left to remove
+	if removed, err := s.Compact(time.Hour); err != nil || removed != 0 {
+		t.Errorf("second compaction removed %d records (err %v), want 0", removed, err)
+	}
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/CpBruceMeena/go-balance/internal/events"
+)
+
+// Record kinds kept by history stores
+const (
+	// Stats samples; kinds may be narrowed with a "/" suffix, such as one
+	// kind per cluster
+	KindStats = "stats"
+	KindAudit = "audit"
+	// Configuration revisions
+	KindRevisions = "revisions"
+	// Webhook delivery attempts
+	KindDeliveries = events.DeliveryRecordKind
+)
+
+// expiring reports whether records of kind are removed once older than the
+// retention period. Revisions and audit entries are a permanent record, so
+// revision numbers stay stable and rollback targets keep existing.
+func expiring(kind string) bool {
+	return kind == KindStats || strings.HasPrefix(kind, KindStats+"/") || kind == KindDeliveries
+}
+
+// HistoryStore is implemented by stores that also keep time-ordered
+// historical records such as stats samples and audit entries
+type HistoryStore interface {
+	// AppendRecord stores record under kind at the given time
+	AppendRecord(kind string, at time.Time, record interface{}) error
+	// Records returns records of kind within [since, until], oldest first.
+	// A zero since or until leaves that end open; limit <= 0 means no limit.
+	Records(kind string, since, until time.Time, limit int) ([]json.RawMessage, error)
+	// Compact removes stats records and webhook deliveries older than the retention period and
+	// returns how many were removed
+	Compact(retention time.Duration) (int, error)
+}
+
+// compactLoop compacts history hourly until done is closed
+func compactLoop(history HistoryStore, retention time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		if removed, err := history.Compact(retention); err != nil {
+			log.Printf("History compaction failed: %v", err)
+		} else if removed > 0 {
+			log.Printf("History compaction removed %d records", removed)
+		}
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/CpBruceMeena/go-balance/internal/events"
+	"github.com/CpBruceMeena/go-balance/internal/models"
+)
+
+const jsonStoreVersion = 1
+
+type jsonStoreFile struct {
+	Version   int                      `json:"version"`
+	Clusters  []storedCluster          `json:"clusters"`
+	Templates []models.ClusterTemplate `json:"templates,omitempty"`
+	Webhooks  []events.Webhook         `json:"webhooks,omitempty"`
+}
+
+// JSONStore keeps all clusters, templates and webhooks in a single JSON file. Every mutation rewrites
+// the file atomically by writing a temp file and renaming it into place, so a
+// crash never leaves a half-written file behind.
+type JSONStore struct {
+	path      string
+	clusters  map[string]models.Cluster
+	templates map[string]models.ClusterTemplate
+	webhooks  map[string]events.Webhook
+	mu        sync.Mutex
+}
+
+// NewJSONStore opens the store at path, creating its directory if needed.
+// A missing file is treated as an empty store.
+func NewJSONStore(path string) (*JSONStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	s := &JSONStore{
+		path:      path,
+		clusters:  make(map[string]models.Cluster),
+		templates: make(map[string]models.ClusterTemplate),
+		webhooks:  make(map[string]events.Webhook),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file jsonStoreFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if file.Version > jsonStoreVersion {
+		return nil, fmt.Errorf("%s has unsupported version %d", path, file.Version)
+	}
+	for _, cluster := range file.Clusters {
+		s.clusters[cluster.ID] = cluster.restore()
+	}
+	for _, template := range file.Templates {
+		s.templates[template.ID] = template
+	}
+	for _, webhook := range file.Webhooks {
+		s.webhooks[webhook.ID] = webhook
+	}
+	return s, nil
+}
+
+func (s *JSONStore) Load() ([]models.Cluster, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sortedLocked(), nil
+}
+
+func (s *JSONStore) SaveCluster(cluster models.Cluster) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, existed := s.clusters[cluster.ID]
+	s.clusters[cluster.ID] = cluster
+	if err := s.writeLocked(); err != nil {
+		if existed {
+			s.clusters[cluster.ID] = previous
+		} else {
+			delete(s.clusters, cluster.ID)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *JSONStore) DeleteCluster(clusterID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, existed := s.clusters[clusterID]
+	if !existed {
+		return nil
+	}
+	delete(s.clusters, clusterID)
+	if err := s.writeLocked(); err != nil {
+		s.clusters[clusterID] = previous
+		return err
+	}
+	return nil
+}
+
+func (s *JSONStore) LoadTemplates() ([]models.ClusterTemplate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sortedTemplatesLocked(), nil
+}
+
+func (s *JSONStore) SaveTemplate(template models.ClusterTemplate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, existed := s.templates[template.ID]
+	s.templates[template.ID] = template
+	if err := s.writeLocked(); err != nil {
+		if existed {
+			s.templates[template.ID] = previous
+		} else {
+			delete(s.templates, template.ID)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *JSONStore) DeleteTemplate(templateID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, existed := s.templates[templateID]
+	if !existed {
+		return nil
+	}
+	delete(s.templates, templateID)
+	if err := s.writeLocked(); err != nil {
+		s.templates[templateID] = previous
+		return err
+	}
+	return nil
+}
+
+func (s *JSONStore) LoadWebhooks() ([]events.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sortedWebhooksLocked(), nil
+}
+
+func (s *JSONStore) SaveWebhook(webhook events.Webhook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, existed := s.webhooks[webhook.ID]
+	s.webhooks[webhook.ID] = webhook
+	if err := s.writeLocked(); err != nil {
+		if existed {
+			s.webhooks[webhook.ID] = previous
+		} else {
+			delete(s.webhooks, webhook.ID)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *JSONStore) DeleteWebhook(webhookID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, existed := s.webhooks[webhookID]
+	if !existed {
+		return nil
+	}
+	delete(s.webhooks, webhookID)
+	if err := s.writeLocked(); err != nil {
+		s.webhooks[webhookID] = previous
+		return err
+	}
+	return nil
+}
+
+func (s *JSONStore) Close() error {
+	return nil
+}
+
+func (s *JSONStore) sortedLocked() []models.Cluster {
+	clusters := make([]models.Cluster, 0, len(s.clusters))
+	for _, cluster := range s.clusters {
+		clusters = append(clusters, cluster)
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i].ID < clusters[j].ID
+	})
+	return clusters
+}
+
+func (s *JSONStore) sortedTemplatesLocked() []models.ClusterTemplate {
+	templates := make([]models.ClusterTemplate, 0, len(s.templates))
+	for _, template := range s.templates {
+		templates = append(templates, template)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].ID < templates[j].ID
+	})
+	return templates
+}
+
+func (s *JSONStore) sortedWebhooksLocked() []events.Webhook {
+	webhooks := make([]events.Webhook, 0, len(s.webhooks))
+	for _, webhook := range s.webhooks {
+		webhooks = append(webhooks, webhook)
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i].ID < webhooks[j].ID
+	})
+	return webhooks
+}
+
+func (s *JSONStore) writeLocked() error {
+	clusters := s.sortedLocked()
+	stored := make([]storedCluster, len(clusters))
+	for i, cluster := range clusters {
+		stored[i] = newStoredCluster(cluster)
+	}
+	data, err := json.MarshalIndent(jsonStoreFile{
+		Version:   jsonStoreVersion,
+		Clusters:  stored,
+		Templates: s.sortedTemplatesLocked(),
+		Webhooks:  s.sortedWebhooksLocked(),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, data)
+}
+
+// writeFileAtomic replaces path with data via a synced temp file and rename
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
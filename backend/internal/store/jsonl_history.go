@@ -0,0 +1,150 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// jsonLine is a single record in a JSONLinesHistory file
+type jsonLine struct {
+	Kind   string          `json:"kind"`
+	At     time.Time       `json:"at"`
+	Record json.RawMessage `json:"record"`
+}
+
+// JSONLinesHistory is an append-only HistoryStore kept in a JSON lines file,
+// for deployments whose cluster store has no history support. Records are
+// expected to be appended in time order.
+type JSONLinesHistory struct {
+	path string
+	file *os.File
+	mu   sync.Mutex
+	done chan struct{}
+}
+
+// NewJSONLinesHistory opens (or creates) the history file at path. When
+// retention is positive, records older than retention are compacted away
+// hourly.
+func NewJSONLinesHistory(path string, retention time.Duration) (*JSONLinesHistory, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	h := &JSONLinesHistory{path: path, file: file, done: make(chan struct{})}
+	if retention > 0 {
+		go compactLoop(h, retention, h.done)
+	}
+	return h, nil
+}
+
+// AppendRecord writes record as a new line and syncs it to disk
+func (h *JSONLinesHistory) AppendRecord(kind string, at time.Time, record interface{}) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(jsonLine{Kind: kind, At: at, Record: data})
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, err := h.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return h.file.Sync()
+}
+
+// Records scans the file for records of kind within [since, until]
+func (h *JSONLinesHistory) Records(kind string, since, until time.Time, limit int) ([]json.RawMessage, error) {
+	result := make([]json.RawMessage, 0)
+	err := h.scan(func(line jsonLine, _ []byte) bool {
+		if line.Kind != kind || (!since.IsZero() && line.At.Before(since)) || (!until.IsZero() && line.At.After(until)) {
+			return true
+		}
+		result = append(result, line.Record)
+		return limit <= 0 || len(result) < limit
+	})
+	return result, err
+}
+
+// Compact rewrites the file without stats records older than the retention
+// period
+func (h *JSONLinesHistory) Compact(retention time.Duration) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	cutoff := time.Now().Add(-retention)
+	removed := 0
+	var kept bytes.Buffer
+	err := h.scanLocked(func(line jsonLine, raw []byte) bool {
+		if expiring(line.Kind) && line.At.Before(cutoff) {
+			removed++
+		} else {
+			kept.Write(raw)
+			kept.WriteByte('\n')
+		}
+		return true
+	})
+	if err != nil || removed == 0 {
+		return 0, err
+	}
+
+	if err := writeFileAtomic(h.path, kept.Bytes()); err != nil {
+		return 0, err
+	}
+	// Reopen so appends go to the rewritten file
+	file, err := os.OpenFile(h.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	h.file.Close()
+	h.file = file
+	return removed, nil
+}
+
+// scan calls fn for every line in the file until it returns false
+func (h *JSONLinesHistory) scan(fn func(line jsonLine, raw []byte) bool) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.scanLocked(fn)
+}
+
+func (h *JSONLinesHistory) scanLocked(fn func(line jsonLine, raw []byte) bool) error {
+	file, err := os.Open(h.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		raw := scanner.Bytes()
+		var line jsonLine
+		if err := json.Unmarshal(raw, &line); err != nil {
+			continue // skip a line torn by a crash mid-write
+		}
+		if !fn(line, raw) {
+			break
+		}
+	}
+	return scanner.Err()
+}
+
+// Close closes the file
+func (h *JSONLinesHistory) Close() error {
+	close(h.done)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.file.Close()
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"github.com/CpBruceMeena/go-balance/internal/events"
+	"github.com/CpBruceMeena/go-balance/internal/models"
+)
+
+// Store persists cluster and node configuration so it survives restarts
+type Store interface {
+	// Load returns every persisted cluster
+	Load() ([]models.Cluster, error)
+	// SaveCluster creates or replaces a cluster together with its nodes
+	SaveCluster(cluster models.Cluster) error
+	// DeleteCluster removes a cluster and its nodes
+	DeleteCluster(clusterID string) error
+	Close() error
+}
+
+// TemplateStore is implemented by stores that also persist cluster templates
+type TemplateStore interface {
+	// LoadTemplates returns every persisted template
+	LoadTemplates() ([]models.ClusterTemplate, error)
+	// SaveTemplate creates or replaces a template
+	SaveTemplate(template models.ClusterTemplate) error
+	DeleteTemplate(templateID string) error
+}
+
+// WebhookStore is implemented by stores that also persist webhook
+// subscriptions, secrets included
+type WebhookStore interface {
+	// LoadWebhooks returns every persisted webhook
+	LoadWebhooks() ([]events.Webhook, error)
+	// SaveWebhook creates or replaces a webhook
+	SaveWebhook(webhook events.Webhook) error
+	DeleteWebhook(webhookID string) error
+}
+
+// storedCluster is a cluster as persisted, including the fields the API
+// never shows
+type storedCluster struct {
+	models.Cluster
+	RegistrationTokenHash string `json:"registrationTokenHash,omitempty"`
+	HeartbeatTokenHash    string `json:"heartbeatTokenHash,omitempty"`
+}
+
+func newStoredCluster(cluster models.Cluster) storedCluster {
+	stored := storedCluster{Cluster: cluster}
+	if cluster.Registration != nil {
+		stored.RegistrationTokenHash = cluster.Registration.TokenHash
+	}
+	if cluster.HeartbeatAuth != nil {
+		stored.HeartbeatTokenHash = cluster.HeartbeatAuth.TokenHash
+	}
+	return stored
+}
+
+// restore returns the cluster with the fields kept outside its JSON form
+func (s storedCluster) restore() models.Cluster {
+	cluster := s.Cluster
+	if cluster.Registration != nil {
+		registration := *cluster.Registration
+		registration.TokenHash = s.RegistrationTokenHash
+		cluster.Registration = &registration
+	}
+	if cluster.HeartbeatAuth != nil {
+		auth := *cluster.HeartbeatAuth
+		auth.TokenHash = s.HeartbeatTokenHash
+		cluster.HeartbeatAuth = &auth
+	}
+	return cluster
+}
@@ -1,4 +1,5 @@
 import { useState, useEffect, useCallback } from 'react';
+import axios from 'axios';
 import { clusterService, type Cluster, type CreateClusterRequest, type NodeMetric } from '../services/clusterService';
 import { colors } from '../theme/colors';
 import { 
@@ -47,6 +48,12 @@ import AutorenewIcon from '@mui/icons-material/Autorenew';
 
 Chart.register(ArcElement, BarElement, CategoryScale, LinearScale, ChartTooltip, Legend);
 
+// Explains edits rejected because someone else changed the cluster first
+const editFailureMessage = (err: unknown, fallback: string) =>
+  axios.isAxiosError(err) && (err.response?.status === 409 || err.response?.status === 412)
+    ? 'Cluster was changed by someone else; reload it and try again'
+    : fallback;
+
 // 1. Main background
 const mainBackground = 'var(--linen)';
 // 2. Cluster card background and border
@@ -184,12 +191,14 @@ const ClusterManagement = () => {
   };
 
   const handleDeleteCluster = async (clusterId: string) => {
+    const cluster = clusters.find(c => c.id === clusterId);
     try {
-      await clusterService.deleteCluster(clusterId);
+      await clusterService.deleteCluster(clusterId, cluster?.resourceVersion ?? 0);
       fetchClusters();
       setError('');
     } catch (err) {
-      setSnackbar({ open: true, message: 'Failed to delete cluster', severity: 'error' });
+      setSnackbar({ open: true, message: editFailureMessage(err, 'Failed to delete cluster'), severity: 'error' });
+      fetchClusters();
     }
   };
 
@@ -245,19 +254,20 @@ const ClusterManagement = () => {
   };
 
   const handleSaveCluster = async (clusterId: string) => {
+    const cluster = clusters.find(c => c.id === clusterId);
     try {
       const updatedCluster = await clusterService.updateCluster(clusterId, {
         healthCheckEndpoint: editHealthCheckEndpoint,
         healthCheckFrequency: editHealthCheckFrequency,
         environment: editEnvironment,
-      });
+      }, cluster?.resourceVersion ?? 0);
       setClusters(clusters.map(cluster =>
         cluster.id === clusterId ? updatedCluster : cluster
       ));
       setEditingCluster(null);
       setSnackbar({ open: true, message: 'Cluster updated successfully!', severity: 'success' });
     } catch (err) {
-      setSnackbar({ open: true, message: 'Failed to update cluster', severity: 'error' });
+      setSnackbar({ open: true, message: editFailureMessage(err, 'Failed to update cluster'), severity: 'error' });
     }
   };
 
@@ -293,14 +303,29 @@ const ClusterManagement = () => {
     alert(`Test All Nodes triggered for cluster ${clusterId}`);
   };
 
+  // Draining nodes finish their in-flight requests, then go into maintenance
   const handleDrainNode = async (clusterId: string, nodeId: string) => {
-    // TODO: Implement backend call to drain node
-    alert(`Drain Node triggered for node ${nodeId}`);
+    try {
+      await clusterService.updateNode(clusterId, nodeId, { adminState: 'draining' });
+      setSnackbar({ open: true, message: 'Node is draining', severity: 'success' });
+      fetchClusters();
+    } catch (err) {
+      setSnackbar({ open: true, message: 'Failed to drain node', severity: 'error' });
+      console.error('Error draining node:', err);
+    }
   };
 
   const handleBulkDrain = async (clusterId: string) => {
-    // TODO: Implement backend call to drain selected nodes
-    alert(`Drain Selected Nodes: ${Object.keys(selectedNodes).filter(id => selectedNodes[id]).join(', ')}`);
+    const nodeIds = Object.keys(selectedNodes).filter(id => selectedNodes[id]);
+    try {
+      await clusterService.updateNodes(clusterId, nodeIds, { adminState: 'draining' });
+      setSelectedNodes({});
+      setSnackbar({ open: true, message: `Draining ${nodeIds.length} nodes`, severity: 'success' });
+      fetchClusters();
+    } catch (err) {
+      setSnackbar({ open: true, message: 'Failed to drain selected nodes', severity: 'error' });
+      console.error('Error draining nodes:', err);
+    }
   };
 
   const handleBulkDelete = async (clusterId: string) => {
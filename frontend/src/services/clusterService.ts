@@ -2,6 +2,14 @@ import axios from 'axios';
 
 const API_BASE_URL = 'http://localhost:8080/api';
 
+export type NodeAdminState = 'active' | 'draining' | 'maintenance';
+
+export interface NodeAdminChange {
+  adminState: NodeAdminState;
+  drainTimeout?: number;
+  drainThen?: 'maintenance' | 'remove';
+}
+
 export interface Node {
   id: string;
   url: string;
@@ -14,10 +22,34 @@ export interface Node {
   responseTime?: number;
   createdAt?: string;
   weight?: number;
+  labels?: Record<string, string>;
+  disabled?: boolean;
+  adminState?: NodeAdminState;
+  drainDeadline?: string;
+  drainThen?: 'maintenance' | 'remove';
+  inFlight?: number;
+  priority?: number;
+  managedBy?: string;
+  leaseId?: string;
+  leaseTTL?: number;
+  leaseExpiresAt?: string;
   connections?: number;
   errorRate?: number;
 }
 
+export interface ClusterDiscovery {
+  type: 'dns' | 'srv' | 'file' | 'consul';
+  name?: string;
+  port?: number;
+  scheme?: 'http' | 'https';
+  server?: string;
+  minTTL?: number;
+  maxTTL?: number;
+  path?: string;
+  tag?: string;
+  datacenter?: string;
+}
+
 export interface Cluster {
   id: string;
   name: string;
@@ -28,6 +60,13 @@ export interface Cluster {
   createdAt: string;
   updatedAt: string;
   publicEndpoint: string;
+  slug: string;
+  slugAliases?: { slug: string; expiresAt: string }[];
+  template?: string;
+  discovery?: ClusterDiscovery;
+  registration?: { issuedAt: string };
+  heartbeatAuth?: { issuedAt: string };
+  resourceVersion: number;
   totalRequests?: number;
   requestsPerSec?: number;
   lastRequest?: string;
@@ -36,12 +75,28 @@ export interface Cluster {
 
 export interface CreateClusterRequest {
   name: string;
+  slug?: string;
+  template?: string;
+  discovery?: ClusterDiscovery;
   algorithm: string;
   healthCheckEndpoint: string;
   healthCheckFrequency: number;
   environment?: string;
 }
 
+export interface ClusterTemplate {
+  id: string;
+  name: string;
+  description?: string;
+  algorithm?: string;
+  healthCheckEndpoint?: string;
+  healthCheckFrequency?: number;
+  createdAt: string;
+  updatedAt: string;
+}
+
+export type ClusterTemplateRequest = Omit<ClusterTemplate, 'id' | 'createdAt' | 'updatedAt'>;
+
 export interface NodeMetric {
   id: string;
   url: string;
@@ -55,19 +110,69 @@ export interface NodeMetric {
   responseTime?: number;
 }
 
+// Sends the version an edit is based on so concurrent edits are rejected
+const ifMatch = (resourceVersion: number) => ({ headers: { 'If-Match': `"${resourceVersion}"` } });
+
 export const clusterService = {
   async getClusters(): Promise<Cluster[]> {
     const response = await axios.get<Cluster[]>(`${API_BASE_URL}/clusters`);
     return response.data;
   },
 
+  async getCluster(clusterId: string): Promise<Cluster> {
+    const response = await axios.get<Cluster>(`${API_BASE_URL}/clusters/${clusterId}`);
+    return response.data;
+  },
+
   async createCluster(cluster: CreateClusterRequest): Promise<Cluster> {
     const response = await axios.post<Cluster>(`${API_BASE_URL}/clusters`, cluster);
     return response.data;
   },
 
-  async deleteCluster(clusterId: string): Promise<void> {
-    await axios.delete(`${API_BASE_URL}/clusters/${clusterId}`);
+  async deleteCluster(clusterId: string, resourceVersion: number): Promise<void> {
+    await axios.delete(`${API_BASE_URL}/clusters/${clusterId}`, ifMatch(resourceVersion));
+  },
+
+  async cloneCluster(clusterId: string, name: string, includeNodes: boolean, slug?: string): Promise<Cluster> {
+    const response = await axios.post<Cluster>(`${API_BASE_URL}/clusters/${clusterId}/clone`, { name, slug, includeNodes });
+    return response.data;
+  },
+
+  async createRegistrationToken(clusterId: string): Promise<{ token: string; issuedAt: string }> {
+    const response = await axios.post<{ token: string; issuedAt: string }>(`${API_BASE_URL}/clusters/${clusterId}/registration-token`);
+    return response.data;
+  },
+
+  async deleteRegistrationToken(clusterId: string): Promise<void> {
+    await axios.delete(`${API_BASE_URL}/clusters/${clusterId}/registration-token`);
+  },
+
+  async createHeartbeatToken(clusterId: string): Promise<{ token: string; issuedAt: string }> {
+    const response = await axios.post<{ token: string; issuedAt: string }>(`${API_BASE_URL}/clusters/${clusterId}/heartbeat-token`);
+    return response.data;
+  },
+
+  async deleteHeartbeatToken(clusterId: string): Promise<void> {
+    await axios.delete(`${API_BASE_URL}/clusters/${clusterId}/heartbeat-token`);
+  },
+
+  async getTemplates(): Promise<ClusterTemplate[]> {
+    const response = await axios.get<ClusterTemplate[]>(`${API_BASE_URL}/templates`);
+    return response.data;
+  },
+
+  async createTemplate(template: ClusterTemplateRequest): Promise<ClusterTemplate> {
+    const response = await axios.post<ClusterTemplate>(`${API_BASE_URL}/templates`, template);
+    return response.data;
+  },
+
+  async updateTemplate(templateId: string, template: ClusterTemplateRequest): Promise<ClusterTemplate> {
+    const response = await axios.put<ClusterTemplate>(`${API_BASE_URL}/templates/${templateId}`, template);
+    return response.data;
+  },
+
+  async deleteTemplate(templateId: string): Promise<void> {
+    await axios.delete(`${API_BASE_URL}/templates/${templateId}`);
   },
 
   async addNode(clusterId: string, url: string, weight: number): Promise<Node> {
@@ -82,18 +187,27 @@ export const clusterService = {
     await axios.delete(`${API_BASE_URL}/clusters/${clusterId}/nodes/${nodeId}`);
   },
 
+  async updateNode(clusterId: string, nodeId: string, changes: { url?: string; weight?: number; labels?: Record<string, string>; enabled?: boolean } | NodeAdminChange): Promise<Node> {
+    const response = await axios.patch<Node>(`${API_BASE_URL}/clusters/${clusterId}/nodes/${nodeId}`, changes);
+    return response.data;
+  },
+
+  async updateNodes(clusterId: string, nodeIds: string[], change: NodeAdminChange): Promise<void> {
+    await axios.patch(`${API_BASE_URL}/clusters/${clusterId}/nodes:batch`, { nodeIds, ...change });
+  },
+
   async checkNodeHealth(clusterId: string, nodeId: string): Promise<Node> {
     const response = await axios.get<Node>(`${API_BASE_URL}/clusters/${clusterId}/nodes/${nodeId}/health`);
     return response.data;
   },
 
-  async updateClusterAlgorithm(clusterId: string, algorithm: Cluster['algorithm']): Promise<Cluster> {
-    const response = await axios.put<Cluster>(`${API_BASE_URL}/clusters/${clusterId}/algorithm`, { algorithm });
+  async updateClusterAlgorithm(clusterId: string, algorithm: Cluster['algorithm'], resourceVersion: number): Promise<Cluster> {
+    const response = await axios.put<Cluster>(`${API_BASE_URL}/clusters/${clusterId}/algorithm`, { algorithm }, ifMatch(resourceVersion));
     return response.data;
   },
 
-  async updateCluster(clusterId: string, data: { healthCheckEndpoint: string; healthCheckFrequency: number; environment?: string }): Promise<Cluster> {
-    const response = await axios.put<Cluster>(`${API_BASE_URL}/clusters/${clusterId}`, data);
+  async updateCluster(clusterId: string, data: { healthCheckEndpoint: string; healthCheckFrequency: number; environment?: string; discovery?: ClusterDiscovery | { type: '' } }, resourceVersion: number): Promise<Cluster> {
+    const response = await axios.put<Cluster>(`${API_BASE_URL}/clusters/${clusterId}`, data, ifMatch(resourceVersion));
     return response.data;
   },
 